@@ -2,16 +2,37 @@ SET client_min_messages TO WARNING;
 
 -- DROP ALL TABLES
 DROP FUNCTION IF EXISTS axl_data.axl_update_qm(varchar, varchar) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_qm(varchar, varchar, text, bool) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_qm(varchar, varchar, text, bool, text) CASCADE;
 DROP FUNCTION IF EXISTS axl_data.axl_update_couples_by_device(int) CASCADE; -- old before version 2.1
 DROP FUNCTION IF EXISTS axl_data.axl_update_couples_by_device(int, bool) CASCADE;
 DROP FUNCTION IF EXISTS axl_data.axl_update_couples_by_line(int) CASCADE; -- old before version 2.1
 DROP FUNCTION IF EXISTS axl_data.axl_update_couples_by_line(int, bool) CASCADE;
 DROP FUNCTION IF EXISTS axl_data.axl_update_login_users(varchar, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_login_users(varchar, text, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_login_users(text) CASCADE;
 DROP FUNCTION IF EXISTS axl_data.axl_update_users(varchar, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_users(varchar, text, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_users(text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_user_groups(text, text, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_update_em_sessions(text, text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_save_duplicates(text) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_save_change_cursor(varchar, varchar, varchar, bigint) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_save_schema_version(varchar, varchar, varchar) CASCADE;
+DROP FUNCTION IF EXISTS axl_data.axl_map_team(varchar, text) CASCADE;
 DROP FUNCTION IF EXISTS axl_data.fix_varchar_len(varchar, integer) CASCADE;
 DROP TABLE IF EXISTS axl_data.couple_last_update CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_change_cursor CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_schema_version CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_user_team CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_user_role CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_user_groups CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_em_sessions CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_duplicates CASCADE;
+DROP TABLE IF EXISTS axl_data.axl_duplicate_runs CASCADE;
 DROP TABLE IF EXISTS axl_data.axl_login_users CASCADE;
 DROP TABLE IF EXISTS axl_data.axl_users CASCADE;
+DROP TABLE IF EXISTS axl_data.schema_version CASCADE;
 
 -- REVOKE ACCESS TO SCHEMAS
 REVOKE ALL ON SCHEMA axl_data FROM wbscgrp;
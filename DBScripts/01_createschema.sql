@@ -3,7 +3,15 @@
  */
 CREATE SCHEMA if not exists axl_data;
 
-CREATE USER axlUser LOGIN PASSWORD 'a4lUs3r.' NOSUPERUSER NOCREATEDB NOCREATEROLE INHERIT NOREPLICATION CONNECTION LIMIT -1;
+-- user is created only on first installation, upgrade keep existing user
+DO
+$$
+    BEGIN
+        IF NOT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = 'axluser') THEN
+            CREATE USER axlUser LOGIN PASSWORD 'a4lUs3r.' NOSUPERUSER NOCREATEDB NOCREATEROLE INHERIT NOREPLICATION CONNECTION LIMIT -1;
+        END IF;
+    END
+$$;
 ALTER ROLE axlUser WITH LOGIN;
 
 GRANT ALL ON SCHEMA axl_data TO axlUser;
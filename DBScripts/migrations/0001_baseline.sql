@@ -0,0 +1,1508 @@
+SET client_min_messages TO WARNING;
+
+/*
+  Migration 1, baseline schema. Tables are created only when not exists
+  and tables created by older DBScripts get new columns, history is kept.
+ */
+create table if not exists axl_data.axl_users
+(
+    user_pkid          varchar(128),                     -- AXL pkid from enduser table
+    device_pkid        varchar(128),                     -- AXL pkid from device table
+    line_pkid          varchar(128),                     -- AXL pkid from numplan table
+    first_name         varchar(64),
+    middle_name        varchar(64),
+    last_name          varchar(64),
+    user_id            varchar(144),
+    department         varchar(64),
+    status             int       default 1     not null, -- 0= disabled user 1= enabled
+    is_local_user      bool      default true  not null, -- false sync from AD
+    has_uccx           bool      default false not null, -- use enabled for UCCX
+    directory_uri      varchar(256),
+    mail_id            varchar(256),
+    device_name        varchar(130),
+    device_description varchar(512),
+    line_number        varchar(64),
+    line_alerting_name varchar(128),
+    line_description   varchar(256),
+    line_partition     varchar(50),                      -- route partition of line, same DN can exist in more partitions
+    device_model       varchar(100),                     -- product name from typemodel
+    model_enum         int,                              -- tkmodel of device
+    device_class       varchar(50),                      -- class name from typeclass
+    class_enum         int,                              -- tkclass of device
+    device_type        varchar(20),                      -- desk, jabber, ctiport, routepoint, gateway, profile or other
+    device_mapping     bool      default true  not null, -- device type is used for couple mapping
+    cluster_name       varchar(255),                     -- CUCM cluster, part of row identity
+    is_deleted_on_axl  bool      default false not null, -- for hold not updated
+    wbsc_id            int       default 0     not null, -- connect id from wbsc
+    date_insert        timestamp default now() not null, -- date when row inserted into table
+    date_updated       timestamp default now() not null  -- last update or part of used for mark is_deleted_on_axl and final delete from table
+);
+comment on table axl_data.axl_users is 'Main table synchronize from AXL server';
+
+-- columns missing in tables created by older DBScripts, existing rows are kept
+alter table axl_data.axl_users add column if not exists line_partition varchar(50);
+alter table axl_data.axl_users add column if not exists device_model varchar(100);
+alter table axl_data.axl_users add column if not exists model_enum int;
+alter table axl_data.axl_users add column if not exists device_class varchar(50);
+alter table axl_data.axl_users add column if not exists class_enum int;
+alter table axl_data.axl_users add column if not exists device_type varchar(20);
+alter table axl_data.axl_users add column if not exists device_mapping bool default true not null;
+alter table axl_data.axl_users add column if not exists cluster_name varchar(255);
+
+create index if not exists axl_users_user_id_device_name_index
+    on axl_data.axl_users (user_id, device_name);
+
+create index if not exists axl_users_user_id_line_number_index
+    on axl_data.axl_users (user_id, line_number);
+
+create index if not exists axl_users_user_pkid_device_pkid_line_pkid_index
+    on axl_data.axl_users (user_pkid, device_pkid, line_pkid);
+
+drop view if exists axl_data.axl_user_device_view;
+create or replace view axl_data.axl_user_device_view as
+select user_pkid,
+       first_name,
+       last_name,
+       middle_name,
+       user_id,
+       department,
+       directory_uri,
+       mail_id,
+       device_name,
+       device_description,
+       wbsc_id,
+       has_uccx
+from axl_data.axl_users
+where status = 1
+  and is_deleted_on_axl = false
+  and device_mapping = true
+group by user_pkid, first_name, last_name, middle_name, user_id, department, directory_uri, mail_id, device_name,
+         device_description, wbsc_id, has_uccx;
+comment on view axl_data.axl_user_device_view is 'Help view return only user/device list';
+
+drop view if exists axl_data.axl_user_line_view;
+create or replace view axl_data.axl_user_line_view as
+select user_pkid,
+       first_name,
+       last_name,
+       middle_name,
+       user_id,
+       department,
+       directory_uri,
+       mail_id,
+       line_number,
+       line_partition,
+       line_alerting_name,
+       line_description,
+       wbsc_id,
+       has_uccx
+from axl_data.axl_users
+where status = 1
+  and is_deleted_on_axl = false
+  and device_mapping = true
+group by user_pkid, first_name, last_name, middle_name, user_id, department, directory_uri, mail_id, line_number,
+         line_partition, line_alerting_name, line_description, wbsc_id, has_uccx;
+comment on view axl_data.axl_user_line_view is 'Help view return only user/line list';
+
+/*
+  Importer create temp table pg_temp.axl_users_tmp (columns of axl_users without state columns),
+  fill it by COPY and call update function in same transaction. Temp table is dropped on commit.
+ */
+drop table if exists axl_data.axl_users_tmp;
+
+/*
+ Deleted users on AXL are deleted there after not update for mor than 3 days.
+ Other mark as deleted on axl
+ */
+drop function if exists axl_data.axl_update_users(CHARACTER VARYING, TEXT);
+drop function if exists axl_data.axl_update_users(CHARACTER VARYING, TEXT, TEXT);
+create or replace function axl_data.axl_update_users(scope_json TEXT default null) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+begin
+
+    update pg_temp.axl_users_tmp
+    set user_pkid = axl_users_tmp.cluster_name || '_' || axl_users_tmp.user_pkid
+    where user_id = user_id;
+
+    insert into axl_data.axl_users (user_pkid, device_pkid, line_pkid, first_name, middle_name, last_name, user_id,
+                                    department,
+                                    status, is_local_user, directory_uri, mail_id, device_name, device_description,
+                                    line_number,
+                                    line_alerting_name, line_description, line_partition, device_model, model_enum,
+                                    device_class, class_enum, device_type, device_mapping, has_uccx, cluster_name)
+    SELECT user_pkid,
+           device_pkid,
+           line_pkid,
+           first_name,
+           middle_name,
+           last_name,
+           user_id,
+           department,
+           status,
+           is_local_user,
+           directory_uri,
+           mail_id,
+           device_name,
+           device_description,
+           line_number,
+           line_alerting_name,
+           line_description,
+           line_partition,
+           device_model,
+           model_enum,
+           device_class,
+           class_enum,
+           device_type,
+           device_mapping,
+           has_uccx,
+           cluster_name
+    from pg_temp.axl_users_tmp
+    where (user_pkid || device_pkid || line_pkid) not in
+          (select user_pkid || device_pkid || line_pkid from axl_data.axl_users);
+
+    update axl_data.axl_users
+    set first_name=t.first_name,
+        middle_name=t.middle_name,
+        last_name=t.last_name,
+        user_id=t.user_id,
+        department=t.department,
+        status=t.status,
+        is_local_user=t.is_local_user,
+        directory_uri=t.directory_uri,
+        mail_id=t.mail_id,
+        device_name=t.device_name,
+        device_description=t.device_description,
+        line_number=t.line_number,
+        line_alerting_name=t.line_alerting_name,
+        line_description=t.line_description,
+        line_partition=t.line_partition,
+        device_model=t.device_model,
+        model_enum=t.model_enum,
+        device_class=t.device_class,
+        class_enum=t.class_enum,
+        device_type=t.device_type,
+        device_mapping=t.device_mapping,
+        is_deleted_on_axl= false,
+        has_uccx=t.has_uccx,
+        cluster_name=t.cluster_name,
+        date_updated=now()
+    from pg_temp.axl_users_tmp t
+    where axl_users.user_pkid = t.user_pkid
+      and axl_users.device_pkid = t.device_pkid
+      and axl_users.line_pkid = t.line_pkid;
+
+    if scope_json is null then
+        delete from axl_data.axl_users where date_updated < now()::DATE - INTERVAL '5 days';
+
+        -- only clusters read in this import, rows from not accessible clusters stay unchanged
+        update axl_data.axl_users
+        set is_deleted_on_axl= true
+        where (cluster_name is null or cluster_name in (select distinct cluster_name from pg_temp.axl_users_tmp))
+          and (user_pkid || device_pkid || line_pkid) not in
+              (select user_pkid || device_pkid || line_pkid from pg_temp.axl_users_tmp);
+    else
+        -- incremental sync, only rows with changed user, device or line
+        update axl_data.axl_users
+        set is_deleted_on_axl= true
+        where cluster_name = scope_json::json ->> 'cluster_name'
+          and (substr(user_pkid, length(cluster_name) + 2) in (select json_array_elements_text(scope_json::json -> 'pkid'))
+            or device_pkid in (select json_array_elements_text(scope_json::json -> 'pkid'))
+            or line_pkid in (select json_array_elements_text(scope_json::json -> 'pkid')))
+          and (user_pkid || device_pkid || line_pkid) not in
+              (select user_pkid || device_pkid || line_pkid from pg_temp.axl_users_tmp);
+    end if;
+
+    return 1;
+end;
+$$;
+comment on function axl_data.axl_update_users(scope_json TEXT) is 'Bulk data update from pg_temp.axl_users_tmp, with scope only changed rows';
+
+
+/*
+ Table for user with valid role in CUCM for allow login to QM
+ */
+CREATE TABLE if not exists axl_data.axl_login_users
+(
+    user_pkid         varchar(128),                     -- AXL pkid from enduser table
+    first_name        varchar(64),
+    middle_name       varchar(64),
+    last_name         varchar(64),
+    user_id           varchar(144),
+    department        varchar(64),
+    status            int       default 1     not null, -- 0= disabled user 1= enabled
+    is_local_user     bool      default true  not null, -- false sync from AD
+    has_uccx          bool      default false not null, -- is user enabled for UCCX
+    directory_uri     varchar(256),
+    mail_id           varchar(256),
+    cluster_name      varchar(255),                     -- CUCM cluster, part of row identity
+    access_group      varchar(128),                     -- access control group matched for user
+    default_team      varchar(50),                      -- default team of access group, null use processing default
+    default_role      varchar(255),                     -- default role of access group, null use processing default
+    is_deleted_on_axl bool      default false not null, -- for hold not updated
+    wbsc_id           int       default 0     not null, -- connect id from wbsc
+    date_insert       timestamp default now() not null, -- date when row inserted into table
+    date_updated      timestamp default now() not null  -- last update or part of used for mark is_deleted_on_axl and final delete from table
+);
+comment on table axl_data.axl_login_users is 'User synchronize from AXL server with associate role';
+
+-- columns missing in tables created by older DBScripts
+alter table axl_data.axl_login_users add column if not exists cluster_name varchar(255);
+alter table axl_data.axl_login_users add column if not exists access_group varchar(128);
+alter table axl_data.axl_login_users add column if not exists default_team varchar(50);
+alter table axl_data.axl_login_users add column if not exists default_role varchar(255);
+
+create index if not exists axl_login_users_user_id_index
+    on axl_data.axl_login_users (user_id);
+
+/*
+ Deleted users on AXL are deleted there after not update for more than 3 days.
+ Other mark as deleted on axl
+ */
+/*
+  Importer fill temp table pg_temp.axl_login_users_tmp by COPY, see axl_users_tmp.
+ */
+drop table if exists axl_data.axl_login_users_tmp;
+
+drop function if exists axl_data.axl_update_login_users(CHARACTER VARYING, TEXT);
+drop function if exists axl_data.axl_update_login_users(CHARACTER VARYING, TEXT, TEXT);
+create or replace function axl_data.axl_update_login_users(scope_json TEXT default null) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+begin
+
+    update pg_temp.axl_login_users_tmp
+    set user_pkid = axl_login_users_tmp.cluster_name || '_' || axl_login_users_tmp.user_pkid
+    where user_id = user_id;
+
+    insert into axl_data.axl_login_users (user_pkid, first_name, middle_name, last_name, user_id,
+                                          department,
+                                          status, is_local_user, directory_uri, mail_id, has_uccx, cluster_name,
+                                          access_group, default_team, default_role)
+    SELECT user_pkid,
+           first_name,
+           middle_name,
+           last_name,
+           user_id,
+           department,
+           status,
+           is_local_user,
+           directory_uri,
+           mail_id,
+           has_uccx,
+           cluster_name,
+           access_group,
+           nullif(default_team, ''),
+           nullif(default_role, '')
+    from pg_temp.axl_login_users_tmp
+    where user_pkid not in
+          (select user_pkid from axl_data.axl_login_users);
+
+    update axl_data.axl_login_users
+    set first_name=t.first_name,
+        middle_name=t.middle_name,
+        last_name=t.last_name,
+        user_id=t.user_id,
+        department=t.department,
+        status=t.status,
+        is_local_user=t.is_local_user,
+        directory_uri=t.directory_uri,
+        mail_id=t.mail_id,
+        is_deleted_on_axl= false,
+        has_uccx= t.has_uccx,
+        cluster_name=t.cluster_name,
+        access_group=t.access_group,
+        default_team=nullif(t.default_team, ''),
+        default_role=nullif(t.default_role, ''),
+        date_updated=now()
+    from pg_temp.axl_login_users_tmp t
+    where axl_login_users.user_pkid = t.user_pkid;
+
+    if scope_json is null then
+        delete from axl_data.axl_login_users where date_updated < now()::DATE - INTERVAL '5 days';
+
+        update axl_data.axl_login_users
+        set is_deleted_on_axl= true
+        where (cluster_name is null or cluster_name in (select distinct cluster_name from pg_temp.axl_login_users_tmp))
+          and user_pkid not in
+              (select user_pkid from pg_temp.axl_login_users_tmp);
+    else
+        -- incremental sync, only changed users
+        update axl_data.axl_login_users
+        set is_deleted_on_axl= true
+        where cluster_name = scope_json::json ->> 'cluster_name'
+          and substr(user_pkid, length(cluster_name) + 2) in (select json_array_elements_text(scope_json::json -> 'pkid'))
+          and user_pkid not in
+              (select user_pkid from pg_temp.axl_login_users_tmp);
+    end if;
+
+    return 1;
+end;
+$$;
+comment on function axl_data.axl_update_login_users(scope_json TEXT) is 'Bulk data update for login allowed users from pg_temp.axl_login_users_tmp';
+
+
+/*
+ Position in CUCM change notification queue for incremental sync
+ */
+CREATE TABLE if not exists axl_data.axl_change_cursor
+(
+    cluster_key    varchar(255) primary key,          -- configured cluster name or first AXL node
+    cluster_name   varchar(255),                      -- cluster name used in rows
+    queue_id       varchar(128),                      -- CUCM change queue ID
+    next_change_id bigint    default 0     not null,  -- first not processed change
+    date_updated   timestamp default now() not null
+);
+comment on table axl_data.axl_change_cursor is 'AXL listChange cursor for incremental sync';
+
+create or replace function axl_data.axl_save_change_cursor(key varchar, name varchar, queue varchar, next_id bigint) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+begin
+    update axl_data.axl_change_cursor
+    set cluster_name=name,
+        queue_id=queue,
+        next_change_id=next_id,
+        date_updated=now()
+    where cluster_key = key;
+    if not found then
+        insert into axl_data.axl_change_cursor (cluster_key, cluster_name, queue_id, next_change_id)
+        values (key, name, queue, next_id);
+    end if;
+    return 1;
+end;
+$$;
+comment on function axl_data.axl_save_change_cursor(varchar, varchar, varchar, bigint) is 'Store change cursor after success sync';
+
+
+/*
+ AXL schema version negotiated with cluster, used as first version in next run
+ */
+CREATE TABLE if not exists axl_data.axl_schema_version
+(
+    cluster_key    varchar(255) primary key,         -- configured cluster name or first AXL node
+    schema_version varchar(16)             not null, -- AXL schema version (12.5)
+    cucm_version   varchar(64),                      -- CUCM version from getCCMVersion
+    date_updated   timestamp default now() not null
+);
+comment on table axl_data.axl_schema_version is 'Detected AXL schema version of clusters';
+
+create or replace function axl_data.axl_save_schema_version(key varchar, schema varchar, cucm varchar) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+begin
+    update axl_data.axl_schema_version
+    set schema_version=schema,
+        cucm_version=cucm,
+        date_updated=now()
+    where cluster_key = key;
+    if not found then
+        insert into axl_data.axl_schema_version (cluster_key, schema_version, cucm_version)
+        values (key, schema, cucm);
+    end if;
+    return 1;
+end;
+$$;
+comment on function axl_data.axl_save_schema_version(varchar, varchar, varchar) is 'Store detected AXL schema version';
+
+
+/*
+ Help function for fix maximal string len
+ */
+create or replace function axl_data.fix_varchar_len(source character varying, maxlen integer) returns character varying
+    language plpgsql
+as
+$$
+BEGIN
+    IF length(source) <= maxlen THEN RETURN source; END IF;
+    RETURN left(source, maxlen);
+END;
+$$;
+comment on function axl_data.fix_varchar_len(varchar, integer) is 'Change max len of varchar to defined value';
+
+
+/*
+ Map department to team by team mapping JSON [{"department": "Sales", "regex": false, "team": "Sales team"}].
+ Rules are used in configured order, first match is used. Regex rule is PostgreSQL regular expression (ARE)
+ matched case insensitive, plain rule is compared case insensitive. Null when no rule match.
+ */
+create or replace function axl_data.axl_map_team(department varchar, team_json text) returns varchar
+    language plpgsql
+    stable
+as
+$$
+BEGIN
+    RETURN (select axl_data.fix_varchar_len(r.v ->> 'team', 50)
+            from json_array_elements(coalesce(team_json, '[]')::json) with ordinality r(v, ord)
+            where (coalesce((r.v ->> 'regex')::bool, false) and coalesce(department, '') ~* (r.v ->> 'department'))
+               or (not coalesce((r.v ->> 'regex')::bool, false) and
+                   lower(coalesce(department, '')) = lower(r.v ->> 'department'))
+            order by r.ord
+            limit 1);
+END;
+$$;
+comment on function axl_data.axl_map_team(varchar, text) is 'Map department to QM team by team mapping rules';
+
+
+/*
+ QM team assigned by importer, used for move user when department mapping changed.
+ User is moved only when mapped_team changed, team can differ for users imported before team mapping.
+ */
+CREATE TABLE if not exists axl_data.axl_user_team
+(
+    agentid      varchar(128) primary key,         -- user_pkid, agentid in wbsc.sc_users
+    team         varchar(50)             not null, -- team name assigned by importer
+    mapped_team  varchar(50)             not null, -- last result of department mapping
+    date_updated timestamp default now() not null
+);
+comment on table axl_data.axl_user_team is 'QM team assigned to user by department mapping';
+
+/*
+ Membership of users in CUCM access control groups used for role mapping
+ */
+CREATE TABLE if not exists axl_data.axl_user_groups
+(
+    user_pkid    varchar(128)            not null, -- cluster_name || '_' || AXL pkid from enduser table
+    group_name   varchar(128)            not null, -- access control group (dirgroup) name
+    cluster_name varchar(255),                     -- CUCM cluster, part of row identity
+    date_updated timestamp default now() not null
+);
+comment on table axl_data.axl_user_groups is 'Access control group membership for role mapping';
+
+create index if not exists axl_user_groups_user_pkid_index
+    on axl_data.axl_user_groups (user_pkid);
+
+/*
+ Replace group membership of clusters read in full import (clusters_json is JSON array of cluster names)
+ or of changed users in incremental sync
+ */
+create or replace function axl_data.axl_update_user_groups(json_data TEXT,
+                                                           clusters_json TEXT,
+                                                           scope_json TEXT default null) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+begin
+    drop table if exists tmp_axl_user_groups;
+    create TEMP table tmp_axl_user_groups as
+    select distinct (j.v ->> 'cluster_name') || '_' || (j.v ->> 'user_pkid') as user_pkid,
+                    (j.v ->> 'groupname')::varchar                          as group_name,
+                    (j.v ->> 'cluster_name')::varchar                       as cluster_name
+    from json_array_elements(json_data::json) j(v);
+
+    if scope_json is null then
+        delete
+        from axl_data.axl_user_groups
+        where cluster_name in (select json_array_elements_text(coalesce(clusters_json, '[]')::json));
+    else
+        -- incremental sync, only changed users
+        delete
+        from axl_data.axl_user_groups
+        where cluster_name = scope_json::json ->> 'cluster_name'
+          and substr(user_pkid, length(cluster_name) + 2) in (select json_array_elements_text(scope_json::json -> 'pkid'));
+    end if;
+
+    insert into axl_data.axl_user_groups (user_pkid, group_name, cluster_name)
+    select user_pkid, group_name, cluster_name
+    from tmp_axl_user_groups;
+
+    drop table if exists tmp_axl_user_groups;
+    return 1;
+end;
+$$;
+comment on function axl_data.axl_update_user_groups(json_data TEXT, clusters_json TEXT, scope_json TEXT) is 'Bulk update of access control group membership';
+
+/*
+ QM role assigned by importer, used for change role when group membership changed
+ */
+CREATE TABLE if not exists axl_data.axl_user_role
+(
+    agentid      varchar(128) primary key,         -- user_pkid, agentid in wbsc.sc_users
+    role         varchar(255)            not null, -- role name assigned by importer
+    date_updated timestamp default now() not null
+);
+comment on table axl_data.axl_user_role is 'QM role assigned to user by access control group mapping';
+
+/*
+ Update QM users based on AXL data.
+ Team mapping is JSON array [{"department": "Sales", "regex": false, "team": "Sales team"}], first match is used.
+ Role mapping is JSON array [{"group": "QM Supervisors", "role": "Supervisor"}], first group of user is used.
+ Fallback is team and role of access control group used for login, then default_team and default_role.
+ */
+drop function if exists axl_data.axl_update_qm(varchar, varchar);
+drop function if exists axl_data.axl_update_qm(varchar, varchar, text, bool);
+create or replace function axl_data.axl_update_qm(default_team varchar(50), default_role varchar(255),
+                                                  team_json TEXT default null, move_team bool default false,
+                                                  role_json TEXT default null)
+    RETURNS table
+            (
+                operation varchar,
+                user_name varchar
+            )
+    LANGUAGE plpgsql
+AS
+$$
+declare
+    var_r record;
+begin
+    -- temp table with messages
+    drop table if exists message;
+    create TEMP table message
+    (
+        operation varchar,
+        user_name varchar
+    );
+
+    -- create tem table
+    drop table if exists tmp_axl_users;
+    create TEMP table tmp_axl_users
+    (
+        name               varchar(64),                     --first_name
+        surname            varchar(64),                     -- last_name
+        login              varchar(144) unique,             -- user_id
+        database           int          default 4,
+        sync               bool         default false,
+        has_uccx           bool         default false,
+        status             varchar(50)  default 'INACTIVE', -- ACTIVE,INACTIVE,DELETED, alternative BLOCKED
+        phone              varchar(64)  default null,       -- line_number
+        agentid            varchar(128),                    --user_pkid
+        identificator_used varchar(50)  default 'EXTERNAL_AGENT_ID',
+        language           int          default 1,
+        company            int          default 1,
+        external_id        varchar(255) default null,
+        daemon             bool         default false,
+        email              varchar(255),
+        department         varchar(64),
+        team               varchar(50),
+        role               varchar(255),
+        group_team         varchar(50),                     -- default team of access group
+        group_role         varchar(255)                     -- default role of access group
+    );
+
+    -- user for mapping
+    insert into tmp_axl_users(name, surname, login, agentid, email, has_uccx, department)
+    select a.first_name,
+           a.last_name,
+           a.user_id,
+           a.user_pkid,
+           user_mail,
+           has_uccx,
+           department
+    from (select user_pkid,
+                 u.user_id,
+                 first_name,
+                 last_name,
+                 is_deleted_on_axl,
+                 case when mail_id is null then directory_uri else mail_id end user_mail,
+                 has_uccx,
+                 max(department) as department
+          from axl_data.axl_users u
+          group by user_pkid, u.user_id, first_name, last_name, is_deleted_on_axl,
+                   case when mail_id is null then directory_uri else mail_id end, has_uccx) a
+    where a.is_deleted_on_axl = false;
+
+    -- user for login
+    insert into tmp_axl_users(name, surname, login, agentid, email, status, has_uccx, department)
+    select a.first_name,
+           a.last_name,
+           a.user_id,
+           a.user_pkid,
+           user_mail,
+           'ACTIVE',
+           has_uccx,
+           department
+    from (select user_pkid,
+                 u.user_id,
+                 first_name,
+                 last_name,
+                 is_deleted_on_axl,
+                 case when mail_id is null then directory_uri else mail_id end user_mail,
+                 has_uccx,
+                 max(department) as department
+          from axl_data.axl_login_users u
+          group by user_pkid, u.user_id, first_name, last_name, is_deleted_on_axl,
+                   case when mail_id is null then directory_uri else mail_id end, has_uccx) a
+    where a.is_deleted_on_axl = false
+      and user_pkid not in (select user_pkid
+                            from axl_data.axl_users
+                            where is_deleted_on_axl = false);
+
+    -- update mapping for login too
+    update tmp_axl_users
+    set status='ACTIVE'
+    from axl_data.axl_login_users
+    where tmp_axl_users.agentid = axl_data.axl_login_users.user_pkid
+      and axl_data.axl_login_users.is_deleted_on_axl = false;
+
+    -- defaults of access control group used for login
+    update tmp_axl_users
+    set group_team=l.default_team,
+        group_role=l.default_role
+    from axl_data.axl_login_users l
+    where tmp_axl_users.agentid = l.user_pkid
+      and l.is_deleted_on_axl = false;
+
+    -- team mapping rules in configured order, first match is used
+    update tmp_axl_users u
+    set team = coalesce(axl_data.axl_map_team(u.department, team_json), u.group_team, default_team);
+
+    -- create missing teams
+    insert into message (operation, user_name)
+    select 'TEAM'::varchar, t.team::varchar
+    from (select distinct team from tmp_axl_users) t
+    where t.team not in (select ccgroupname from wbsc.ccgroups where ccgroupname is not null);
+
+    insert into wbsc.ccgroups (ccgroupname)
+    select t.team
+    from (select distinct team from tmp_axl_users) t
+    where t.team not in (select ccgroupname from wbsc.ccgroups where ccgroupname is not null);
+
+    -- role mapping rules in configured order, first group has highest priority
+    drop table if exists tmp_role_rules;
+    create TEMP table tmp_role_rules as
+    select r.ord,
+           lower(r.v ->> 'group') as group_name,
+           r.v ->> 'role'         as role
+    from json_array_elements(coalesce(role_json, '[]')::json) with ordinality r(v, ord);
+
+    update tmp_axl_users u
+    set role = coalesce((select r.role
+                         from tmp_role_rules r
+                                  join axl_data.axl_user_groups g on lower(g.group_name) = r.group_name
+                         where g.user_pkid = u.agentid
+                         order by r.ord
+                         limit 1), u.group_role, default_role);
+
+    -- not existing role is reported and replaced by default role
+    insert into message (operation, user_name)
+    select distinct 'NOROLE'::varchar, t.role::varchar
+    from tmp_axl_users t
+    where t.role not in (select name from wbsc.roles where name is not null);
+
+    update tmp_axl_users
+    set role = default_role
+    where role not in (select name from wbsc.roles where name is not null);
+
+    RAISE NOTICE 'Finish prepare temp users table';
+
+    -- mark delete users from AXL
+    insert into message (operation, user_name)
+    select 'DELETE'::varchar, login:: varchar
+    from wbsc.sc_users
+    where agentid not in
+          (select agentid from tmp_axl_users where has_uccx = false)
+      and status <> 'DELETED'
+      and database = 4
+      and external_id is null;
+
+    update wbsc.sc_users
+    set status='DELETED',
+        deleted_ts=now(),
+        login = axl_data.fix_varchar_len(login || '_exp_' || floor(extract(epoch from now()))::text, 50)
+    where agentid not in
+          (select agentid from tmp_axl_users where has_uccx = false)
+      and status <> 'DELETED'
+      and database = 4
+      and external_id is null;
+    RAISE NOTICE 'Finish delete users';
+
+
+    -- fix name for deleted from ccx importer
+    insert into message (operation, user_name)
+    select 'DELETE other'::varchar, login:: varchar
+    from wbsc.sc_users
+    where lower(login) in (select lower(login) from tmp_axl_users where has_uccx = false)
+      and status <> 'DELETED'
+      and database = 4
+      and external_id is not null
+      and login ~ '.*_ccx_\d+$';
+
+    update wbsc.sc_users
+    set deleted_ts=now(),
+        login     = axl_data.fix_varchar_len(login || '_ccx_' || floor(extract(epoch from now()))::text, 50)
+    where lower(login) in (select lower(login) from tmp_axl_users where has_uccx = false)
+      and status = 'DELETED'
+      and database = 4
+      and external_id is not null;
+    RAISE NOTICE 'Finish delete other users';
+
+
+    -- insert new users and password
+    insert into message (operation, user_name)
+    select 'ADD'::varchar, a.login::varchar
+    from (select agentid, login from tmp_axl_users u where has_uccx = false) a
+    where a.agentid not in (select agentid from wbsc.sc_users where agentid is not null)
+      and lower(a.login) not in (select lower(login) from wbsc.sc_users);
+
+    insert into wbsc.sc_users (name, surname, login, database, sync, status, phone, agentid, identificator_used,
+                               language, company, external_id, daemon, email)
+    select name,
+           surname,
+           login,
+           database,
+           sync,
+           status,
+           phone,
+           agentid,
+           identificator_used,
+           language,
+           company,
+           external_id,
+           daemon,
+           email
+    from tmp_axl_users a
+    where a.agentid not in (select agentid from wbsc.sc_users where agentid is not null)
+      and lower(a.login) not in (select lower(login) from wbsc.sc_users)
+      and has_uccx = false;
+
+    RAISE NOTICE 'Finish insert new users';
+
+    -- add new user to mapped role
+    INSERT INTO axl_data.axl_user_role (agentid, role)
+    SELECT s.agentid, t.role
+    from wbsc.sc_users s
+             join tmp_axl_users t on t.agentid = s.agentid
+    where s.userid not in (select userid from wbsc.user_role)
+      and s.agentid not in (select agentid from axl_data.axl_user_role)
+      and t.role in (select name from wbsc.roles);
+
+    INSERT INTO wbsc.user_role (userid, roleid)
+    SELECT s.userid, (select min(roleid) from wbsc.roles where name = t.role)
+    from wbsc.sc_users s
+             join tmp_axl_users t on t.agentid = s.agentid
+    where s.userid not in (select userid from wbsc.user_role)
+      and t.role in (select name from wbsc.roles);
+    RAISE NOTICE 'Finish insert role for new users';
+
+    -- add new user to mapped team
+    INSERT INTO axl_data.axl_user_team (agentid, team, mapped_team)
+    SELECT s.agentid, t.team, t.team
+    from wbsc.sc_users s
+             join tmp_axl_users t on t.agentid = s.agentid
+    where s.userid not in (select userid from wbsc.user_belongsto_ccgroup)
+      and s.agentid not in (select agentid from axl_data.axl_user_team);
+
+    INSERT INTO wbsc.user_belongsto_ccgroup (ccgroupid, userid)
+    SELECT (select min(ccgroupid) from wbsc.ccgroups where ccgroupname = t.team), s.userid
+    from wbsc.sc_users s
+             join tmp_axl_users t on t.agentid = s.agentid
+    where s.userid not in (select userid from wbsc.user_belongsto_ccgroup);
+    RAISE NOTICE 'Finish insert group for new users';
+
+    -- users imported before team mapping keep actual team, default team preferred when user is in more teams.
+    -- Actual mapping result is stored, user is moved only when mapping result changed later
+    INSERT INTO axl_data.axl_user_team (agentid, team, mapped_team)
+    SELECT t.agentid,
+           coalesce((select g.ccgroupname
+                     from wbsc.sc_users s
+                              join wbsc.user_belongsto_ccgroup b on b.userid = s.userid
+                              join wbsc.ccgroups g on g.ccgroupid = b.ccgroupid
+                     where s.agentid = t.agentid
+                       and g.ccgroupname is not null
+                     order by (g.ccgroupname = default_team) desc, g.ccgroupname
+                     limit 1), default_team),
+           t.team
+    from tmp_axl_users t
+    where t.agentid not in (select agentid from axl_data.axl_user_team);
+
+    -- users imported before role mapping got default role
+    INSERT INTO axl_data.axl_user_role (agentid, role)
+    SELECT t.agentid, default_role
+    from tmp_axl_users t
+    where t.agentid not in (select agentid from axl_data.axl_user_role);
+
+    -- change role assigned by importer when group membership changed, other roles of user stay
+    insert into message (operation, user_name)
+    select 'ROLE'::varchar, (t.login || ': ' || ur.role || ' -> ' || t.role)::varchar
+    from tmp_axl_users t
+             join axl_data.axl_user_role ur on ur.agentid = t.agentid
+    where ur.role <> t.role;
+
+    delete
+    from wbsc.user_role r
+        using wbsc.sc_users s, tmp_axl_users t, axl_data.axl_user_role ur, wbsc.roles ro
+    where r.userid = s.userid
+      and s.agentid = t.agentid
+      and ur.agentid = t.agentid
+      and ur.role <> t.role
+      and ro.roleid = r.roleid
+      and ro.name = ur.role;
+
+    INSERT INTO wbsc.user_role (userid, roleid)
+    SELECT s.userid, (select min(roleid) from wbsc.roles where name = t.role)
+    from wbsc.sc_users s
+             join tmp_axl_users t on t.agentid = s.agentid
+             join axl_data.axl_user_role ur on ur.agentid = t.agentid
+    where ur.role <> t.role
+      and s.userid not in (select r.userid
+                           from wbsc.user_role r
+                                    join wbsc.roles ro on ro.roleid = r.roleid
+                           where ro.name = t.role);
+
+    update axl_data.axl_user_role ur
+    set role=t.role,
+        date_updated=now()
+    from tmp_axl_users t
+    where ur.agentid = t.agentid
+      and ur.role <> t.role;
+    RAISE NOTICE 'Finish update role of users';
+
+    -- move user to new team when department mapping changed, manual team changes are kept until next change
+    if move_team then
+        insert into message (operation, user_name)
+        select 'MOVE'::varchar, (t.login || ': ' || ut.team || ' -> ' || t.team)::varchar
+        from tmp_axl_users t
+                 join axl_data.axl_user_team ut on ut.agentid = t.agentid
+        where ut.mapped_team <> t.team
+          and ut.team <> t.team;
+
+        delete
+        from wbsc.user_belongsto_ccgroup b
+            using wbsc.sc_users s, tmp_axl_users t, axl_data.axl_user_team ut, wbsc.ccgroups g
+        where b.userid = s.userid
+          and s.agentid = t.agentid
+          and ut.agentid = t.agentid
+          and ut.mapped_team <> t.team
+          and ut.team <> t.team
+          and g.ccgroupid = b.ccgroupid
+          and g.ccgroupname = ut.team;
+
+        INSERT INTO wbsc.user_belongsto_ccgroup (ccgroupid, userid)
+        SELECT (select min(ccgroupid) from wbsc.ccgroups where ccgroupname = t.team), s.userid
+        from wbsc.sc_users s
+                 join tmp_axl_users t on t.agentid = s.agentid
+                 join axl_data.axl_user_team ut on ut.agentid = t.agentid
+        where ut.mapped_team <> t.team
+          and s.userid not in (select b.userid
+                               from wbsc.user_belongsto_ccgroup b
+                                        join wbsc.ccgroups g on g.ccgroupid = b.ccgroupid
+                               where g.ccgroupname = t.team);
+
+        update axl_data.axl_user_team ut
+        set team=t.team,
+            mapped_team=t.team,
+            date_updated=now()
+        from tmp_axl_users t
+        where ut.agentid = t.agentid
+          and ut.mapped_team <> t.team;
+        RAISE NOTICE 'Finish move users to mapped team';
+    end if;
+
+    -- without move only mapping result is stored, later enabled moveTeam not move users for older changes
+    update axl_data.axl_user_team ut
+    set mapped_team=t.team,
+        date_updated=now()
+    from tmp_axl_users t
+    where ut.agentid = t.agentid
+      and ut.mapped_team <> t.team;
+
+    -- update back wbsc_id
+    update axl_data.axl_users
+    set wbsc_id = s.userid
+    from wbsc.sc_users s
+    where wbsc_id = 0
+      and s.agentid = user_pkid;
+
+    update axl_data.axl_login_users
+    set wbsc_id = s.userid
+    from wbsc.sc_users s
+    where wbsc_id = 0
+      and s.agentid = user_pkid;
+
+    RAISE NOTICE 'Finish update back axl_data';
+
+    -- Update exist QM not delete record if some different
+    insert into message (operation, user_name)
+    select 'UPDATE'::varchar, a.login::varchar
+    from (select agentid,
+                 u.login,
+                 name,
+                 surname,
+                 email,
+                 status
+          from tmp_axl_users u
+          where has_uccx = false) a,
+         wbsc.sc_users s
+    where s.agentid = a.agentid
+      and a.login not in (select login from wbsc.sc_users where agentid <> a.agentid)
+      and (
+            s.name != a.name or
+            s.surname != a.surname or
+            s.login != a.login or
+            coalesce(s.email, '') != coalesce(a.email, '') or
+            s.status != a.status
+        );
+
+    insert into message (operation, user_name)
+    select 'PROBLEM'::varchar, a.login::varchar
+    from (select agentid,
+                 u.login,
+                 name,
+                 surname,
+                 email,
+                 status
+          from tmp_axl_users u
+          where has_uccx = false) a,
+         wbsc.sc_users s
+    where s.agentid = a.agentid
+      and a.agentid in (select login from wbsc.sc_users where agentid <> a.agentid)
+      and (
+            s.name != a.name or
+            s.surname != a.surname or
+            s.login != a.login or
+            coalesce(s.email, '') != coalesce(a.email, '') or
+            s.status != a.status
+        );
+
+    update wbsc.sc_users
+    set name=a.name,
+        surname=a.surname,
+        login=a.login,
+        email=a.email,
+        status=a.status
+    from (select agentid,
+                 u.login,
+                 name,
+                 surname,
+                 email,
+                 status
+          from tmp_axl_users u
+          where has_uccx = false) a
+    where wbsc.sc_users.agentid = a.agentid
+      and a.agentid not in (select login from wbsc.sc_users where agentid <> a.agentid)
+      and (
+            wbsc.sc_users.name != a.name or
+            wbsc.sc_users.surname != a.surname or
+            wbsc.sc_users.login != a.login or
+            coalesce(wbsc.sc_users.email, '') != coalesce(a.email, '') or
+            wbsc.sc_users.status != a.status
+        );
+
+    RAISE NOTICE 'Finish update users';
+    drop table if exists tmp_axl_users;
+    drop table if exists tmp_role_rules;
+
+    for var_r IN (select message.operation, message.user_name from message)
+        LOOP
+            operation := var_r.operation;
+            user_name := var_r.user_name;
+            return next;
+        end loop;
+    drop table message;
+end;
+$$;
+comment on function axl_data.axl_update_qm(varchar, varchar, text, bool, text) is 'Update QM users based on AXL data';
+
+
+/*
+ Extension Mobility logins on physical devices, open session has logout_time null
+ */
+CREATE TABLE if not exists axl_data.axl_em_sessions
+(
+    device_name  varchar(130)            not null, -- physical device name, JTAPI terminal
+    user_pkid    varchar(128)            not null, -- cluster_name || '_' || AXL pkid from enduser table
+    user_id      varchar(144),
+    profile_name varchar(130),                     -- device profile (UDP) used for login
+    cluster_name varchar(255),
+    login_time   timestamp               not null, -- login time from CUCM
+    logout_time  timestamp default null,           -- first poll without login, null for actual login
+    date_updated timestamp default now() not null
+);
+comment on table axl_data.axl_em_sessions is 'Extension Mobility login history for couple update';
+
+create index if not exists axl_em_sessions_device_name_index
+    on axl_data.axl_em_sessions (device_name);
+
+/*
+ Store actual Extension Mobility logins (json_data), open sessions without login are closed.
+ Sessions are closed only for clusters in clusters_json (JSON array of cluster names), null close all clusters.
+ Return number of new and closed sessions.
+ */
+create or replace function axl_data.axl_update_em_sessions(json_data TEXT,
+                                                           clusters_json TEXT default null) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+declare
+    closed   int;
+    inserted int;
+begin
+    drop table if exists tmp_axl_em_sessions;
+    create TEMP table tmp_axl_em_sessions as
+    select distinct (j.v ->> 'devicename')::varchar                                 as device_name,
+                    (j.v ->> 'cluster_name') || '_' || (j.v ->> 'user_pkid')        as user_pkid,
+                    (j.v ->> 'userid')::varchar                                     as user_id,
+                    nullif(j.v ->> 'profilename', '')::varchar                      as profile_name,
+                    (j.v ->> 'cluster_name')::varchar                               as cluster_name,
+                    coalesce(to_timestamp(nullif((j.v ->> 'logintime')::bigint, 0))::timestamp,
+                             now()::timestamp)                                      as login_time
+    from json_array_elements(json_data::json) j(v);
+
+    update axl_data.axl_em_sessions s
+    set logout_time=now(),
+        date_updated=now()
+    where s.logout_time is null
+      and (clusters_json is null or s.cluster_name in (select json_array_elements_text(clusters_json::json)))
+      and not exists(select 1
+                     from tmp_axl_em_sessions t
+                     where t.device_name = s.device_name
+                       and t.user_pkid = s.user_pkid);
+    GET DIAGNOSTICS closed = ROW_COUNT;
+
+    insert into axl_data.axl_em_sessions (device_name, user_pkid, user_id, profile_name, cluster_name, login_time)
+    select t.device_name, t.user_pkid, t.user_id, t.profile_name, t.cluster_name, t.login_time
+    from tmp_axl_em_sessions t
+    where not exists(select 1
+                     from axl_data.axl_em_sessions s
+                     where s.logout_time is null
+                       and s.device_name = t.device_name
+                       and s.user_pkid = t.user_pkid);
+    GET DIAGNOSTICS inserted = ROW_COUNT;
+
+    -- history is necessary only for couples in couple update
+    delete from axl_data.axl_em_sessions where logout_time < now() - INTERVAL '30 days';
+
+    drop table if exists tmp_axl_em_sessions;
+    return closed + inserted;
+end;
+$$;
+comment on function axl_data.axl_update_em_sessions(json_data TEXT, clusters_json TEXT) is 'Update Extension Mobility login history';
+
+/*
+ Duplicate association report, every full import is new run
+ */
+CREATE TABLE if not exists axl_data.axl_duplicate_runs
+(
+    run_id     serial primary key,
+    run_time   timestamp default now() not null,
+    duplicates int       default 0     not null -- number of devices and lines associated to more users
+);
+comment on table axl_data.axl_duplicate_runs is 'Full imports with duplicate report';
+
+CREATE TABLE if not exists axl_data.axl_duplicates
+(
+    run_id      int          not null references axl_data.axl_duplicate_runs (run_id) on delete cascade,
+    object_type varchar(10)  not null, -- device or line
+    name        varchar(256) not null, -- device name or line DN with partition
+    description varchar(512),
+    device_type varchar(20),           -- device type, null for line
+    user_ids    text,                  -- conflicting CUCM user IDs
+    winner      varchar(144),          -- user ID keeping device or line, null when removed
+    reason      varchar(50)            -- policy selected winner or removed
+);
+comment on table axl_data.axl_duplicates is 'Devices and lines associated to more users';
+
+create index if not exists axl_duplicates_run_id_index
+    on axl_data.axl_duplicates (run_id);
+
+/*
+ Store duplicate report (json_data) as new run and return run ID, runs older than 30 days are deleted
+ */
+create or replace function axl_data.axl_save_duplicates(json_data TEXT) RETURNS INT
+    LANGUAGE plpgsql AS
+$$
+declare
+    run int;
+begin
+    insert into axl_data.axl_duplicate_runs (duplicates)
+    values (json_array_length(json_data::json))
+    returning run_id into run;
+
+    insert into axl_data.axl_duplicates (run_id, object_type, name, description, device_type, user_ids, winner, reason)
+    select run,
+           (j.v ->> 'object_type')::varchar,
+           axl_data.fix_varchar_len(j.v ->> 'name', 256),
+           axl_data.fix_varchar_len(j.v ->> 'description', 512),
+           nullif(j.v ->> 'device_type', '')::varchar,
+           (j.v ->> 'user_ids')::text,
+           nullif(j.v ->> 'winner', '')::varchar,
+           (j.v ->> 'reason')::varchar
+    from json_array_elements(json_data::json) j(v);
+
+    delete from axl_data.axl_duplicate_runs where run_time < now() - INTERVAL '30 days' and run_id != run;
+    return run;
+end;
+$$;
+comment on function axl_data.axl_save_duplicates(json_data TEXT) is 'Store duplicate association report';
+
+/*
+  Create and fill table for last couple update
+ */
+create table if not exists axl_data.couple_last_update
+(
+    id                    int unique,
+    last_process          timestamp default now(),
+    last_couple_update_ts timestamp default now() - '10 months'::INTERVAL
+);
+comment on table axl_data.couple_last_update is 'Hold last update ';
+
+insert into axl_data.couple_last_update (id)
+VALUES (1)
+on conflict (id) do nothing;
+
+/*
+  Update calls add agentid from sc_user base on device name and days back
+ */
+create or replace function axl_data.axl_update_couples_by_device(hours_back int, set_direction bool)
+    RETURNS table
+            (
+                operation   varchar,
+                description varchar
+            )
+    LANGUAGE plpgsql
+AS
+$$
+declare
+    var_r    record;
+    cnt      int;
+    last_cnt int;
+    last_ts  timestamp;
+begin
+    -- message table
+    drop table if exists couple_message;
+    create TEMP table couple_message
+    (
+        operation   varchar,
+        description varchar
+    );
+    insert into couple_message (operation, description)
+    values ('START'::varchar, to_char(now(), 'YYYY-MM-DD HH24:MI:SS TZ'));
+
+    -- validate last update table
+    select count(1) into cnt from axl_data.couple_last_update where id = 1;
+    if cnt < 1 then
+        insert into axl_data.couple_last_update (id, last_couple_update_ts)
+        VALUES (1, now() - 2 * hours_back * '1 hours'::INTERVAL);
+    end if;
+
+    -- temp table for hold necessary data
+    drop table if exists couple_new_id_tmp;
+    create temp table couple_new_id_tmp
+    (
+        id               integer unique,
+        calling_agent    varchar(255),
+        called_agent     varchar(255),
+        calling_terminal varchar(255) default null,
+        called_terminal  varchar(255) default null,
+        couple_created   timestamp,
+        couple_updated   timestamp,
+        new_direction    varchar(25)
+    );
+    insert into couple_new_id_tmp (id, calling_agent, called_agent, couple_created, couple_updated, new_direction)
+    select id, callingagent, calledagent, created_ts, updated_ts, direction
+    from callrec.couples c
+    where updated_ts >= (select last_couple_update_ts from axl_data.couple_last_update where id = 1 LIMIT 1)
+      and created_ts >= now() - hours_back * '1 hours'::INTERVAL
+      and (callingagent is null or calledagent is null);
+
+    -- Add JTAPI names
+    update couple_new_id_tmp
+    set calling_terminal=value
+    from callrec.couple_extdata
+    where key = 'JTAPI_CALLING_TERMINAL_SEP'
+      and id = cplid;
+
+    update couple_new_id_tmp
+    set called_terminal=value
+    from callrec.couple_extdata
+    where key = 'JTAPI_CALLED_TERMINAL_SEP'
+      and id = cplid;
+
+    select count(1) into cnt from couple_new_id_tmp;
+    insert into couple_message (operation, description)
+    values ('PREPARE', '' || cast(cnt as varchar(15)));
+
+    -- update agents
+    update couple_new_id_tmp
+    set calling_agent=axl_data.axl_user_device_view.user_pkid
+    from axl_data.axl_user_device_view
+    where calling_terminal = axl_data.axl_user_device_view.device_name;
+
+    update couple_new_id_tmp
+    set called_agent=axl_data.axl_user_device_view.user_pkid
+    from axl_data.axl_user_device_view
+    where called_terminal = axl_data.axl_user_device_view.device_name;
+
+    -- Extension Mobility, user logged on physical device when couple was created replace device user
+    update couple_new_id_tmp c
+    set calling_agent=s.user_pkid
+    from axl_data.axl_em_sessions s
+    where c.calling_terminal = s.device_name
+      and c.couple_created >= s.login_time
+      and (s.logout_time is null or c.couple_created < s.logout_time)
+      and s.user_pkid in (select user_pkid from axl_data.axl_user_device_view);
+    GET DIAGNOSTICS cnt = ROW_COUNT;
+
+    update couple_new_id_tmp c
+    set called_agent=s.user_pkid
+    from axl_data.axl_em_sessions s
+    where c.called_terminal = s.device_name
+      and c.couple_created >= s.login_time
+      and (s.logout_time is null or c.couple_created < s.logout_time)
+      and s.user_pkid in (select user_pkid from axl_data.axl_user_device_view);
+    GET DIAGNOSTICS last_cnt = ROW_COUNT;
+
+    insert into couple_message (operation, description)
+    values ('EM', '' || cast(cnt + last_cnt as varchar(15)));
+
+    if set_direction then
+        begin
+            update couple_new_id_tmp
+            set new_direction = case
+                                    when calling_agent is not null and called_agent is not null then 'INTERNAL'::varchar
+                                    when calling_agent is null and called_agent is not null then 'INCOMING'::varchar
+                                    when calling_agent is not null and called_agent is null then 'OUTGOING'::varchar
+                                    else new_direction end
+            where calling_agent is not null
+               or called_agent is not null;
+        end;
+    end if;
+
+    select count(1)
+    into cnt
+    from (
+             select 1
+             from callrec.couples cc
+                      inner join couple_new_id_tmp c
+                                 on cc.id = c.id
+                                     and not (coalesce(cc.calledagent, '') = coalesce(c.called_agent, '') and
+                                              coalesce(cc.callingagent, '') = coalesce(c.calling_agent, '') and
+                                              direction = new_direction
+                                         )
+         ) a;
+
+    insert into couple_message (operation, description)
+    values ('UPDATE', '' || cast(cnt as varchar(15)));
+
+    update callrec.couples
+    set calledagent=called_agent,
+        callingagent=calling_agent,
+        direction=new_direction
+    from couple_new_id_tmp c
+    where callrec.couples.id = c.id
+      and not (coalesce(calledagent, '') = coalesce(c.called_agent, '') and
+               coalesce(callingagent, '') = coalesce(c.calling_agent, '') and
+               direction = c.new_direction
+        );
+
+    select max(couple_updated) into last_ts from couple_new_id_tmp;
+    if last_ts is null then
+        select now() - hours_back * '1 hours'::INTERVAL into last_ts;
+    end if;
+    update axl_data.couple_last_update
+    set last_process=now(),
+        last_couple_update_ts=last_ts
+    where id = 1;
+
+    insert into couple_message (operation, description)
+    values ('LAST', '' || to_char(last_ts, 'YYYY-MM-DD HH24:MI:SS TZ'));
+    drop table if exists couple_new_id_tmp;
+
+    RAISE NOTICE 'Finish update couples';
+    for var_r IN (select couple_message.operation, couple_message.description from couple_message)
+        LOOP
+            operation := var_r.operation;
+            description := var_r.description;
+            return next;
+        end loop;
+--     return QUERY (select couple_message.operation, couple_message.description from couple_message);
+    drop table couple_message;
+
+end;
+$$;
+comment on function axl_data.axl_update_couples_by_device(hours_back int, set_direction bool) is 'Update CallREC couples based on axl_user devices';
+
+
+/*
+  Update calls add agentid from sc_user base on line and days back
+ */
+create or replace function axl_data.axl_update_couples_by_line(hours_back int, set_direction bool)
+    RETURNS table
+            (
+                operation   varchar,
+                description varchar
+            )
+    LANGUAGE plpgsql
+AS
+$$
+declare
+    var_r   record;
+    cnt     int;
+    last_ts timestamp;
+begin
+    -- message table
+    drop table if exists couple_message;
+    create TEMp table couple_message
+    (
+        operation   varchar,
+        description varchar
+    );
+    insert into couple_message (operation, description)
+    values ('START'::varchar, to_char(now(), 'YYYY-MM-DD HH24:MI:SS TZ'));
+
+    -- validate last update table
+    select count(1) into cnt from axl_data.couple_last_update where id = 2;
+    if cnt < 1 then
+        insert into axl_data.couple_last_update (id, last_couple_update_ts)
+        VALUES (2, now() - 2 * hours_back * '1 hours'::INTERVAL);
+    end if;
+
+    -- temp table for hold necessary data
+    drop table if exists couple_new_id_tmp;
+    create temp table couple_new_id_tmp
+    (
+        id             integer unique,
+        calling_agent  varchar(255),
+        called_agent   varchar(255),
+        calling_dn       varchar(255) default null,
+        called_dn        varchar(255) default null,
+        calling_terminal varchar(255) default null,
+        called_terminal  varchar(255) default null,
+        couple_updated   timestamp,
+        new_direction    varchar(25)
+    );
+    insert into couple_new_id_tmp (id, calling_agent, called_agent, calling_dn, called_dn, couple_updated,
+                                   new_direction)
+    select id, callingagent, calledagent, callingnr, originalcallednr, updated_ts, direction
+    from callrec.couples
+    where updated_ts >= (select last_couple_update_ts from axl_data.couple_last_update where id = 2 LIMIT 1)
+      and created_ts >= now() - hours_back * '1 hours'::INTERVAL
+      and (callingagent is null or calledagent is null);
+
+    select count(1) into cnt from couple_new_id_tmp;
+    insert into couple_message (operation, description)
+    values ('PREPARE', '' || cast(cnt as varchar(15)));
+
+    -- DN of one user, partition is not important
+    drop table if exists line_unique_tmp;
+    create temp table line_unique_tmp as
+    select line_number, min(user_pkid) as user_pkid
+    from axl_data.axl_user_line_view
+    group by line_number
+    having count(distinct user_pkid) = 1;
+
+    -- add agent connection
+    update couple_new_id_tmp
+    set calling_agent=l.user_pkid
+    from line_unique_tmp l
+    where calling_dn = l.line_number;
+
+    update couple_new_id_tmp
+    set called_agent=l.user_pkid
+    from line_unique_tmp l
+    where called_dn = l.line_number;
+
+    -- same DN in more partitions, line (DN, partition) is identified by JTAPI terminal with the line
+    update couple_new_id_tmp
+    set calling_terminal=value
+    from callrec.couple_extdata
+    where key = 'JTAPI_CALLING_TERMINAL_SEP'
+      and id = cplid
+      and calling_agent is null
+      and calling_dn not in (select line_number from line_unique_tmp);
+
+    update couple_new_id_tmp
+    set called_terminal=value
+    from callrec.couple_extdata
+    where key = 'JTAPI_CALLED_TERMINAL_SEP'
+      and id = cplid
+      and called_agent is null
+      and called_dn not in (select line_number from line_unique_tmp);
+
+    update couple_new_id_tmp
+    set calling_agent=u.user_pkid
+    from axl_data.axl_users u
+    where calling_agent is null
+      and calling_dn = u.line_number
+      and calling_terminal = u.device_name
+      and u.status = 1
+      and u.is_deleted_on_axl = false
+      and u.device_mapping = true;
+
+    update couple_new_id_tmp
+    set called_agent=u.user_pkid
+    from axl_data.axl_users u
+    where called_agent is null
+      and called_dn = u.line_number
+      and called_terminal = u.device_name
+      and u.status = 1
+      and u.is_deleted_on_axl = false
+      and u.device_mapping = true;
+
+    -- DN in more partitions without terminal stay without agent
+    select count(1)
+    into cnt
+    from couple_new_id_tmp
+    where (calling_agent is null and calling_dn in (select line_number from axl_data.axl_user_line_view)
+        and calling_dn not in (select line_number from line_unique_tmp))
+       or (called_agent is null and called_dn in (select line_number from axl_data.axl_user_line_view)
+        and called_dn not in (select line_number from line_unique_tmp));
+    insert into couple_message (operation, description)
+    values ('AMBIGUOUS', '' || cast(cnt as varchar(15)));
+    drop table if exists line_unique_tmp;
+
+    if set_direction then
+        begin
+            update couple_new_id_tmp
+            set new_direction = case
+                                    when calling_agent is not null and called_agent is not null then 'INTERNAL'::varchar
+                                    when calling_agent is null and called_agent is not null then 'INCOMING'::varchar
+                                    when calling_agent is not null and called_agent is null then 'OUTGOING'::varchar
+                                    else new_direction end
+            where calling_agent is not null
+               or called_agent is not null;
+        end;
+    end if;
+
+
+    select count(1)
+    into cnt
+    from (
+             select 1
+             from callrec.couples cc
+                      inner join couple_new_id_tmp c
+                                 on cc.id = c.id
+                                     and not (coalesce(cc.calledagent, '') = coalesce(c.called_agent, '') and
+                                              coalesce(cc.callingagent, '') = coalesce(c.calling_agent, '') and
+                                              direction = new_direction
+                                         )
+         ) a;
+
+    insert into couple_message (operation, description)
+    values ('UPDATE', '' || cast(cnt as varchar(15)));
+
+    update callrec.couples
+    set calledagent=called_agent,
+        callingagent=calling_agent,
+        direction=new_direction
+    from couple_new_id_tmp c
+    where callrec.couples.id = c.id
+      and not (coalesce(calledagent, '') = coalesce(c.called_agent, '') and
+               coalesce(callingagent, '') = coalesce(c.calling_agent, '') and
+               direction = new_direction
+        );
+
+    select max(couple_updated) into last_ts from couple_new_id_tmp;
+    if last_ts is null then
+        select now() - hours_back * '1 hours'::INTERVAL into last_ts;
+    end if;
+    update axl_data.couple_last_update
+    set last_process=now(),
+        last_couple_update_ts=last_ts
+    where id = 2;
+
+    insert into couple_message (operation, description)
+    values ('LAST', '' || to_char(last_ts, 'YYYY-MM-DD HH24:MI:SS TZ'));
+    drop table if exists couple_new_id_tmp;
+
+    RAISE NOTICE 'Finish update couples';
+    for var_r IN (select couple_message.operation, couple_message.description from couple_message)
+        LOOP
+            operation := var_r.operation;
+            description := var_r.description;
+            return next;
+        end loop;
+--     return QUERY (select couple_message.operation, couple_message.description from couple_message);
+    drop table couple_message;
+
+end;
+$$;
+comment on function axl_data.axl_update_couples_by_line(hours_back int, set_direction bool) is 'Update CallREC couples based on axl_user line';
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+const (
+	listChangeObjects = `<objectList><object>User</object><object>Phone</object><object>Line</object></objectList>`
+	listChangeStart   = `<startChangeId queueId="%s">%d</startChangeId>`
+)
+
+// ErrChangeCursorExpired identify change cursor not valid on CUCM, full resync is necessary
+var ErrChangeCursorExpired = errors.New("AXL change cursor expired")
+
+// ErrChangesOverLimit identify changes affecting more objects than processing incrementalMax, full resync is necessary
+var ErrChangesOverLimit = errors.New("AXL changes over incremental sync limit")
+
+// ChangeCursor position in CUCM change notification queue for one cluster
+type ChangeCursor struct {
+	ClusterKey   string // configured cluster identification
+	ClusterName  string // cluster name used in DB rows
+	QueueId      string // CUCM change queue, changed after CUCM restart
+	NextChangeId int64  // first change not processed
+}
+
+type ChangeQueueInfo struct {
+	FirstChangeId     int64  `xml:"firstChangeId"`
+	LastChangeId      int64  `xml:"lastChangeId"`
+	NextStartChangeId int64  `xml:"nextStartChangeId"`
+	QueueId           string `xml:"queueId"`
+}
+
+type Change struct {
+	Type   string `xml:"type,attr"`
+	Uuid   string `xml:"uuid,attr"`
+	Action string `xml:"action,attr"`
+}
+
+type ChangeList struct {
+	QueueInfo ChangeQueueInfo
+	Changes   []Change
+}
+
+// ChangeScope identify rows updated by incremental sync
+type ChangeScope struct {
+	ClusterName string   `json:"cluster_name"`
+	Pkid        []string `json:"pkid"`
+}
+
+// NewChangeList decode listChange response, queueInfo and changes are matched by local name
+func NewChangeList(body string) (*ChangeList, error) {
+	data := &ChangeList{}
+	info := soapElement(body, "queueInfo")
+	if len(info) < 1 {
+		return nil, errors.New("listChange response not contains queueInfo")
+	}
+	if err := xml.Unmarshal([]byte(info), &data.QueueInfo); err != nil {
+		return nil, err
+	}
+	if changes := soapElement(body, "changes"); len(changes) > 0 {
+		var list struct {
+			Changes []Change `xml:"change"`
+		}
+		if err := xml.Unmarshal([]byte(changes), &list); err != nil {
+			return nil, err
+		}
+		data.Changes = list.Changes
+	}
+	return data, nil
+}
+
+// ListChange read changes from cursor, nil cursor return only actual queue position
+func (s *Request) ListChange(cursor *ChangeCursor) (*ChangeList, error) {
+	content := listChangeObjects
+	if cursor != nil {
+		content = fmt.Sprintf(listChangeStart, xmlEscape(cursor.QueueId), cursor.NextChangeId) + content
+	}
+	response, err := s.typedResponse("listChange", content)
+	if err != nil {
+		return nil, err
+	}
+	body, err := response.GetRawBody()
+	if err != nil {
+		return nil, err
+	}
+	return NewChangeList(body)
+}
+
+// ChangeCursor return actual end of change queue, used before full import
+func (s *Connection) ChangeCursor() *ChangeCursor {
+	list, err := NewRequest(s.client, s).ListChange(nil)
+	if err != nil {
+		log.WithFields(log.Fields{"id": s.id, "server": s.server, "error": err}).Warningf("AXL change notification not available, incremental sync disabled")
+		return nil
+	}
+	return &ChangeCursor{
+		ClusterKey:   s.clusterLabel(),
+		ClusterName:  s.clusterName(),
+		QueueId:      list.QueueInfo.QueueId,
+		NextChangeId: list.QueueInfo.NextStartChangeId,
+	}
+}
+
+// ReadChanges return pkid of changed users, devices and lines and new cursor position.
+// ErrChangeCursorExpired is returned when cursor is out of queue or rejected by CUCM fault, ErrChangesOverLimit
+// when changes are over limit. Other problems (network, HTTP status) return original error, sync is repeated later.
+func (s *Connection) ReadChanges(cursor *ChangeCursor) ([]string, *ChangeCursor, error) {
+	request := NewRequest(s.client, s)
+	next := *cursor
+	changed := map[string]bool{}
+	for {
+		list, err := request.ListChange(&next)
+		if errors.Is(err, ErrAxlNotAuthorized) {
+			return nil, nil, err
+		}
+		var fault *AxlFaultError
+		if errors.As(err, &fault) && !fault.Fault.IsRetryable() {
+			log.WithFields(log.Fields{"id": s.id, "server": s.server, "error": err}).Warningf("change cursor not accepted by CUCM")
+			return nil, nil, ErrChangeCursorExpired
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"id": s.id, "server": s.server, "error": err}).Warningf("problem read changes from CUCM")
+			return nil, nil, err
+		}
+		if list.QueueInfo.QueueId != next.QueueId || next.NextChangeId < list.QueueInfo.FirstChangeId {
+			log.WithFields(log.Fields{"id": s.id, "server": s.server, "queue": list.QueueInfo.QueueId}).Warningf("change queue restarted or cursor %d out of queue", next.NextChangeId)
+			return nil, nil, ErrChangeCursorExpired
+		}
+		for _, change := range list.Changes {
+			changed[typedPkid(change.Uuid)] = true
+		}
+		if len(changed) > config.Processing.IncrementalMax {
+			log.WithFields(log.Fields{"id": s.id, "server": s.server, "changes": len(changed)}).Infof("too many changes for incremental sync")
+			return nil, nil, ErrChangesOverLimit
+		}
+		if len(list.Changes) < 1 || list.QueueInfo.NextStartChangeId <= next.NextChangeId {
+			break
+		}
+		next.NextChangeId = list.QueueInfo.NextStartChangeId
+	}
+	return sortedPkid(changed), &next, nil
+}
+
+func sortedPkid(set map[string]bool) []string {
+	var pkid []string
+	for p := range set {
+		pkid = append(pkid, p)
+	}
+	sort.Strings(pkid)
+	return pkid
+}
+
+// GetChangedLoginUserList read login users only for changed pkid
+func (s *Connection) GetChangedLoginUserList(pkid []string) *LoginUserList {
+	matcher, groups, err := s.accessGroupMatcher()
+	if err != nil {
+		return nil
+	}
+	data := &LoginUserList{Rows: []LoginUser{}}
+	if len(groups) < 1 {
+		return data
+	}
+	sql := NewChangedLoginUserSql(groups, pkid)
+	if err := s.changedRowsRequest(sql, data.rowHandler); err != nil {
+		return nil
+	}
+	data.SetAccessGroups(matcher)
+	data.SetClusterName(s.clusterName())
+	return data
+}
+
+// GetChangedUserDeviceLineList read user/device/line rows only for changed pkid
+func (s *Connection) GetChangedUserDeviceLineList(pkid []string) *UserDeviceLineList {
+	sql := NewChangedUserDeviceLineSql(s.jtapiUsers(), pkid)
+	data := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	if err := s.changedRowsRequest(sql, data.rowHandler); err != nil {
+		return nil
+	}
+	if config.Processing.ExtensionMobility {
+		if err := s.readDeviceProfiles(NewChangedDeviceProfileSql(pkid), data); err != nil {
+			return nil
+		}
+	}
+	data.SetClusterName(s.clusterName())
+	return data
+}
+
+// GetAffectedUserDeviceLineList read rows of changed pkid together with all rows sharing their devices and lines.
+// Read is repeated until every device and line of read rows is in request, duplicate resolution then see
+// same rows as full import. Return rows and affected pkid used as change scope.
+func (s *Connection) GetAffectedUserDeviceLineList(pkid []string) (*UserDeviceLineList, []string, error) {
+	affected := map[string]bool{}
+	for _, p := range pkid {
+		affected[p] = true
+	}
+	for {
+		scope := sortedPkid(affected)
+		data := s.GetChangedUserDeviceLineList(scope)
+		if data == nil {
+			return nil, nil, errors.New("problem read changed user/device/line rows")
+		}
+		added := 0
+		for _, r := range data.Rows {
+			for _, p := range []string{r.DevicePKID, r.LinePKID} {
+				if len(p) > 0 && !affected[p] {
+					affected[p] = true
+					added++
+				}
+			}
+		}
+		if added == 0 {
+			return data, scope, nil
+		}
+		if len(affected) > config.Processing.IncrementalMax {
+			log.WithFields(log.Fields{"id": s.id, "server": s.server, "objects": len(affected)}).Infof("changes share too many devices and lines for incremental sync")
+			return nil, nil, ErrChangesOverLimit
+		}
+	}
+}
+
+func (s *Connection) changedRowsRequest(sql *SqlQuery, handler RowHandler) error {
+	if !sql.IsParametersValid() || len(sql.ToString()) < 1 {
+		log.WithField("id", s.id).Errorf("Not valid request parameters for changed rows")
+		return errors.New("not valid request parameters")
+	}
+	err := NewRequest(s.client, s).SqlRowsRequest(sql.ToString(), handler)
+	if err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read changed rows from AXL")
+	}
+	return err
+}
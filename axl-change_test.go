@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func changeResponse(queue string, first int64, next int64, changes ...string) string {
+	body := fmt.Sprintf(`<ns:listChangeResponse xmlns:ns="http://www.cisco.com/AXL/API/12.5"><queueInfo><firstChangeId>%d</firstChangeId><lastChangeId>%d</lastChangeId><nextStartChangeId>%d</nextStartChangeId><queueId>%s</queueId></queueInfo>`, first, next-1, next, queue)
+	if len(changes) > 0 {
+		body += "<changes>"
+		for _, uuid := range changes {
+			body += fmt.Sprintf(`<change type="Phone" uuid="%s" action="u"><changedTags><changedTag name="description">x</changedTag></changedTags></change>`, uuid)
+		}
+		body += "</changes>"
+	}
+	return body + "</ns:listChangeResponse>"
+}
+
+func TestNewChangeList(t *testing.T) {
+	t.Parallel()
+	list, err := NewChangeList(changeResponse("Q1", 10, 25, "{AAA}", "{BBB}"))
+	if err != nil {
+		t.Fatalf("change list not decoded: %s", err)
+	}
+	if list.QueueInfo.QueueId != "Q1" || list.QueueInfo.FirstChangeId != 10 || list.QueueInfo.NextStartChangeId != 25 {
+		t.Errorf("not expected queue info %+v", list.QueueInfo)
+	}
+	if len(list.Changes) != 2 || list.Changes[1].Uuid != "{BBB}" || list.Changes[0].Type != "Phone" {
+		t.Errorf("not expected changes %+v", list.Changes)
+	}
+	if _, err := NewChangeList("<return/>"); err == nil {
+		t.Errorf("response without queue info accepted")
+	}
+}
+
+func TestConnection_ReadChanges(t *testing.T) {
+	t.Parallel()
+	start := regexp.MustCompile(`<startChangeId queueId="([^"]*)">(\d+)</startChangeId>`)
+	tables := []struct {
+		cursor  ChangeCursor
+		pkid    []string
+		next    int64
+		expired bool
+		failed  bool
+		name    string
+	}{
+		{ChangeCursor{QueueId: "Q1", NextChangeId: 20}, []string{"aaa", "bbb", "ccc"}, 40, false, false, "changes in two responses"},
+		{ChangeCursor{QueueId: "Q1", NextChangeId: 40}, nil, 40, false, false, "no changes"},
+		{ChangeCursor{QueueId: "Q0", NextChangeId: 20}, nil, 0, true, false, "queue restarted"},
+		{ChangeCursor{QueueId: "Q1", NextChangeId: 5}, nil, 0, true, false, "cursor out of queue"},
+		{ChangeCursor{QueueId: "Q1", NextChangeId: 50}, nil, 0, false, true, "service unavailable"},
+	}
+	for _, table := range tables {
+		connection := NewConnection("localhost", "user", "pwd")
+		connection.dbVersion = "12.0"
+		connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+			b, _ := ioutil.ReadAll(r.Body)
+			from, _ := strconv.ParseInt(start.FindStringSubmatch(string(b))[2], 10, 64)
+			switch {
+			case from < 10:
+				return soapResponse(500, strings.ReplaceAll(authorizationFault, "User not authorized for this request", "Change id out of range"))
+			case from == 20:
+				return soapResponse(200, changeResponse("Q1", 10, 30, "{AAA}", "{BBB}"))
+			case from == 30:
+				return soapResponse(200, changeResponse("Q1", 10, 40, "{BBB}", "{CCC}"))
+			case from == 50:
+				return soapResponse(503, "")
+			}
+			return soapResponse(200, changeResponse("Q1", 10, 40))
+		})})
+		pkid, next, err := connection.ReadChanges(&table.cursor)
+		if table.expired {
+			if err != ErrChangeCursorExpired {
+				t.Errorf("cursor not expired for [%s] - %v", table.name, err)
+			}
+			continue
+		}
+		if table.failed {
+			// temporary problem is repeated by next sync, full import is not necessary
+			if err == nil || err == ErrChangeCursorExpired || err == ErrChangesOverLimit {
+				t.Errorf("not expected error for [%s] - %v", table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("not expected error for [%s] - %s", table.name, err)
+			continue
+		}
+		if strings.Join(pkid, ",") != strings.Join(table.pkid, ",") || next.NextChangeId != table.next {
+			t.Errorf("not expected changes for [%s] - [%v %d / %v %d]", table.name, pkid, next.NextChangeId, table.pkid, table.next)
+		}
+	}
+}
+
+func TestNewChangedUserDeviceLineSql(t *testing.T) {
+	t.Parallel()
+	sql := NewChangedUserDeviceLineSql([]string{"callrec"}, []string{"aaa", "bbb"}).ToString()
+	if !strings.Contains(sql, "lower(userid) in ('callrec')") || !strings.Contains(sql, "d.pkid in ('aaa','bbb')") {
+		t.Errorf("not expected changed SQL %s", sql)
+	}
+	if !strings.HasSuffix(sql, "ORDER BY eu.pkid, d.pkid, np.pkid") {
+		t.Errorf("changed SQL not ordered")
+	}
+	login := NewChangedLoginUserSql([]string{"QM Access"}, []string{"aaa"}).ToString()
+	if !strings.Contains(login, "dg.name in ('QM Access')") || !strings.Contains(login, "enduser.pkid in ('aaa')") {
+		t.Errorf("not expected changed login SQL %s", login)
+	}
+}
+
+func TestConnection_GetAffectedUserDeviceLineList(t *testing.T) {
+	t.Parallel()
+	inList := regexp.MustCompile(`d\.pkid in \(([^)]*)\)`)
+	pkid := regexp.MustCompile(`[udl]\d`)
+	table := [][3]string{{"u1", "d1", "l1"}, {"u2", "d1", "l2"}, {"u2", "d2", "l3"}, {"u3", "d3", "l3"}, {"u4", "d4", "l4"}}
+	var requests int
+	connection := NewConnection("localhost", "user", "pwd")
+	connection.dbVersion = "12.5"
+	connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		requests++
+		b, _ := ioutil.ReadAll(r.Body)
+		selected := map[string]bool{}
+		if m := inList.FindStringSubmatch(string(b)); m != nil {
+			for _, p := range pkid.FindAllString(m[1], -1) {
+				selected[p] = true
+			}
+		}
+		rows := strings.Builder{}
+		for _, row := range table {
+			if selected[row[0]] || selected[row[1]] || selected[row[2]] {
+				rows.WriteString(fmt.Sprintf("<row><user_pkid>%s</user_pkid><device_pkid>%s</device_pkid><line_pkid>%s</line_pkid></row>", row[0], row[1], row[2]))
+			}
+		}
+		return soapResponse(200, "<return>"+rows.String()+"</return>")
+	})})
+	list, scope, err := connection.GetAffectedUserDeviceLineList([]string{"u1"})
+	if err != nil {
+		t.Fatalf("affected rows not expect error %s", err)
+	}
+	var users []string
+	for _, row := range list.Rows {
+		users = append(users, row.UserPKID+"-"+row.DevicePKID+"-"+row.LinePKID)
+	}
+	// u2 share device d1, line l2 of u2 must be complete too, device d2 of u2 is not affected
+	if strings.Join(users, ",") != "u1-d1-l1,u2-d1-l2" {
+		t.Errorf("not expected affected rows %v", users)
+	}
+	if strings.Join(scope, ",") != "d1,l1,l2,u1" {
+		t.Errorf("not expected change scope %v", scope)
+	}
+	if requests != 3 {
+		t.Errorf("not expected number of AXL requests [%d / %d]", requests, 3)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+type clusterState struct {
+	activeNode    int          // last AXL node answered, used in next AXL update
+	limiter       *RateLimiter // pace all AXL requests to cluster
+	schemaVersion string       // negotiated AXL schema version
+	cucmVersion   string       // CUCM version reported by getCCMVersion
+	storedVersion string       // schema version stored in DB
+}
+
+var clusterStates = map[string]*clusterState{}
+
+// ClusterKey identify cluster configuration between AXL updates
+func (a *ConfigAxl) ClusterKey() string {
+	if len(a.Name) > 0 {
+		return a.Name
+	}
+	nodes := a.NodeList()
+	if len(nodes) < 1 {
+		return ""
+	}
+	return nodes[0].String()
+}
+
+func getClusterState(cluster *ConfigAxl) *clusterState {
+	state, ok := clusterStates[cluster.ClusterKey()]
+	if !ok {
+		state = &clusterState{activeNode: 0, limiter: NewRateLimiter(cluster.Retry.RateLimit)}
+		clusterStates[cluster.ClusterKey()] = state
+	}
+	return state
+}
+
+// NewClusterConnection prepare AXL connection for one configured cluster
+func NewClusterConnection(ctx context.Context, cluster *ConfigAxl) (*Connection, error) {
+	tlsConfig, err := cluster.TlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	state := getClusterState(cluster)
+	con := NewNodesConnection(cluster.NodeList(), cluster.User, cluster.Password)
+	con.cluster = cluster
+	con.SetContext(ctx)
+	con.SetApi(cluster.Api)
+	con.SetTlsConfig(tlsConfig)
+	con.SetRetry(NewRetryPolicy(cluster.Retry), state.limiter)
+	con.SetActiveNode(state.activeNode)
+	if len(cluster.SchemaVersion) > 0 {
+		con.SetSchemaVersion(cluster.SchemaVersion, true)
+	} else {
+		con.SetSchemaVersion(state.schemaVersion, false)
+	}
+	log.WithFields(log.Fields{"id": con.id, "cluster": cluster.ClusterKey(), "tls": cluster.TlsMode()}).Debugf("AXL connection TLS mode %s", cluster.TlsMode())
+	return con, nil
+}
+
+// storeClusterState remember active node and schema version for next AXL update
+func (s *Connection) storeClusterState() {
+	if s.cluster == nil {
+		return
+	}
+	state := getClusterState(s.cluster)
+	state.activeNode = s.ActiveNode()
+	if len(s.dbVersion) > 0 && s.dbVersion != DbVersionError && len(s.cluster.SchemaVersion) < 1 {
+		state.schemaVersion = s.dbVersion
+		state.cucmVersion = s.cucmVersion
+	}
+}
+
+func (s *Connection) jtapiUsers() []string {
+	if s.cluster != nil && len(s.cluster.JtapiUser) > 0 {
+		return s.cluster.JtapiUser
+	}
+	return config.Zqm.JtapiUser
+}
+
+func (s *Connection) accessGroups() []ConfigAccessGroup {
+	if s.cluster != nil {
+		return s.cluster.AccessGroupList()
+	}
+	return config.Axl.AccessGroupList()
+}
+
+// clusterName return configured cluster name, empty when name from CUCM is used
+func (s *Connection) clusterName() string {
+	if s.cluster != nil {
+		return s.cluster.Name
+	}
+	return ""
+}
+
+func (s *Connection) clusterLabel() string {
+	if s.cluster != nil {
+		return s.cluster.ClusterKey()
+	}
+	return s.server
+}
+
+// readAxlCluster read login users, user/device/line rows and role group membership from one cluster, nil means
+// problem read data. With incremental sync is returned change cursor valid before read.
+func readAxlCluster(ctx context.Context, cluster *ConfigAxl) (*LoginUserList, *UserDeviceLineList, *UserGroupList, *ChangeCursor) {
+	axlConnection, err := NewClusterConnection(ctx, cluster)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "error": err.Error()}).Errorf("problem prepare TLS configuration for AXL connection")
+		return nil, nil, nil, nil
+	}
+	defer axlConnection.storeClusterState()
+	accessible, _ := axlConnection.IsLoginValid()
+	if !accessible {
+		return nil, nil, nil, nil
+	}
+	db, err := axlConnection.DbVersion()
+	if err != nil || db == DbVersionError {
+		log.WithField("cluster", cluster.ClusterKey()).Errorf("problem with AXL connection or DB version not supported")
+		return nil, nil, nil, nil
+	}
+	var cursor *ChangeCursor
+	if config.Processing.Incremental {
+		cursor = axlConnection.ChangeCursor()
+	}
+	loginUser := axlConnection.GetLoginUserList()
+	if ctx.Err() != nil {
+		return nil, nil, nil, nil
+	}
+	deviceIdList := axlConnection.GetUserDeviceLineList()
+	if ctx.Err() != nil {
+		return nil, nil, nil, nil
+	}
+	userGroups := axlConnection.GetUserGroupList(config.Mapping.RoleGroups())
+	if axlConnection.useTypedApi() {
+		// incremental sync need executeSQLQuery
+		cursor = nil
+	}
+	return loginUser, deviceIdList, userGroups, cursor
+}
+
+func joinClusterNames(clusters []*ConfigAxl) string {
+	var names []string
+	for _, cluster := range clusters {
+		names = append(names, cluster.ClusterKey())
+	}
+	return strings.Join(names, ", ")
+}
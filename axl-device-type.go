@@ -0,0 +1,77 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// CUCM enums from typeclass and typemodel tables
+const (
+	deviceClassPhone      = 1
+	deviceClassGateway    = 2
+	deviceClassRoutePoint = 10
+	deviceClassProfile    = 254
+	deviceModelCtiPort    = 72
+	deviceModelRoutePoint = 73
+)
+
+// jabberModels are soft clients, CSF, BOT, TCT and TAB devices
+var jabberModels = map[int]string{
+	503: "Cisco Unified Client Services Framework",
+	562: "Cisco Dual Mode for Android",
+	575: "Cisco Dual Mode for iPhone",
+	652: "Cisco Jabber for Tablet",
+}
+
+// gatewayModels are analog and BRI gateway ports
+var gatewayModels = map[int]string{
+	30027: "Analog Phone",
+	30028: "ISDN BRI Phone",
+}
+
+// inModels identify model by enum (SQL API) or by name (typed API)
+func inModels(models map[int]string, model int, name string) bool {
+	if _, ok := models[model]; ok {
+		return true
+	}
+	for _, n := range models {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceType classify device by class and model, typed API has only class and model names
+func (u *UserDeviceLine) DeviceType() string {
+	switch {
+	case u.ClassEnum == deviceClassProfile || strings.EqualFold(u.DeviceClass, "Device Profile"):
+		return DeviceTypeProfile
+	case u.ClassEnum == deviceClassRoutePoint || u.ModelEnum == deviceModelRoutePoint || strings.EqualFold(u.DeviceModel, "CTI Route Point"):
+		return DeviceTypeRoutePoint
+	case u.ModelEnum == deviceModelCtiPort || strings.EqualFold(u.DeviceModel, "CTI Port"):
+		return DeviceTypeCtiPort
+	case inModels(jabberModels, u.ModelEnum, u.DeviceModel):
+		return DeviceTypeJabber
+	case u.ClassEnum == deviceClassGateway || inModels(gatewayModels, u.ModelEnum, u.DeviceModel) || strings.EqualFold(u.DeviceClass, "Gateway"):
+		return DeviceTypeGateway
+	case u.ClassEnum == deviceClassPhone || strings.EqualFold(u.DeviceClass, "Phone"):
+		return DeviceTypeDesk
+	}
+	return DeviceTypeOther
+}
+
+// ClassifyDevices set device type of rows and mark devices not used for couple mapping
+func (u *UserDeviceLineList) ClassifyDevices(rules ConfigDeviceTypes) {
+	excluded := map[string]int{}
+	for i := range u.Rows {
+		u.Rows[i].DeviceTypeName = u.Rows[i].DeviceType()
+		u.Rows[i].ExcludeMapping = !rules.UseForMapping(u.Rows[i].DeviceTypeName)
+		if u.Rows[i].ExcludeMapping {
+			excluded[u.Rows[i].DeviceTypeName]++
+		}
+	}
+	for deviceType, rows := range excluded {
+		log.WithFields(log.Fields{"deviceType": deviceType, "rows": rows}).Infof("%d rows with device type %s not used for couple mapping", rows, deviceType)
+	}
+}
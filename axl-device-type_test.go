@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserDeviceLine_DeviceType(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		row        UserDeviceLine
+		deviceType string
+		name       string
+	}{
+		{UserDeviceLine{ModelEnum: 36670, ClassEnum: 1, DeviceModel: "Cisco 8845"}, DeviceTypeDesk, "desk phone"},
+		{UserDeviceLine{ModelEnum: 503, ClassEnum: 1, DeviceModel: "Cisco Unified Client Services Framework"}, DeviceTypeJabber, "jabber CSF"},
+		{UserDeviceLine{ModelEnum: 72, ClassEnum: 1, DeviceModel: "CTI Port"}, DeviceTypeCtiPort, "CTI port"},
+		{UserDeviceLine{ModelEnum: 73, ClassEnum: 10, DeviceModel: "CTI Route Point"}, DeviceTypeRoutePoint, "CTI route point"},
+		{UserDeviceLine{ModelEnum: 30027, ClassEnum: 1, DeviceModel: "Analog Phone"}, DeviceTypeGateway, "analog port"},
+		{UserDeviceLine{ModelEnum: 36670, ClassEnum: 254, DeviceModel: "Cisco 8845"}, DeviceTypeProfile, "device profile"},
+		{UserDeviceLine{DeviceModel: "Cisco Dual Mode for iPhone", DeviceClass: "Phone"}, DeviceTypeJabber, "typed API jabber TCT"},
+		{UserDeviceLine{DeviceModel: "Cisco 7841", DeviceClass: "Phone"}, DeviceTypeDesk, "typed API desk phone"},
+		{UserDeviceLine{ModelEnum: 1, ClassEnum: 20}, DeviceTypeOther, "unknown class"},
+	}
+	for _, table := range tables {
+		if deviceType := table.row.DeviceType(); deviceType != table.deviceType {
+			t.Errorf("not expected device type for [%s] - %s / %s", table.name, deviceType, table.deviceType)
+		}
+	}
+}
+
+func TestUserDeviceLineList_ClassifyDevices(t *testing.T) {
+	t.Parallel()
+	// CTI port shared by two users is not in duplicate check when not used for mapping
+	list := UserDeviceLineList{Rows: []UserDeviceLine{
+		{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1", UserId: "agent1", DeviceName: "SEP001", LineNumber: "2101", ClusterName: "A", ModelEnum: 36670, ClassEnum: 1},
+		{UserPKID: "u1", DevicePKID: "d2", LinePKID: "l2", UserId: "agent1", DeviceName: "CTIPORT01", LineNumber: "2901", ClusterName: "A", ModelEnum: 72, ClassEnum: 1},
+		{UserPKID: "u2", DevicePKID: "d2", LinePKID: "l2", UserId: "agent2", DeviceName: "CTIPORT01", LineNumber: "2901", ClusterName: "A", ModelEnum: 72, ClassEnum: 1},
+	}}
+	dup := list.GetDuplicateDevices()
+	if len(dup.device) != 1 || !strings.Contains(strings.Join(dup.errors, ""), "of type ctiport") {
+		t.Errorf("CTI port not in duplicate report %v", dup.errors)
+	}
+	list.ClassifyDevices(ConfigDeviceTypes{{Type: DeviceTypeCtiPort, Mapping: false}})
+	if list.Rows[0].DeviceTypeName != DeviceTypeDesk || list.Rows[0].ExcludeMapping || !list.Rows[1].ExcludeMapping {
+		t.Errorf("not expected classification %+v", list.Rows)
+	}
+	dup = list.GetDuplicateDevices()
+	if len(dup.device) != 0 || len(dup.line) != 0 {
+		t.Errorf("device not used for mapping in duplicate check %v", dup.errors)
+	}
+}
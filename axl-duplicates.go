@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
 	"sort"
 	"strings"
+	"time"
 )
 
 type UniqueList struct {
 	name        string
 	description string
 	pkid        []string
+	deviceType  string // device type of device, empty for line
+	winner      string // user key of resolved winner, empty when device or line is dropped
+	reason      string // policy which selected winner
 }
 
 type Duplicates struct {
@@ -38,12 +46,25 @@ func (u *UniqueList) UserListString(user map[string]*UniqueList) string {
 	return sb.String()
 }
 
+// resolution return winner and reason for duplicate message
+func (u *UniqueList) resolution(user map[string]*UniqueList) string {
+	if len(u.winner) < 1 {
+		return ", removed"
+	}
+	return fmt.Sprintf(", resolved to %s by %s", user[u.winner].name, u.reason)
+}
+
+// IsWinner identify user which keep shared device or line
+func (u *UniqueList) IsWinner(userKey string) bool {
+	return len(u.winner) > 0 && u.winner == userKey
+}
+
 func (d *Duplicates) GenerateErrors() {
 	d.errors = []string{}
 
 	for key, val := range d.device {
 		if len(d.device[key].pkid) > 1 {
-			d.errors = append(d.errors, fmt.Sprintf("Device [%s - %s] associate to next User ID: [%s]", val.name, val.description, val.UserListString(d.user)))
+			d.errors = append(d.errors, fmt.Sprintf("Device [%s - %s] of type %s associate to next User ID: [%s]%s", val.name, val.description, val.deviceType, val.UserListString(d.user), val.resolution(d.user)))
 		} else {
 			delete(d.device, key)
 		}
@@ -51,13 +72,77 @@ func (d *Duplicates) GenerateErrors() {
 
 	for key, val := range d.line {
 		if len(d.line[key].pkid) > 1 {
-			d.errors = append(d.errors, fmt.Sprintf("Line [%s - %s] associate to next User ID: [%s]", val.name, val.description, val.UserListString(d.user)))
+			d.errors = append(d.errors, fmt.Sprintf("Line [%s - %s] associate to next User ID: [%s]%s", val.name, val.description, val.UserListString(d.user), val.resolution(d.user)))
 		} else {
 			delete(d.line, key)
 		}
 	}
 }
 
+// DuplicateReportRow is one device or line associated to more users, stored in duplicate report
+type DuplicateReportRow struct {
+	ObjectType  string `json:"object_type"` // device or line
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	DeviceType  string `json:"device_type"` // empty for line
+	UserIds     string `json:"user_ids"`    // conflicting user IDs
+	Winner      string `json:"winner"`      // user ID keeping device or line, empty when removed
+	Reason      string `json:"reason"`      // policy selected winner or removed
+}
+
+// reportRow convert unique list to duplicate report row
+func (u *UniqueList) reportRow(objectType string, user map[string]*UniqueList) DuplicateReportRow {
+	row := DuplicateReportRow{ObjectType: objectType, Name: u.name, Description: u.description, DeviceType: u.deviceType,
+		UserIds: u.UserListString(user), Reason: "removed"}
+	if len(u.winner) > 0 {
+		row.Winner = user[u.winner].name
+		row.Reason = u.reason
+	}
+	return row
+}
+
+// Report return devices and lines associated to more users sorted by type and name
+func (d *Duplicates) Report() []DuplicateReportRow {
+	report := []DuplicateReportRow{}
+	for _, val := range d.device {
+		if len(val.pkid) > 1 {
+			report = append(report, val.reportRow("device", d.user))
+		}
+	}
+	for _, val := range d.line {
+		if len(val.pkid) > 1 {
+			report = append(report, val.reportRow("line", d.user))
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].ObjectType != report[j].ObjectType {
+			return report[i].ObjectType < report[j].ObjectType
+		}
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+// runDuplicatesExport print latest duplicate report stored in DB in csv or json format
+func runDuplicatesExport(ctx context.Context, w io.Writer, format string) error {
+	if format != QueryFormatCsv && format != QueryFormatJson {
+		return errors.New(fmt.Sprintf("output format %s not supported", format))
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.DbTimeout)*time.Minute)
+	defer cancel()
+	conn, err := connectDb(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	result, err := connectReadDuplicates(ctx, conn)
+	if err != nil {
+		return err
+	}
+	log.WithField("rows", len(result.Rows)).Info("export latest duplicate report")
+	return result.Write(w, format)
+}
+
 func NewUniqueList(name string, description string, pkid string) *UniqueList {
 	l := UniqueList{
 		name:        name,
@@ -73,3 +158,134 @@ func ContainsString(s []string, search string) bool {
 	i := sort.SearchStrings(t, search)
 	return i < len(s) && t[i] == search
 }
+
+// SharedResolver choose winner of device or line associated to more users by configured policies
+type SharedResolver struct {
+	policy  []string
+	winners []ConfigSharedWinner
+}
+
+func NewSharedResolver(c *ConfigShared) *SharedResolver {
+	if c == nil {
+		return &SharedResolver{}
+	}
+	return &SharedResolver{policy: c.Policy, winners: c.Winners}
+}
+
+// sharedFacts collect data from rows used by policies, all keys are cluster unique
+type sharedFacts struct {
+	manualDevice  map[string]string   // device key -> user ID of manual winner
+	manualLine    map[string]string   // line key -> user ID of manual winner
+	deviceOwner   map[string]string   // device key -> user key of device owner
+	lineOwners    map[string][]string // line key -> user keys of owners of devices with line
+	linePrimary   map[string][]string // line key -> user keys with line as primary extension
+	devicePrimary map[string][]string // device key -> user keys with primary extension on device
+}
+
+func (r *SharedResolver) facts(rows []UserDeviceLine) *sharedFacts {
+	f := &sharedFacts{
+		manualDevice:  map[string]string{},
+		manualLine:    map[string]string{},
+		deviceOwner:   map[string]string{},
+		lineOwners:    map[string][]string{},
+		linePrimary:   map[string][]string{},
+		devicePrimary: map[string][]string{},
+	}
+	add := func(m map[string][]string, key string, value string) {
+		if !ContainsString(m[key], value) {
+			m[key] = append(m[key], value)
+		}
+	}
+	for _, row := range rows {
+		deviceKey := row.clusterKey(row.DevicePKID)
+		lineKey := row.lineKey()
+		for _, w := range r.winners {
+			if len(w.Device) > 0 && strings.EqualFold(w.Device, row.DeviceName) {
+				f.manualDevice[deviceKey] = w.UserId
+			}
+			if len(w.Line) > 0 && w.Line == row.LineNumber && (len(w.Partition) < 1 || strings.EqualFold(w.Partition, row.Partition)) {
+				f.manualLine[lineKey] = w.UserId
+			}
+		}
+		if len(row.DeviceOwner) > 0 {
+			owner := row.clusterKey(row.DeviceOwner)
+			f.deviceOwner[deviceKey] = owner
+			add(f.lineOwners, lineKey, owner)
+		}
+		if row.PrimaryLine {
+			userKey := row.clusterKey(row.UserPKID)
+			add(f.linePrimary, lineKey, userKey)
+			add(f.devicePrimary, deviceKey, userKey)
+		}
+	}
+	return f
+}
+
+// single return the only candidate from list, empty when there is none or more candidates
+func single(candidates []string, users []string) string {
+	var winner string
+	for _, c := range candidates {
+		if !ContainsString(users, c) {
+			continue
+		}
+		if len(winner) > 0 {
+			return ""
+		}
+		winner = c
+	}
+	return winner
+}
+
+// manualWinner return user key of user with configured user ID
+func (d *Duplicates) manualWinner(userId string, users []string) string {
+	for _, key := range users {
+		if u, ok := d.user[key]; ok && len(userId) > 0 && strings.EqualFold(u.name, userId) {
+			return key
+		}
+	}
+	return ""
+}
+
+// resolve try policies in configured order, first policy with winner is used
+func (d *Duplicates) resolve(list *UniqueList, policy []string, manual string, owner []string, primary []string) {
+	for _, p := range policy {
+		var winner, reason string
+		switch p {
+		case SharedManual:
+			winner, reason = d.manualWinner(manual, list.pkid), "manual winner"
+		case SharedOwner:
+			winner, reason = single(owner, list.pkid), "device owner"
+		case SharedPrimary:
+			winner, reason = single(primary, list.pkid), "primary extension"
+		case SharedDrop:
+			return
+		}
+		if len(winner) > 0 {
+			list.winner = winner
+			list.reason = reason
+			return
+		}
+	}
+}
+
+// Resolve set winners of shared devices and lines, device or line without winner is dropped
+func (d *Duplicates) Resolve(rows []UserDeviceLine, resolver *SharedResolver) {
+	if resolver == nil || len(resolver.policy) < 1 {
+		return
+	}
+	f := resolver.facts(rows)
+	for key, val := range d.device {
+		if len(val.pkid) > 1 {
+			var owner []string
+			if o, ok := f.deviceOwner[key]; ok {
+				owner = []string{o}
+			}
+			d.resolve(val, resolver.policy, f.manualDevice[key], owner, f.devicePrimary[key])
+		}
+	}
+	for key, val := range d.line {
+		if len(val.pkid) > 1 {
+			d.resolve(val, resolver.policy, f.manualLine[key], f.lineOwners[key], f.linePrimary[key])
+		}
+	}
+}
@@ -118,3 +118,28 @@ var lineListData = []anyListTables{
 	{name: "line02", pkid: "lllll-lll-02", duplicate: false, addId: "bllll-lll-02"},
 	{name: "line03", pkid: "lllll-lll-03", duplicate: true, addId: "lllll-lll-03"},
 }
+
+func TestDuplicates_Report(t *testing.T) {
+	t.Parallel()
+	list := UserDeviceLineList{Rows: []UserDeviceLine{
+		{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1", UserId: "agent1", DeviceName: "SEP001", DeviceDescription: "Shared", LineNumber: "2101", Partition: "Internal_PT", ClusterName: "A", ModelEnum: 36670, ClassEnum: 1, DeviceOwner: "u2"},
+		{UserPKID: "u2", DevicePKID: "d1", LinePKID: "l1", UserId: "agent2", DeviceName: "SEP001", DeviceDescription: "Shared", LineNumber: "2101", Partition: "Internal_PT", ClusterName: "A", ModelEnum: 36670, ClassEnum: 1, DeviceOwner: "u2"},
+		{UserPKID: "u3", DevicePKID: "d3", LinePKID: "l3", UserId: "agent3", DeviceName: "SEP003", LineNumber: "2103", ClusterName: "A"},
+	}}
+	report := list.ResolveDuplicateDevices(NewSharedResolver(&ConfigShared{Policy: []string{SharedOwner}})).Report()
+	if len(report) != 2 {
+		t.Fatalf("not expected report rows %+v", report)
+	}
+	device, line := report[0], report[1]
+	if device.ObjectType != "device" || device.Name != "SEP001" || device.DeviceType != DeviceTypeDesk || device.UserIds != "agent1, agent2" ||
+		device.Winner != "agent2" || device.Reason != "device owner" {
+		t.Errorf("not expected device report row %+v", device)
+	}
+	if line.ObjectType != "line" || line.Name != "2101 in Internal_PT" || line.DeviceType != "" || line.Winner != "agent2" {
+		t.Errorf("not expected line report row %+v", line)
+	}
+	report = list.GetDuplicateDevices().Report()
+	if len(report) != 2 || report[0].Winner != "" || report[0].Reason != "removed" {
+		t.Errorf("not expected report without resolution %+v", report)
+	}
+}
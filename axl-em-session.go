@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	log "github.com/sirupsen/logrus"
+)
+
+type EmSessionList struct {
+	XMLName xml.Name    `xml:"return"`
+	Rows    []EmSession `xml:"row"`
+}
+
+// EmSession is Extension Mobility login of end user on physical device
+type EmSession struct {
+	XMLName     xml.Name `xml:"row"`
+	DevicePKID  string   `xml:"device_pkid" json:"device_pkid"`
+	DeviceName  string   `xml:"devicename" json:"devicename"`
+	UserPKID    string   `xml:"user_pkid" json:"user_pkid"`
+	UserId      string   `xml:"userid" json:"userid"`
+	ProfileName string   `xml:"profilename" json:"profilename"`
+	LoginTime   int64    `xml:"logintime" json:"logintime"` // login time in seconds from epoch
+	ClusterName string   `xml:"cluster_name" json:"cluster_name"`
+}
+
+// rowHandler decode one row and add it to list
+func (u *EmSessionList) rowHandler(decoder *xml.Decoder, start *xml.StartElement) error {
+	var row EmSession
+	if err := decoder.DecodeElement(&row, start); err != nil {
+		return err
+	}
+	u.Rows = append(u.Rows, row)
+	return nil
+}
+
+// SetClusterName replace cluster name from CUCM by configured name
+func (u *EmSessionList) SetClusterName(name string) {
+	if len(name) < 1 {
+		return
+	}
+	for i := range u.Rows {
+		u.Rows[i].ClusterName = name
+	}
+}
+
+// GetEmSessionList read actual Extension Mobility logins, available only by executeSQLQuery
+func (s *Connection) GetEmSessionList() *EmSessionList {
+	if s.useTypedApi() {
+		log.WithField("id", s.id).Debug("Extension Mobility logins need executeSQLQuery, typed API is used")
+		return nil
+	}
+	sql := NewEmSessionSql()
+	data := &EmSessionList{Rows: []EmSession{}}
+	if err := NewRequest(s.client, s).SqlRowsRequest(sql.ToString(), data.rowHandler); err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read Extension Mobility logins from AXL")
+		return nil
+	}
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read Extension Mobility logins from AXL")
+	return data
+}
+
+// readEmSessions read Extension Mobility logins from one cluster, nil means problem read data
+func readEmSessions(ctx context.Context, cluster *ConfigAxl) *EmSessionList {
+	if cluster.Api == ApiTyped {
+		return nil
+	}
+	axlConnection, err := NewClusterConnection(ctx, cluster)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "error": err.Error()}).Errorf("problem prepare TLS configuration for AXL connection")
+		return nil
+	}
+	defer axlConnection.storeClusterState()
+	if accessible, _ := axlConnection.IsLoginValid(); !accessible {
+		return nil
+	}
+	return axlConnection.GetEmSessionList()
+}
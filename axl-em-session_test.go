@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"go-zqm-axl-importer/fakeaxl"
+	"testing"
+)
+
+func TestConnection_GetEmSessionList(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures})
+	defer server.Close()
+	connection, err := NewClusterConnection(context.Background(), fakeCluster("FAKE-EM", server))
+	if err != nil {
+		t.Fatalf("connection to fake AXL not created: %s", err)
+	}
+	connection.dbVersion = "12.5"
+	data := connection.GetEmSessionList()
+	if data == nil || len(data.Rows) != 1 {
+		t.Fatalf("not expected EM logins %v", data)
+	}
+	row := data.Rows[0]
+	if row.DeviceName != "SEP000000000003" || row.UserId != "agent05" || row.ProfileName != "UDP_agent05" || row.LoginTime != 1767254400 || row.ClusterName != "FAKE-EM" {
+		t.Errorf("not expected EM login %+v", row)
+	}
+}
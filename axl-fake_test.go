@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"go-zqm-axl-importer/fakeaxl"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeFixtures = "fakeaxl/fixtures"
+
+// fakeCluster return cluster configuration for fake AXL server
+func fakeCluster(name string, server *fakeaxl.Server) *ConfigAxl {
+	return &ConfigAxl{
+		Name:              name,
+		Nodes:             []ConfigAxlNode{{Server: server.Host(), Port: server.Port()}},
+		User:              "axl",
+		Password:          "secret",
+		AccessGroup:       "QM Access",
+		JtapiUser:         []string{"callrec"},
+		IgnoreCertificate: true,
+		Api:               ApiSql,
+	}
+}
+
+func fakeConnection(t *testing.T, ctx context.Context, name string, server *fakeaxl.Server) *Connection {
+	connection, err := NewClusterConnection(ctx, fakeCluster(name, server))
+	if err != nil {
+		t.Fatalf("connection to fake AXL not created: %s", err)
+	}
+	return connection
+}
+
+func TestFakeAxl_Connection(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, User: "axl", Password: "secret", Schemas: []string{"12.5"}})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-CONNECTION", server)
+	valid, err := connection.IsLoginValid()
+	if err != nil || !valid {
+		t.Fatalf("login to fake AXL not valid %t - %v", valid, err)
+	}
+	if connection.dbVersion != "12.5" || connection.cucmVersion != fakeaxl.DefaultVersion {
+		t.Errorf("not expected negotiated version [%s / %s]", connection.dbVersion, connection.cucmVersion)
+	}
+	if server.Requests("getCCMVersion") != 2 {
+		t.Errorf("unsupported schema not rejected before negotiation [%d requests]", server.Requests("getCCMVersion"))
+	}
+}
+
+func TestFakeAxl_NotAuthorized(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, User: "axl", Password: "other"})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-AUTH", server)
+	if valid, err := connection.IsLoginValid(); err == nil || valid {
+		t.Errorf("login with wrong password accepted")
+	}
+}
+
+func TestFakeAxl_GetUserDeviceLineList(t *testing.T) {
+	tables := []struct {
+		fetchMax int
+		requests int
+		name     string
+	}{
+		{0, 1, "one response"},
+		{3, 4, "query request too large"},
+	}
+	for _, table := range tables {
+		server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, FetchMax: table.fetchMax})
+		connection := fakeConnection(t, context.Background(), "FAKE-DEVICE", server)
+		connection.dbVersion = "12.5"
+		data := connection.GetUserDeviceLineList()
+		server.Close()
+		if data == nil || len(data.Rows) != 5 {
+			t.Errorf("not expected rows for [%s] - %v", table.name, data)
+			continue
+		}
+		if data.Rows[4].DeviceName != "CSFAGENT04" || data.Rows[0].ClusterName != "FAKE-DEVICE" || !data.Rows[0].IsLocalUser {
+			t.Errorf("not expected row content for [%s] - %+v", table.name, data.Rows[4])
+		}
+		if server.Requests("executeSQLQuery") != table.requests {
+			t.Errorf("not expected SQL requests for [%s] - [%d / %d]", table.name, server.Requests("executeSQLQuery"), table.requests)
+		}
+	}
+}
+
+func TestFakeAxl_GetLoginUserList(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-LOGIN", server)
+	connection.dbVersion = "12.5"
+	data := connection.GetLoginUserList()
+	if data == nil || len(data.Rows) != 3 {
+		t.Fatalf("not expected login users %v", data)
+	}
+	if data.Rows[2].UserId != "qmadmin" || data.Rows[2].IsLocalUser {
+		t.Errorf("not expected login user %+v", data.Rows[2])
+	}
+}
+
+func TestFakeAxl_SlowResponse(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, Delay: 500 * time.Millisecond})
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	connection := fakeConnection(t, ctx, "FAKE-SLOW", server)
+	start := time.Now()
+	if valid, err := connection.IsLoginValid(); err == nil || valid {
+		t.Errorf("slow response not canceled")
+	}
+	if time.Since(start) > 400*time.Millisecond {
+		t.Errorf("request not canceled by context [%s]", time.Since(start))
+	}
+}
+
+func TestFakeAxl_FaultEscaped(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, Queries: []fakeaxl.Query{{Match: "from device", Fixture: "missing<&>.xml"}}})
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	body := `<soapenv:Envelope><soapenv:Body><ns:executeSQLQuery sequence="1"><sql>select name from device</sql></ns:executeSQLQuery></soapenv:Body></soapenv:Envelope>`
+	response, err := client.Post(fmt.Sprintf("https://%s:%d/axl/", server.Host(), server.Port()), "text/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request to fake AXL failed: %s", err)
+	}
+	defer response.Body.Close()
+	result := NewQueryResult()
+	fault, err := DecodeSoapRows(response.Body, result.rowHandler)
+	if err != nil || fault == nil || !strings.Contains(fault.FaultString, "missing<&>.xml") {
+		t.Errorf("fault with special characters not valid SOAP - %v", err)
+	}
+}
@@ -2,12 +2,25 @@ package main
 
 import (
 	"encoding/xml"
+	"errors"
 	log "github.com/sirupsen/logrus"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
+// ErrAxlNotAuthorized identify AXL user without permission for requested AXL method
+var ErrAxlNotAuthorized = errors.New("AXL user not authorized for request")
+
+// AxlFaultError is SOAP fault returned by CUCM for typed request, transport and HTTP problems are other errors
+type AxlFaultError struct {
+	Fault *FaultMessage
+}
+
+func (e *AxlFaultError) Error() string {
+	return e.Fault.FaultString
+}
+
 type FaultMessage struct {
 	XMLName     xml.Name `xml:"Fault"`
 	FaultCode   string   `xml:"faultcode"`
@@ -38,6 +51,11 @@ func (f *FaultMessage) IsQueryTooLarge() bool {
 	return strings.HasPrefix(f.FaultString, "Query request too large.")
 }
 
+// IsNotAuthorized identify fault for AXL method not allowed by user roles
+func (f *FaultMessage) IsNotAuthorized() bool {
+	return strings.Contains(strings.ToLower(f.FaultString), "not authorized")
+}
+
 func (f *FaultMessage) GetTotals() int {
 	return f.getNumberFromString(1)
 }
@@ -49,6 +67,9 @@ func (f *FaultMessage) GetFetchMax() int {
 func (f *FaultMessage) getNumberFromString(pos int) int {
 	r := regexp.MustCompile(`^[^\d]+(\d+)[^\d]+(\d+).+$`)
 	res := r.FindAllStringSubmatch(f.FaultString, -1)
+	if len(res) < 1 || len(res[0]) <= pos {
+		return 0
+	}
 	i, _ := strconv.Atoi(res[0][pos])
 	return i
 }
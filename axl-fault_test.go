@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestNewFaultMessage(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t       string
+		large   bool
+		totals  int
+		max     int
+		success bool
+		name    string
+	}{
+		{queryTooLargeFault, true, 2500, 1000, true, "query too large"},
+		{authorizationFault, false, 0, 0, true, "other fault"},
+		{"", false, 0, 0, false, "empty body"},
+	}
+	for _, table := range tables {
+		fault, err := NewFaultMessage(table.t)
+		if (err == nil) != table.success {
+			t.Errorf("not expected parse result for [%s]. Error: %v", table.name, err)
+			continue
+		}
+		if fault.IsQueryTooLarge() != table.large {
+			t.Errorf("not expected query too large for [%s]", table.name)
+		}
+		if fault.GetTotals() != table.totals {
+			t.Errorf("not expected totals for [%s] - [%d / %d]", table.name, fault.GetTotals(), table.totals)
+		}
+		if fault.GetFetchMax() != table.max {
+			t.Errorf("not expected fetch max for [%s] - [%d / %d]", table.name, fault.GetFetchMax(), table.max)
+		}
+	}
+}
+
+const (
+	queryTooLargeFault = `<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>Query request too large. Total rows matched: 2500 rows. Suggestive Row Fetch: less than 1000 rows</faultstring><detail><axlError><axlcode>-1</axlcode><axlmessage>Query request too large. Total rows matched: 2500 rows. Suggestive Row Fetch: less than 1000 rows</axlmessage><request>executeSQLQuery</request></axlError></detail></soapenv:Fault>`
+	authorizationFault = `<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>User not authorized for this request</faultstring><detail><axlError><axlcode>-1</axlcode><axlmessage>User not authorized for this request</axlmessage><request>executeSQLQuery</request></axlError></detail></soapenv:Fault>`
+)
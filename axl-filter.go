@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// RowFilter apply configured include/exclude rules to user/device/line rows
+type RowFilter struct {
+	rules []rowFilterRule
+}
+
+type rowFilterRule struct {
+	name    string
+	value   func(row *UserDeviceLine) string
+	match   func(pattern string, value string) bool
+	include []string
+	exclude []string
+}
+
+// NewRowFilter prepare filter from configuration, user ID rules are regular expressions
+func NewRowFilter(c *ConfigFilter) (*RowFilter, error) {
+	regex := map[string]*regexp.Regexp{}
+	for _, expr := range append(append([]string{}, c.UserId.Include...), c.UserId.Exclude...) {
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("user ID filter %s is not valid regular expression: %s", expr, err))
+		}
+		regex[expr] = r
+	}
+	matchRegex := func(pattern string, value string) bool {
+		return regex[pattern].MatchString(value)
+	}
+	matchPrefix := func(pattern string, value string) bool {
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(pattern))
+	}
+	values := map[string]func(row *UserDeviceLine) string{
+		"userId":       func(row *UserDeviceLine) string { return row.UserId },
+		"department":   func(row *UserDeviceLine) string { return row.Department },
+		"devicePrefix": func(row *UserDeviceLine) string { return row.DeviceName },
+		"deviceModel":  func(row *UserDeviceLine) string { return row.DeviceModel },
+		"partition":    func(row *UserDeviceLine) string { return row.Partition },
+	}
+	f := &RowFilter{}
+	for _, r := range c.rules() {
+		if len(r.rule.Include) < 1 && len(r.rule.Exclude) < 1 {
+			continue
+		}
+		rule := rowFilterRule{name: r.name, value: values[r.name], match: strings.EqualFold, include: r.rule.Include, exclude: r.rule.Exclude}
+		switch r.name {
+		case "userId":
+			rule.match = matchRegex
+		case "devicePrefix":
+			rule.match = matchPrefix
+		}
+		f.rules = append(f.rules, rule)
+	}
+	return f, nil
+}
+
+// Excluded return reason why row is not imported, empty string for imported row
+func (f *RowFilter) Excluded(row *UserDeviceLine) string {
+	for _, rule := range f.rules {
+		value := rule.value(row)
+		for _, pattern := range rule.exclude {
+			if rule.match(pattern, value) {
+				return fmt.Sprintf("%s exclude [%s]", rule.name, pattern)
+			}
+		}
+		if len(rule.include) < 1 {
+			continue
+		}
+		included := false
+		for _, pattern := range rule.include {
+			if rule.match(pattern, value) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return fmt.Sprintf("%s not in include [%s]", rule.name, strings.Join(rule.include, ", "))
+		}
+	}
+	return ""
+}
+
+// FilterRows remove rows excluded by filter, every excluded row is logged with rule
+func (u *UserDeviceLineList) FilterRows(filter *RowFilter) {
+	if filter == nil || len(filter.rules) < 1 {
+		return
+	}
+	rows := u.Rows[:0]
+	for i := range u.Rows {
+		row := &u.Rows[i]
+		if reason := filter.Excluded(row); len(reason) > 0 {
+			log.WithFields(log.Fields{"userid": row.UserId, "device": row.DeviceName, "line": row.LineNumber, "partition": row.Partition, "cluster": row.ClusterName}).Infof("row excluded by filter rule %s", reason)
+			continue
+		}
+		rows = append(rows, *row)
+	}
+	log.WithField("removedRows", len(u.Rows)-len(rows)).Infof("From source AXL table filter %d rows", len(u.Rows)-len(rows))
+	u.Rows = rows
+}
+
+// configRowFilter return filter from actual configuration, nil when filter is not valid
+func configRowFilter() *RowFilter {
+	filter, err := NewRowFilter(&config.Filter)
+	if err != nil {
+		log.WithField("error", err).Errorf("row filter not valid, rows are not filtered")
+		return nil
+	}
+	return filter
+}
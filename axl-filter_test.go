@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"go-zqm-axl-importer/fakeaxl"
+	"strings"
+	"testing"
+)
+
+func TestRowFilter_Excluded(t *testing.T) {
+	t.Parallel()
+	row := UserDeviceLine{UserId: "agent01", Department: "Sales", DeviceName: "SEP0011", DeviceModel: "Cisco 8845", Partition: "Internal_PT"}
+	tables := []struct {
+		filter ConfigFilter
+		reason string
+		name   string
+	}{
+		{ConfigFilter{}, "", "empty filter"},
+		{ConfigFilter{UserId: ConfigFilterRule{Exclude: []string{"^test", "^svc_"}}}, "", "user not excluded"},
+		{ConfigFilter{UserId: ConfigFilterRule{Exclude: []string{"^agent0\\d$"}}}, "userId exclude", "user excluded by regex"},
+		{ConfigFilter{UserId: ConfigFilterRule{Include: []string{"^sup"}}}, "userId not in include", "user not included"},
+		{ConfigFilter{Department: ConfigFilterRule{Include: []string{"sales", "support"}}}, "", "department included case insensitive"},
+		{ConfigFilter{Department: ConfigFilterRule{Exclude: []string{"Sales"}}}, "department exclude", "department excluded"},
+		{ConfigFilter{DevicePrefix: ConfigFilterRule{Include: []string{"sep", "csf"}}}, "", "device prefix included"},
+		{ConfigFilter{DevicePrefix: ConfigFilterRule{Exclude: []string{"SEP00"}}}, "devicePrefix exclude [SEP00]", "device prefix excluded"},
+		{ConfigFilter{DeviceModel: ConfigFilterRule{Exclude: []string{"cisco 8845"}}}, "deviceModel exclude", "device model excluded"},
+		{ConfigFilter{DeviceModel: ConfigFilterRule{Exclude: []string{"Cisco 88"}}}, "", "device model is exact"},
+		{ConfigFilter{Partition: ConfigFilterRule{Include: []string{"Lobby_PT"}}}, "partition not in include", "partition not included"},
+		{ConfigFilter{Department: ConfigFilterRule{Include: []string{"Sales"}}, Partition: ConfigFilterRule{Exclude: []string{"internal_pt"}}}, "partition exclude", "second rule excluded"},
+	}
+	for _, table := range tables {
+		filter, err := NewRowFilter(&table.filter)
+		if err != nil {
+			t.Errorf("filter not created for [%s] - %s", table.name, err)
+			continue
+		}
+		reason := filter.Excluded(&row)
+		if (len(table.reason) < 1 && len(reason) > 0) || !strings.HasPrefix(reason, table.reason) {
+			t.Errorf("not expected reason for [%s] - [%s / %s]", table.name, reason, table.reason)
+		}
+	}
+	if _, err := NewRowFilter(&ConfigFilter{UserId: ConfigFilterRule{Include: []string{"("}}}); err == nil {
+		t.Errorf("invalid regular expression accepted")
+	}
+}
+
+func TestFakeAxl_FilterRows(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-FILTER", server)
+	connection.dbVersion = "12.5"
+	data := connection.GetUserDeviceLineList()
+	if data == nil {
+		t.Fatalf("user/device/line list not read")
+	}
+	filter, _ := NewRowFilter(&ConfigFilter{
+		DevicePrefix: ConfigFilterRule{Include: []string{"SEP"}},
+		Partition:    ConfigFilterRule{Exclude: []string{"Lobby_PT"}},
+	})
+	data.FilterRows(filter)
+	var devices []string
+	for _, row := range data.Rows {
+		devices = append(devices, row.DeviceName+"/"+row.LineNumber)
+	}
+	expected := "SEP000000000001/2101,SEP000000000001/2111,SEP000000000002/2102"
+	if strings.Join(devices, ",") != expected {
+		t.Errorf("not expected filtered rows [%s / %s]", strings.Join(devices, ","), expected)
+	}
+}
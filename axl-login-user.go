@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"regexp"
 	"strings"
 )
 
@@ -25,49 +28,200 @@ type LoginUser struct {
 	DirectoryUri string   `xml:"directoryuri" json:"directoryuri"`
 	MailId       string   `xml:"mailid" json:"mailid"`
 	ClusterName  string   `xml:"cluster_name" json:"cluster_name"`
+	AccessGroup  string   `xml:"accessgroup" json:"access_group"` // access control group matched for user
+	DefaultTeam  string   `xml:"-" json:"default_team"`           // default team from matched access group
+	DefaultRole  string   `xml:"-" json:"default_role"`           // default role from matched access group
+}
+
+// AccessGroupMatcher match CUCM access control group names with configured groups in priority order
+type AccessGroupMatcher struct {
+	groups  []ConfigAccessGroup
+	pattern []*regexp.Regexp
+}
+
+func NewAccessGroupMatcher(groups []ConfigAccessGroup) (*AccessGroupMatcher, error) {
+	m := &AccessGroupMatcher{groups: groups, pattern: make([]*regexp.Regexp, len(groups))}
+	for i := range groups {
+		if !groups[i].IsPattern() {
+			continue
+		}
+		r, err := groups[i].Pattern()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("access control group %s is not valid regular expression: %s", groups[i].Name, err))
+		}
+		m.pattern[i] = r
+	}
+	return m, nil
+}
+
+// Match return position of first configured group matching group name, -1 when group not match
+func (m *AccessGroupMatcher) Match(name string) int {
+	for i := range m.groups {
+		if m.pattern[i] != nil {
+			if m.pattern[i].MatchString(name) {
+				return i
+			}
+		} else if m.groups[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// HasPattern identify configuration with wildcard or regex groups, names of groups must be read from CUCM
+func (m *AccessGroupMatcher) HasPattern() bool {
+	for _, p := range m.pattern {
+		if p != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Names return exact group names and matched names from CUCM group list
+func (m *AccessGroupMatcher) Names(cucmGroups []string) []string {
+	var names []string
+	known := map[string]bool{}
+	add := func(name string) {
+		if !known[name] {
+			known[name] = true
+			names = append(names, name)
+		}
+	}
+	for i := range m.groups {
+		if m.pattern[i] == nil {
+			add(m.groups[i].Name)
+		}
+	}
+	for _, name := range cucmGroups {
+		if m.Match(name) > -1 {
+			add(name)
+		}
+	}
+	return names
 }
 
 func NewLoginUserList(response string) (*LoginUserList, error) {
-	var data LoginUserList
-	d := []byte(response)
-	err := xml.Unmarshal(d, &data)
+	data := &LoginUserList{Rows: []LoginUser{}}
+	fault, err := DecodeSoapRows(strings.NewReader(response), data.rowHandler)
+	if err == nil && fault != nil {
+		err = errors.New(fault.FaultString)
+	}
 	if err != nil {
 		log.WithField("error", err).Errorf("problem unmarshal data from response for LoginUser")
-		data = LoginUserList{Rows: []LoginUser{}}
-	} else {
-		log.WithField("data", response).Tracef("use thi list of data")
+		data.Rows = []LoginUser{}
+	}
+	return data, err
+}
 
-		if !config.Processing.CoexistCcxImporter {
-			for i, _ := range data.Rows {
-				data.Rows[i].Uccx = false
+// rowHandler decode one row and add it to list
+func (u *LoginUserList) rowHandler(decoder *xml.Decoder, start *xml.StartElement) error {
+	var row LoginUser
+	if err := decoder.DecodeElement(&row, start); err != nil {
+		return err
+	}
+	if !config.Processing.CoexistCcxImporter {
+		row.Uccx = false
+	}
+	u.Rows = append(u.Rows, row)
+	return nil
+}
+
+// SetClusterName replace cluster name from CUCM by configured name
+func (u *LoginUserList) SetClusterName(name string) {
+	if len(name) < 1 {
+		return
+	}
+	for i := range u.Rows {
+		u.Rows[i].ClusterName = name
+	}
+}
+
+// SetAccessGroups keep one row for user with first matched access group and set group defaults
+func (u *LoginUserList) SetAccessGroups(matcher *AccessGroupMatcher) {
+	best := map[string]int{}
+	position := map[string]int{}
+	var rows []LoginUser
+	for _, row := range u.Rows {
+		priority := matcher.Match(row.AccessGroup)
+		if priority < 0 {
+			continue
+		}
+		row.DefaultTeam = matcher.groups[priority].Team
+		row.DefaultRole = matcher.groups[priority].Role
+		if p, ok := best[row.UserPKID]; ok {
+			if priority < p {
+				best[row.UserPKID] = priority
+				rows[position[row.UserPKID]] = row
 			}
-			log.Tracef("remove UCCX Integration value, because coexist CCX Importer not used")
+			continue
 		}
+		best[row.UserPKID] = priority
+		position[row.UserPKID] = len(rows)
+		rows = append(rows, row)
 	}
-	return &data, err
+	if rows == nil {
+		rows = []LoginUser{}
+	}
+	u.Rows = rows
+}
+
+// accessGroupMatcher return matcher and names of access control groups for login users SQL
+func (s *Connection) accessGroupMatcher() (*AccessGroupMatcher, []string, error) {
+	matcher, err := NewAccessGroupMatcher(s.accessGroups())
+	if err != nil {
+		return nil, nil, err
+	}
+	var cucmGroups []string
+	if matcher.HasPattern() {
+		result := NewQueryResult()
+		if err := NewRequest(s.client, s).SqlRowsRequest(NewAccessGroupSql().ToString(), result.rowHandler); err != nil {
+			log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read access control groups from AXL")
+			return nil, nil, err
+		}
+		for _, row := range result.Rows {
+			cucmGroups = append(cucmGroups, row["name"])
+		}
+	}
+	names := matcher.Names(cucmGroups)
+	log.WithFields(log.Fields{"id": s.id, "groups": strings.Join(names, ", ")}).Debugf("login users from %d access control groups", len(names))
+	return matcher, names, nil
 }
 
 func (s *Connection) GetLoginUserList() *LoginUserList {
 	log.WithField("id", s.id).Trace("get table with login user details from AXL")
-	sql := NewLoginUserSql(config.Axl.AccessGroup)
+	if s.useTypedApi() {
+		return s.getTypedLoginUserList()
+	}
+	matcher, groups, err := s.accessGroupMatcher()
+	if err != nil {
+		if s.switchToTypedApi(err) {
+			return s.getTypedLoginUserList()
+		}
+		return nil
+	}
+	if len(groups) < 1 {
+		log.WithField("id", s.id).Warningf("no access control group on CUCM match configured groups")
+		return &LoginUserList{Rows: []LoginUser{}}
+	}
+	sql := NewLoginUserSql(groups)
 	if !sql.IsParametersValid() {
 		log.WithField("id", s.id).Errorf("Not valid request parameters for access control group name")
 		return nil
 	}
 	request := NewRequest(s.client, s)
-	log.WithFields(log.Fields{"id": s.id, "sql": sql.ToString()}).Debugf("Request for %s", strings.Join(config.Zqm.JtapiUser, ","))
-	response := request.SqlRequest(sql.ToString())
-	msg, err := response.ResponseError()
-	if err != nil {
-		response.Close()
-		log.WithField("id", s.id).Errorf("%s. HTTP Status [%s]", msg, response.statusMessage)
-		return nil
-	}
-	data, err := NewLoginUserList(response.GetResponseBody())
+	log.WithFields(log.Fields{"id": s.id, "sql": sql.ToString()}).Debugf("Request for %s", strings.Join(groups, ","))
+	data := &LoginUserList{Rows: []LoginUser{}}
+	err = request.SqlRowsRequest(sql.ToString(), data.rowHandler)
 	if err != nil {
-		log.WithField("id", s.id).Errorf("Can't convert returned data to Version structure")
+		if s.switchToTypedApi(err) {
+			return s.getTypedLoginUserList()
+		}
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read login user list from AXL")
 		return nil
 	}
-	log.WithField("id", s.id).Trace("Success read DB version from AXL")
+	data.SetAccessGroups(matcher)
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read login user list from AXL")
 	return data
 }
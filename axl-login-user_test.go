@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"go-zqm-axl-importer/fakeaxl"
+	"strings"
+	"testing"
+)
+
+func TestAccessGroupMatcher_Names(t *testing.T) {
+	t.Parallel()
+	matcher, err := NewAccessGroupMatcher([]ConfigAccessGroup{{Name: "QM Access"}, {Name: "qm access site*"}, {Name: "^QM (Evaluators|Supervisors)$", Regex: true}})
+	if err != nil {
+		t.Fatalf("matcher not created: %s", err)
+	}
+	names := matcher.Names([]string{"QM Access", "QM Access Site B", "QM Evaluators", "Standard CCM End Users"})
+	if strings.Join(names, ",") != "QM Access,QM Access Site B,QM Evaluators" {
+		t.Errorf("not expected group names %v", names)
+	}
+	if matcher.Match("qm access") != -1 || matcher.Match("QM Access") != 0 || matcher.Match("QM Supervisors") != 2 {
+		t.Errorf("not expected group priority")
+	}
+	if _, err := NewAccessGroupMatcher([]ConfigAccessGroup{{Name: "(", Regex: true}}); err == nil {
+		t.Errorf("invalid regular expression accepted")
+	}
+}
+
+func TestLoginUserList_SetAccessGroups(t *testing.T) {
+	t.Parallel()
+	matcher, _ := NewAccessGroupMatcher([]ConfigAccessGroup{{Name: "QM Site A", Team: "Site A"}, {Name: "QM Site *", Team: "Sites", Role: "Agent"}})
+	data := &LoginUserList{Rows: []LoginUser{
+		{UserPKID: "p1", AccessGroup: "QM Site B"},
+		{UserPKID: "p1", AccessGroup: "QM Site A"},
+		{UserPKID: "p2", AccessGroup: "QM Site C"},
+		{UserPKID: "p3", AccessGroup: "Other"},
+	}}
+	data.SetAccessGroups(matcher)
+	if len(data.Rows) != 2 {
+		t.Fatalf("not expected rows %v", data.Rows)
+	}
+	if data.Rows[0].AccessGroup != "QM Site A" || data.Rows[0].DefaultTeam != "Site A" || data.Rows[0].DefaultRole != "" {
+		t.Errorf("user not tagged with first group %+v", data.Rows[0])
+	}
+	if data.Rows[1].AccessGroup != "QM Site C" || data.Rows[1].DefaultTeam != "Sites" || data.Rows[1].DefaultRole != "Agent" {
+		t.Errorf("user not tagged with wildcard group %+v", data.Rows[1])
+	}
+}
+
+func TestFakeAxl_GetLoginUserListPattern(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures})
+	defer server.Close()
+	cluster := fakeCluster("FAKE-LOGIN-GROUPS", server)
+	cluster.AccessGroup = ""
+	cluster.AccessGroups = []ConfigAccessGroup{{Name: "QM Access*", Team: "Access"}}
+	connection, err := NewClusterConnection(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("connection to fake AXL not created: %s", err)
+	}
+	connection.dbVersion = "12.5"
+	data := connection.GetLoginUserList()
+	if data == nil || len(data.Rows) != 3 {
+		t.Fatalf("not expected login users %v", data)
+	}
+	if data.Rows[0].AccessGroup != "QM Access" || data.Rows[0].DefaultTeam != "Access" {
+		t.Errorf("login user not tagged with access group %+v", data.Rows[0])
+	}
+	if server.Requests("executeSQLQuery") != 2 {
+		t.Errorf("access control groups not read from CUCM [%d requests]", server.Requests("executeSQLQuery"))
+	}
+}
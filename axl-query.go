@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	QueryFormatTable = "table"
+	QueryFormatCsv   = "csv"
+	QueryFormatJson  = "json"
+)
+
+// QueryResult is generic result of AXL SQL query, columns are in order of first occurrence in rows
+type QueryResult struct {
+	Columns []string
+	Rows    []map[string]string
+	known   map[string]bool
+}
+
+type queryRow struct {
+	Fields []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func NewQueryResult() *QueryResult {
+	return &QueryResult{Columns: []string{}, Rows: []map[string]string{}, known: map[string]bool{}}
+}
+
+func (q *QueryResult) rowHandler(decoder *xml.Decoder, start *xml.StartElement) error {
+	var row queryRow
+	if err := decoder.DecodeElement(&row, start); err != nil {
+		return err
+	}
+	data := make(map[string]string, len(row.Fields))
+	for _, field := range row.Fields {
+		name := field.XMLName.Local
+		if !q.known[name] {
+			q.known[name] = true
+			q.Columns = append(q.Columns, name)
+		}
+		data[name] = field.Value
+	}
+	q.Rows = append(q.Rows, data)
+	return nil
+}
+
+// Write print result in table, csv or json format
+func (q *QueryResult) Write(w io.Writer, format string) error {
+	switch format {
+	case QueryFormatTable:
+		return q.WriteTable(w)
+	case QueryFormatCsv:
+		return q.WriteCsv(w)
+	case QueryFormatJson:
+		return q.WriteJson(w)
+	}
+	return errors.New(fmt.Sprintf("output format %s not supported", format))
+}
+
+func (q *QueryResult) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.Join(q.Columns, "\t"))
+	dashes := make([]string, len(q.Columns))
+	for i, c := range q.Columns {
+		dashes[i] = strings.Repeat("-", len(c))
+	}
+	_, _ = fmt.Fprintln(tw, strings.Join(dashes, "\t"))
+	for _, row := range q.Rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(q.values(row), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "(%d rows)\n", len(q.Rows))
+	return err
+}
+
+func (q *QueryResult) WriteCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(q.Columns); err != nil {
+		return err
+	}
+	for _, row := range q.Rows {
+		if err := cw.Write(q.values(row)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (q *QueryResult) WriteJson(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(q.Rows)
+}
+
+func (q *QueryResult) values(row map[string]string) []string {
+	data := make([]string, len(q.Columns))
+	for i, c := range q.Columns {
+		data[i] = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(row[c])
+	}
+	return data
+}
+
+// Query run ad-hoc SQL on AXL, too large result is read by pages (SQL need stable ORDER BY)
+func (s *Connection) Query(sql string) (*QueryResult, error) {
+	result := NewQueryResult()
+	if err := NewRequest(s.client, s).SqlRowsRequest(sql, result.rowHandler); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// queryCluster return configured cluster by name, empty name return first cluster
+func queryCluster(name string) (*ConfigAxl, error) {
+	clusters := config.AxlClusters()
+	for i := range clusters {
+		if len(name) < 1 || strings.EqualFold(clusters[i].ClusterKey(), name) {
+			return &clusters[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("cluster %s not configured", name))
+}
+
+// runAxlQuery run SQL on configured cluster and print result
+func runAxlQuery(ctx context.Context, w io.Writer, clusterName string, sql string, format string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.AxlTimeout)*time.Minute)
+	defer cancel()
+	cluster, err := queryCluster(clusterName)
+	if err != nil {
+		return err
+	}
+	connection, err := NewClusterConnection(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	defer connection.storeClusterState()
+	if valid, err := connection.IsLoginValid(); !valid {
+		if err == nil {
+			err = errors.New("AXL login not valid")
+		}
+		return err
+	}
+	if db, err := connection.DbVersion(); err != nil || db == DbVersionError {
+		return errors.New("AXL DB version not supported")
+	}
+	log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "sql": sql}).Info("run AXL query")
+	result, err := connection.Query(sql)
+	if err != nil {
+		return err
+	}
+	return result.Write(w, format)
+}
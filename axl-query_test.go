@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"go-zqm-axl-importer/fakeaxl"
+	"strings"
+	"testing"
+)
+
+const queryResponse = `<return><row><pkid>p1</pkid><dnorpattern>2101</dnorpattern></row>` +
+	`<row><pkid>p2</pkid><dnorpattern>2102</dnorpattern><description>desk, "2"</description></row></return>`
+
+func TestQueryResult_Write(t *testing.T) {
+	t.Parallel()
+	result := NewQueryResult()
+	if _, err := DecodeSoapRows(soapResponse(200, queryResponse).Body, result.rowHandler); err != nil {
+		t.Fatalf("rows not decoded: %s", err)
+	}
+	if strings.Join(result.Columns, ",") != "pkid,dnorpattern,description" {
+		t.Errorf("not expected columns %v", result.Columns)
+	}
+	tables := []struct {
+		format   string
+		expected string
+	}{
+		{QueryFormatTable, "pkid  dnorpattern  description\n----  -----------  -----------\np1    2101         \np2    2102         desk, \"2\"\n(2 rows)\n"},
+		{QueryFormatCsv, "pkid,dnorpattern,description\np1,2101,\np2,2102,\"desk, \"\"2\"\"\"\n"},
+		{QueryFormatJson, "[\n  {\n    \"dnorpattern\": \"2101\",\n    \"pkid\": \"p1\"\n  },\n  {\n    \"description\": \"desk, \\\"2\\\"\",\n    \"dnorpattern\": \"2102\",\n    \"pkid\": \"p2\"\n  }\n]\n"},
+	}
+	for _, table := range tables {
+		var b bytes.Buffer
+		if err := result.Write(&b, table.format); err != nil {
+			t.Errorf("result not written for [%s] - %s", table.format, err)
+			continue
+		}
+		if b.String() != table.expected {
+			t.Errorf("not expected output for [%s]:\n%s", table.format, b.String())
+		}
+	}
+	if err := result.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Errorf("not supported format accepted")
+	}
+}
+
+func TestFakeAxl_Query(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures, FetchMax: 2})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-QUERY", server)
+	connection.dbVersion = "12.5"
+	result, err := connection.Query("select pkid, dnorpattern, description from numplan order by pkid")
+	if err != nil {
+		t.Fatalf("query not processed: %s", err)
+	}
+	if len(result.Rows) != 3 || len(result.Columns) != 3 || result.Rows[2]["dnorpattern"] != "2102" {
+		t.Errorf("not expected query result %v", result.Rows)
+	}
+	if server.Requests("executeSQLQuery") != 4 {
+		t.Errorf("query not paged [%d requests]", server.Requests("executeSQLQuery"))
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -38,7 +40,7 @@ func (s *Request) getCmVersionBody() string {
 
 func (s *Request) getSqlRequestBody(sql string) string {
 	s.connection.sequence++
-	return fmt.Sprintf(xmlHeaderFormat+sqlRequest, s.connection.dbVersion, s.connection.sequence, sql)
+	return fmt.Sprintf(xmlHeaderFormat+sqlRequest, s.connection.dbVersion, s.connection.sequence, xmlEscape(sql))
 }
 
 func (s *Request) DbVersionRequest() *Response {
@@ -46,9 +48,11 @@ func (s *Request) DbVersionRequest() *Response {
 	return s.doAxlRequest(sql)
 }
 
+// SqlPagingGenerate split one select to list of selects with SKIP/LIMIT. Select must have stable ORDER BY.
 func (s *Request) SqlPagingGenerate(sql string, size int, total int) []string {
 	var data []string
-	if size >= total {
+	sql = strings.TrimSpace(sql)
+	if size < 1 || size >= total || !strings.HasPrefix(strings.ToLower(sql), "select") {
 		data = append(data, sql)
 	} else {
 		loop := total / size
@@ -57,7 +61,7 @@ func (s *Request) SqlPagingGenerate(sql string, size int, total int) []string {
 		}
 		selectNext := sql[len("select"):]
 		for i := 0; i < loop; i++ {
-			data = append(data, fmt.Sprintf("SELECT SKIP %d LIMIT %d %s", loop*size, size, selectNext))
+			data = append(data, fmt.Sprintf("SELECT SKIP %d LIMIT %d %s", i*size, size, selectNext))
 		}
 	}
 
@@ -69,6 +73,29 @@ func (s *Request) SqlRequest(sql string) *Response {
 	return s.doAxlRequest(d)
 }
 
+// SqlRowsRequest run SQL request and pass returned rows to handler. When AXL response is "Query request too large"
+// request is automatically split to pages.
+func (s *Request) SqlRowsRequest(sql string, handler RowHandler) error {
+	response := s.SqlRequest(sql)
+	if response.statusCode == 200 {
+		return response.DecodeRows(handler)
+	}
+	msg, err := response.ResponseError()
+	response.Close()
+	if err == nil {
+		err = errors.New(msg)
+	}
+	if response.IsNotAuthorized() {
+		log.WithFields(log.Fields{"id": s.id, "server": s.connection.server}).Warningf("%s. HTTP Status [%s]", msg, response.statusMessage)
+		return fmt.Errorf("%w: %s", ErrAxlNotAuthorized, msg)
+	}
+	if response.fault == nil || !response.fault.IsQueryTooLarge() {
+		log.WithFields(log.Fields{"id": s.id, "server": s.connection.server}).Errorf("%s. HTTP Status [%s]", msg, response.statusMessage)
+		return err
+	}
+	return s.doPageAxlRequest(sql, response.fault, handler)
+}
+
 func (s *Connection) authorization() string {
 	auth := s.user + ":" + s.pwd
 	return base64.StdEncoding.EncodeToString([]byte(auth))
@@ -86,15 +113,19 @@ func (s *Request) setHeader() {
 }
 
 func (s *Connection) urlString() string {
-	urlName := fmt.Sprintf("https://%s:8443/axl/", s.server)
+	urlName := fmt.Sprintf("https://%s:%d/axl/", s.server, s.port)
 	log.WithFields(log.Fields{"id": s.id, "server": s.server}).Tracef("Request URI: %s", urlName)
 	return urlName
 }
 
 func (s *Request) Client() {
 	if s.client == nil {
+		tlsConfig := s.connection.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
 		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			TLSClientConfig: tlsConfig,
 		}
 		s.client = &http.Client{Timeout: time.Duration(s.connection.timeOut) * time.Second, Transport: tr}
 	}
@@ -111,10 +142,53 @@ func (s *Request) finishRequest() *Response {
 	return s.NewAxlResponse(resp, nil, "")
 }
 
+// doAxlRequest send request with retry policy, temporary problems are repeated with exponential backoff
 func (s *Request) doAxlRequest(body string) *Response {
+	for attempt := 1; ; attempt++ {
+		if err := s.connection.limiter.Wait(s.connection.ctx); err != nil {
+			return s.NewAxlResponse(nil, err, "Request cancelled")
+		}
+		resp := s.doFailoverAxlRequest(body)
+		if attempt >= s.connection.retry.MaxAttempts || s.connection.ctx.Err() != nil || !resp.IsRetryable() {
+			return resp
+		}
+		delay := s.connection.retry.Delay(attempt)
+		log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "attempt": attempt, "status": resp.statusMessage}).Warningf("temporary AXL problem, repeat request after %s", delay)
+		resp.Close()
+		if err := sleepContext(s.connection.ctx, delay); err != nil {
+			return s.NewAxlResponse(nil, err, "Request cancelled")
+		}
+	}
+}
+
+// doFailoverAxlRequest send request to active node, on connection problem or 503 try next nodes
+func (s *Request) doFailoverAxlRequest(body string) *Response {
+	var resp *Response
+	for i := 0; i < len(s.connection.nodes); i++ {
+		resp = s.doNodeAxlRequest(body)
+		if s.connection.ctx.Err() != nil {
+			return resp
+		}
+		if !resp.IsNodeFailure() {
+			log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "port": s.connection.port}).Debugf("AXL node %s answered", s.connection.nodes[s.connection.node].String())
+			return resp
+		}
+		resp.Close()
+		if len(s.connection.nodes) > 1 {
+			s.connection.nextNode()
+		}
+	}
+	if resp == nil {
+		return s.NewAxlResponse(nil, errors.New("AXL nodes not defined"), "AXL nodes not defined")
+	}
+	log.WithFields(log.Fields{"id": s.id, "nodes": len(s.connection.nodes)}).Errorf("no AXL node available")
+	return resp
+}
+
+func (s *Request) doNodeAxlRequest(body string) *Response {
 	log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "body": ShortBody(body)}).Trace("Process AXL request")
 
-	req, err := http.NewRequest("POST", s.connection.urlString(), bytes.NewBuffer([]byte(body)))
+	req, err := http.NewRequestWithContext(s.connection.ctx, "POST", s.connection.urlString(), bytes.NewBuffer([]byte(body)))
 	if err != nil {
 		log.WithFields(log.Fields{"id": s.id, "error": err, "server": s.connection.server}).Errorf("Problem create new POST request.")
 		return s.NewAxlResponse(nil, err, "Problem create new POST request.")
@@ -124,6 +198,30 @@ func (s *Request) doAxlRequest(body string) *Response {
 	return s.finishRequest()
 }
 
-func (s *Request) doPageAxlRequest() {
-
+func (s *Request) doPageAxlRequest(sql string, fault *FaultMessage, handler RowHandler) error {
+	total := fault.GetTotals()
+	size := fault.GetFetchMax() - 1
+	if total < 1 || size < 1 {
+		log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "fault": fault.FaultString}).Errorf("can't identify rows for paging")
+		return errors.New("can't identify number of rows for paging from AXL fault")
+	}
+	pages := s.SqlPagingGenerate(sql, size, total)
+	log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "total": total, "pageSize": size}).Infof("query request too large, split to %d pages", len(pages))
+	for i, page := range pages {
+		response := s.SqlRequest(page)
+		if response.statusCode != 200 {
+			msg, err := response.ResponseError()
+			response.Close()
+			if err == nil {
+				err = errors.New(msg)
+			}
+			log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "page": i + 1}).Errorf("%s. HTTP Status [%s]", msg, response.statusMessage)
+			return err
+		}
+		if err := response.DecodeRows(handler); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "page": i + 1}).Tracef("success read page %d/%d", i+1, len(pages))
+	}
+	return nil
 }
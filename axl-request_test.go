@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(r *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+func TestRequest_SqlPagingGenerate(t *testing.T) {
+	t.Parallel()
+	request := NewRequest(nil, NewConnection("localhost", "user", "pwd"))
+	tables := []struct {
+		sql   string
+		size  int
+		total int
+		pages []string
+		name  string
+	}{
+		{"select a from b", 10, 5, []string{"select a from b"}, "one page"},
+		{"select a from b", 0, 5, []string{"select a from b"}, "zero size"},
+		{"update b set a = 1", 2, 5, []string{"update b set a = 1"}, "not select"},
+		{"select a from b", 10, 20, []string{"SELECT SKIP 0 LIMIT 10  a from b", "SELECT SKIP 10 LIMIT 10  a from b"}, "two full pages"},
+		{" select a from b", 10, 21, []string{"SELECT SKIP 0 LIMIT 10  a from b", "SELECT SKIP 10 LIMIT 10  a from b", "SELECT SKIP 20 LIMIT 10  a from b"}, "last short page"},
+	}
+	for _, table := range tables {
+		pages := request.SqlPagingGenerate(table.sql, table.size, table.total)
+		if len(pages) != len(table.pages) {
+			t.Errorf("not expected number of pages for [%s] - [%d / %d]", table.name, len(pages), len(table.pages))
+			continue
+		}
+		for i, page := range pages {
+			if page != table.pages[i] {
+				t.Errorf("not expected page %d for [%s] - [%s / %s]", i, table.name, page, table.pages[i])
+			}
+		}
+	}
+}
+
+func TestConnection_GetUserDeviceLineListPaging(t *testing.T) {
+	t.Parallel()
+	const total = 25
+	var requests int
+	skip := regexp.MustCompile(`SELECT SKIP (\d+) LIMIT (\d+)`)
+	connection := NewConnection("localhost", "user", "pwd")
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		page := skip.FindStringSubmatch(string(body))
+		if page == nil {
+			fault := strings.ReplaceAll(queryTooLargeFault, "2500", strconv.Itoa(total))
+			return soapResponse(500, strings.ReplaceAll(fault, "1000", "11"))
+		}
+		from, _ := strconv.Atoi(page[1])
+		size, _ := strconv.Atoi(page[2])
+		rows := strings.Builder{}
+		for i := from; i < from+size && i < total; i++ {
+			rows.WriteString(fmt.Sprintf("<row><user_pkid>u%02d</user_pkid><device_pkid>d%02d</device_pkid><line_pkid>l%02d</line_pkid></row>", i, i, i))
+		}
+		return soapResponse(200, "<return>"+rows.String()+"</return>")
+	})})
+
+	list := connection.GetUserDeviceLineList()
+	if list == nil {
+		t.Fatalf("paged request not return data")
+	}
+	if len(list.Rows) != total {
+		t.Errorf("not expected number of merged rows [%d / %d]", len(list.Rows), total)
+	}
+	if requests != 4 {
+		t.Errorf("not expected number of AXL requests [%d / %d]", requests, 4)
+	}
+	for i, row := range list.Rows {
+		if row.UserPKID != fmt.Sprintf("u%02d", i) {
+			t.Errorf("not expected order of merged rows on position %d [%s]", i, row.UserPKID)
+			break
+		}
+	}
+}
+
+func soapResponse(status int, body string) *http.Response {
+	envelope := `<?xml version='1.0' encoding='UTF-8'?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>` +
+		body + `</soapenv:Body></soapenv:Envelope>`
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Body:       ioutil.NopCloser(strings.NewReader(envelope)),
+		Header:     make(http.Header),
+	}
+}
+
+func TestRequest_doAxlRequestFailover(t *testing.T) {
+	t.Parallel()
+	var hosts []string
+	nodes := []ConfigAxlNode{{Server: "pub", Port: 8443}, {Server: "sub1", Port: 9443}, {Server: "sub2", Port: 8443}}
+	connection := NewNodesConnection(nodes, "user", "pwd")
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		hosts = append(hosts, r.URL.Host)
+		if r.URL.Host == "pub:8443" {
+			return soapResponse(503, "")
+		}
+		return soapResponse(200, "<return/>")
+	})})
+
+	for i := 0; i < 2; i++ {
+		resp := NewRequest(connection.client, connection).SqlRequest("select 1 from dual")
+		if resp.statusCode != 200 {
+			t.Errorf("not expected status code %d on request %d", resp.statusCode, i)
+		}
+		resp.Close()
+	}
+	expect := []string{"pub:8443", "sub1:9443", "sub1:9443"}
+	if strings.Join(hosts, ",") != strings.Join(expect, ",") {
+		t.Errorf("not expected used nodes [%s / %s]", strings.Join(hosts, ","), strings.Join(expect, ","))
+	}
+	if connection.ActiveNode() != 1 {
+		t.Errorf("not expected active node %d", connection.ActiveNode())
+	}
+}
@@ -6,7 +6,6 @@ import (
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
-	"strings"
 )
 
 type Response struct {
@@ -17,6 +16,7 @@ type Response struct {
 	body          string
 	statusCode    int
 	statusMessage string
+	fault         *FaultMessage
 }
 
 func (s *Request) NewAxlResponse(r *http.Response, e error, message string) *Response {
@@ -63,25 +63,32 @@ func (r *Response) responseReturnData() error {
 }
 
 func (r *Response) getReturnPart(body string) {
-	r.getBetween(body, "<return>", "</return>", "<return/>")
+	r.body = soapElement(body, "return")
 }
 
 func (r *Response) getFailurePart(body string) {
-	r.getBetween(body, "<soapenv:Fault>", "</soapenv:Fault>", "<soapenv:Fault/>")
+	r.body = soapElement(body, "Fault")
 }
 
-func (r *Response) getBetween(body string, start string, end string, short string) {
-	if strings.Index(body, start) > -1 {
-		body = body[strings.Index(body, start):]
-	} else if strings.Index(body, short) > -1 {
-		r.body = short
-		return
+// DecodeRows stream response body and pass rows to handler, fault in body is returned as error
+func (r *Response) DecodeRows(handler RowHandler) error {
+	if r.response == nil || r.response.Body == nil {
+		return errors.New("response body not available")
 	}
-	r.body = ""
-	if strings.Index(body, end) < 0 {
-		return
+	defer r.Close()
+	fault, err := DecodeSoapRows(r.response.Body, handler)
+	if err != nil {
+		log.WithFields(log.Fields{"id": r.id, "error": err}).Errorf("problem decode rows from response")
+		r.err = err
+		return err
 	}
-	r.body = body[:strings.Index(body, end)] + end
+	if fault != nil {
+		r.fault = fault
+		r.err = errors.New(fault.FaultString)
+		return r.err
+	}
+	log.WithField("id", r.id).Trace("Rows decode success")
+	return nil
 }
 
 func (r *Response) ResponseError() (string, error) {
@@ -106,6 +113,7 @@ func (r *Response) ResponseError() (string, error) {
 		if err != nil {
 			return "problem analyze fail response message", err
 		}
+		r.fault = fault
 		if fault.IsQueryTooLarge() {
 			r.err = errors.New(fault.FaultString)
 			return fault.FaultString, r.err
@@ -117,6 +125,50 @@ func (r *Response) ResponseError() (string, error) {
 	return fmt.Sprintf("Unspecific request problem HTTP status %s", r.statusMessage), r.err
 }
 
+// IsNodeFailure identify response when node is not able process request and next node can be used
+func (r *Response) IsNodeFailure() bool {
+	return r.err != nil || r.statusCode == http.StatusServiceUnavailable
+}
+
+// IsNotAuthorized identify response for AXL method not allowed for user, must be called after ResponseError
+func (r *Response) IsNotAuthorized() bool {
+	return r.statusCode == http.StatusForbidden || (r.fault != nil && r.fault.IsNotAuthorized())
+}
+
+// IsRetryable identify temporary problem, fault body is read for analyze
+func (r *Response) IsRetryable() bool {
+	if r.IsNodeFailure() {
+		return true
+	}
+	switch r.statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	case http.StatusInternalServerError:
+		fault, err := NewFaultMessage(r.GetResponseBody())
+		if err != nil {
+			return false
+		}
+		r.fault = fault
+		return fault.IsRetryable()
+	}
+	return false
+}
+
+// GetRawBody return complete response body, used for responses without <return> element
+func (r *Response) GetRawBody() (string, error) {
+	if r.response == nil || r.response.Body == nil {
+		return "", errors.New("response body not available")
+	}
+	defer r.Close()
+	bodies, err := ioutil.ReadAll(r.response.Body)
+	if err != nil {
+		log.WithFields(log.Fields{"id": r.id, "error": err}).Errorf("Problem get body from response.")
+		r.err = err
+		return "", err
+	}
+	return string(bodies), nil
+}
+
 func (r *Response) GetResponseBody() string {
 	if r.response == nil {
 		return r.body
@@ -125,5 +177,6 @@ func (r *Response) GetResponseBody() string {
 	if err != nil {
 		r.err = err
 	}
+	r.response = nil
 	return r.body
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fault messages from CUCM for temporary problems, request can be repeated later.
+// AXL throttling is reported by HTTP 503/429 status, only memory limit comes as SOAP fault
+var retryableFaults = []string{
+	"Maximum AXL Memory Allocation Consumed", // AXL memory allocation limit exceeded by concurrent requests
+}
+
+type RetryPolicy struct {
+	MaxAttempts  int           // maximal number of attempts for one request
+	InitialDelay time.Duration // delay before second attempt
+	MaxDelay     time.Duration // maximal delay between attempts
+}
+
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRetryPolicy(cfg ConfigAxlRetry) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:  cfg.MaxAttempts,
+		InitialDelay: time.Duration(cfg.InitialDelay) * time.Second,
+		MaxDelay:     time.Duration(cfg.MaxDelay) * time.Second,
+	}
+}
+
+// Delay return exponential backoff with jitter for attempt (first attempt is 1)
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 || p.InitialDelay <= 0 {
+		return 0
+	}
+	delay := p.InitialDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// NewRateLimiter create limiter for maximal requests per minute, zero or less disable limit
+func NewRateLimiter(perMinute int) *RateLimiter {
+	if perMinute < 1 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// Wait block until next request can be send or context is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+		l.next = now
+	}
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	return sleepContext(ctx, wait)
+}
+
+// sleepContext wait for duration, return error when context is done before
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsRetryable identify temporary fault
+func (f *FaultMessage) IsRetryable() bool {
+	for _, msg := range retryableFaults {
+		if strings.Contains(f.FaultString, msg) || strings.Contains(f.Detail.AxlError.AxlMessage, msg) {
+			return true
+		}
+	}
+	return false
+}
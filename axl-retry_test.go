@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	t.Parallel()
+	policy := RetryPolicy{MaxAttempts: 5, InitialDelay: 2 * time.Second, MaxDelay: 10 * time.Second}
+	tables := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 0},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, table := range tables {
+		for i := 0; i < 20; i++ {
+			delay := policy.Delay(table.attempt)
+			if delay > table.max || delay < table.max/2 {
+				t.Errorf("delay %s for attempt %d out of range (%s-%s)", delay, table.attempt, table.max/2, table.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	t.Parallel()
+	var disabled *RateLimiter
+	if disabled.Wait(context.Background()) != nil {
+		t.Errorf("disabled rate limiter return error")
+	}
+	if NewRateLimiter(0) != nil {
+		t.Errorf("rate limiter not disabled for zero limit")
+	}
+	limiter := NewRateLimiter(60 * 100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_ = limiter.Wait(context.Background())
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Errorf("rate limiter not pace requests, 6 requests in %s", time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := NewRateLimiter(1)
+	_ = slow.Wait(ctx)
+	if slow.Wait(ctx) == nil {
+		t.Errorf("rate limiter wait not stopped by cancelled context")
+	}
+}
+
+func TestFaultMessage_IsRetryable(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t     string
+		retry bool
+		name  string
+	}{
+		{memoryFault, true, "memory allocation"},
+		{queryTooLargeFault, false, "query too large"},
+		{authorizationFault, false, "authorization"},
+	}
+	for _, table := range tables {
+		fault, _ := NewFaultMessage(table.t)
+		if fault.IsRetryable() != table.retry {
+			t.Errorf("not expected retry classification for [%s]", table.name)
+		}
+	}
+}
+
+func TestRequest_doAxlRequestRetry(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		responses []int
+		fault     string
+		attempts  int
+		status    int
+		name      string
+	}{
+		{[]int{503, 503, 200}, "", 3, 200, "temporary unavailable"},
+		{[]int{500, 200}, memoryFault, 2, 200, "memory allocation fault"},
+		{[]int{500, 200}, authorizationFault, 1, 500, "fatal fault"},
+		{[]int{401, 200}, "", 1, 401, "authorization"},
+		{[]int{503, 503, 503, 503}, "", 3, 503, "attempts exhausted"},
+	}
+	for _, table := range tables {
+		var requests int
+		responses := table.responses
+		fault := table.fault
+		connection := NewConnection("localhost", "user", "pwd")
+		connection.dbVersion = "12.0"
+		connection.SetRetry(&RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}, nil)
+		connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+			status := responses[requests]
+			requests++
+			if status == 500 {
+				return soapResponse(status, fault)
+			}
+			return soapResponse(status, "<return/>")
+		})})
+		resp := NewRequest(connection.client, connection).SqlRequest("select 1 from dual")
+		resp.Close()
+		if requests != table.attempts {
+			t.Errorf("not expected attempts for [%s] - [%d / %d]", table.name, requests, table.attempts)
+		}
+		if resp.statusCode != table.status {
+			t.Errorf("not expected final status for [%s] - [%d / %d]", table.name, resp.statusCode, table.status)
+		}
+	}
+}
+
+func TestRequest_doAxlRequestCancel(t *testing.T) {
+	t.Parallel()
+	var requests int
+	ctx, cancel := context.WithCancel(context.Background())
+	connection := NewConnection("localhost", "user", "pwd")
+	connection.dbVersion = "12.0"
+	connection.SetContext(ctx)
+	connection.SetRetry(&RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour}, nil)
+	connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		requests++
+		cancel()
+		return soapResponse(503, "<return/>")
+	})})
+	start := time.Now()
+	resp := NewRequest(connection.client, connection).SqlRequest("select 1 from dual")
+	resp.Close()
+	if requests != 1 {
+		t.Errorf("request repeated after context cancel - [%d]", requests)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("retry delay not interrupted by context cancel")
+	}
+}
+
+var memoryFault = strings.ReplaceAll(authorizationFault, "User not authorized for this request", "Maximum AXL Memory Allocation Consumed")
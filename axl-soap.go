@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// RowHandler process one <row> element from AXL response, handler must consume element by decoder
+type RowHandler func(decoder *xml.Decoder, start *xml.StartElement) error
+
+// DecodeSoapRows stream SOAP envelope and pass every <row> from <return> to handler.
+// Tags are matched by local name, namespace prefix (axl:return, soapenv:Fault) is ignored.
+// When body contains Fault, fault is returned and rows are not processed.
+func DecodeSoapRows(r io.Reader, handler RowHandler) (*FaultMessage, error) {
+	decoder := xml.NewDecoder(r)
+	inReturn := false
+	foundReturn := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "Fault":
+				var fault FaultMessage
+				if err := decoder.DecodeElement(&fault, &t); err != nil {
+					return nil, err
+				}
+				return &fault, nil
+			case t.Name.Local == "return" && !inReturn:
+				inReturn = true
+				foundReturn = true
+			case t.Name.Local == "row" && inReturn:
+				if err := handler(decoder, &t); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "return" {
+				inReturn = false
+			}
+		}
+	}
+	if !foundReturn {
+		return nil, errors.New("response not contains return element")
+	}
+	return nil, nil
+}
+
+// soapElement return first element with local name from body, empty string when element not exists
+func soapElement(body string, local string) string {
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == local {
+			if err := decoder.Skip(); err != nil {
+				return ""
+			}
+			return body[start:decoder.InputOffset()]
+		}
+	}
+}
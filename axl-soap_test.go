@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSoapRows(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t       string
+		rows    int
+		fault   bool
+		success bool
+		name    string
+	}{
+		{soapEnvelope(deviceLineResponse), 5, false, true, "standard return"},
+		{soapEnvelope(namespacedResponse), 2, false, true, "namespaced return"},
+		{soapEnvelope("<return/>"), 0, false, true, "empty return"},
+		{soapEnvelope(queryTooLargeFault), 0, true, true, "fault"},
+		{failResponse, 0, false, false, "without return"},
+		{"<return><row>", 1, false, false, "broken XML"},
+	}
+	for _, table := range tables {
+		rows := 0
+		fault, err := DecodeSoapRows(strings.NewReader(table.t), func(decoder *xml.Decoder, start *xml.StartElement) error {
+			rows++
+			return decoder.Skip()
+		})
+		if (err == nil) != table.success {
+			t.Errorf("not expected decode result for [%s]. Error: %v", table.name, err)
+		}
+		if (fault != nil) != table.fault {
+			t.Errorf("not expected fault for [%s]", table.name)
+		}
+		if rows != table.rows {
+			t.Errorf("not expected number of rows for [%s] - [%d / %d]", table.name, rows, table.rows)
+		}
+	}
+}
+
+func TestNewLoginUserList(t *testing.T) {
+	t.Parallel()
+	list, err := NewLoginUserList(soapEnvelope(namespacedResponse))
+	if err != nil {
+		t.Fatalf("get data error %s", err)
+	}
+	if len(list.Rows) != 2 || list.Rows[1].UserId != "agent02" || list.Rows[1].Status != 1 {
+		t.Errorf("not expected rows from namespaced response %+v", list.Rows)
+	}
+	if _, err := NewLoginUserList(soapEnvelope(queryTooLargeFault)); err == nil {
+		t.Errorf("not get error for fault response")
+	}
+}
+
+func TestSoapElement(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t     string
+		local string
+		e     string
+	}{
+		{soapEnvelope("<return><a>1</a></return>"), "return", "<return><a>1</a></return>"},
+		{soapEnvelope(`<ns:getCCMVersionResponse xmlns:ns="x"><axl:return><a>1</a></axl:return></ns:getCCMVersionResponse>`), "return", "<axl:return><a>1</a></axl:return>"},
+		{soapEnvelope("<return/>"), "return", "<return/>"},
+		{soapEnvelope("<other/>"), "return", ""},
+	}
+	for _, table := range tables {
+		if e := soapElement(table.t, table.local); e != table.e {
+			t.Errorf("not expected element [%s / %s]", e, table.e)
+		}
+	}
+}
+
+func soapEnvelope(body string) string {
+	return `<?xml version='1.0' encoding='UTF-8'?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>` +
+		`<ns:executeSQLQueryResponse xmlns:ns="http://www.cisco.com/AXL/API/12.5">` + body + `</ns:executeSQLQueryResponse></soapenv:Body></soapenv:Envelope>`
+}
+
+const namespacedResponse = `<axl:return xmlns:axl="http://www.cisco.com/AXL/API/12.5">
+	<axl:row><user_pkid>p1</user_pkid><userid>agent01</userid><status>1</status><islocaluser>t</islocaluser></axl:row>
+	<axl:row><user_pkid>p2</user_pkid><userid>agent02</userid><status>1</status><islocaluser>f</islocaluser></axl:row>
+</axl:return>`
@@ -1,18 +1,15 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
-	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-const (
-	token01 = "TOKEN_01"
-	token02 = "TOKEN_02"
-	token03 = "TOKEN_03"
-)
-
-const SelectCompleteTable = `select eu.pkid as user_pkid,
+const selectUserDeviceLine = `select eu.pkid as user_pkid,
        d.pkid as device_pkid,
        np.pkid as line_pkid,
        eu.firstname,
@@ -30,7 +27,14 @@ const SelectCompleteTable = `select eu.pkid as user_pkid,
        np.dnorpattern,
        np.alertingnameascii,
        (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name,
-       np.description as line_description
+       np.description as line_description,
+       tm.name as devicemodel,
+       rp.name as partitionname,
+       d.fkenduser as deviceowner,
+       CASE WHEN eupm.pkid IS NULL THEN 'f' ELSE 't' END as primaryline,
+       d.tkmodel as modelenum,
+       d.tkclass as classenum,
+       tc.name as deviceclass
 from enduser eu
          LEFT OUTER JOIN (SELECT fkenduser, max(CASE tkdnusage WHEN 2 THEN tkdnusage ELSE null END) is not null AS uccx
                           FROM endusernumplanmap
@@ -38,20 +42,59 @@ from enduser eu
 ) AS eunp ON eunp.fkenduser = eu.pkid
          INNER JOIN enduserdevicemap eudm ON eudm.fkenduser = eu.pkid
          INNER JOIN device d ON d.pkid = eudm.fkdevice
+         INNER JOIN typemodel tm ON tm.enum = d.tkmodel
+         INNER JOIN typeclass tc ON tc.enum = d.tkclass
          INNER JOIN devicenumplanmap dnpm ON d.pkid = dnpm.fkdevice
          INNER JOIN numplan np ON np.pkid = dnpm.fknumplan
+         LEFT OUTER JOIN routepartition rp ON rp.pkid = np.fkroutepartition
+         LEFT OUTER JOIN endusernumplanmap eupm
+                         ON eupm.fkenduser = eu.pkid AND eupm.fknumplan = np.pkid AND eupm.tkdnusage = 1`
+
+const selectCompleteTable = selectUserDeviceLine + `
 WHERE d.pkid IN (
     select fkdevice
     from applicationuserdevicemap
-    where fkapplicationuser in (select au.pkid from applicationuser au where lower(name) in (` + token01 + `))
+    where fkapplicationuser in (select au.pkid from applicationuser au where lower(name) in (:users))
     union
     select fkdevice
     from enduserdevicemap
-    where fkenduser in (select au.pkid from enduser au where lower(userid) in (` + token01 + `))
-)
+    where fkenduser in (select au.pkid from enduser au where lower(userid) in (:users))
+)`
+
+const orderCompleteTable = `
 ORDER BY eu.pkid, d.pkid, np.pkid`
 
-const SelectLoginUsers = `select enduser.pkid as user_pkid,
+const SelectCompleteTable = selectCompleteTable + orderCompleteTable
+
+// selectDeviceProfiles select Extension Mobility device profiles (device class 254) of users with their lines
+const selectDeviceProfiles = selectUserDeviceLine + `
+WHERE d.tkclass = 254`
+
+const SelectDeviceProfiles = selectDeviceProfiles + orderCompleteTable
+
+// SelectChangedDeviceProfiles select device profiles only for changed enduser, device or numplan pkid
+const SelectChangedDeviceProfiles = selectDeviceProfiles + `
+  AND (eu.pkid in (:pkid) or d.pkid in (:pkid) or np.pkid in (:pkid))` + orderCompleteTable
+
+// SelectEmSessions select users logged by Extension Mobility, datetimestamp is login time in seconds from epoch
+const SelectEmSessions = `select emd.fkdevice as device_pkid,
+       d.name as devicename,
+       emd.fkenduser as user_pkid,
+       eu.userid,
+       p.name as profilename,
+       emd.datetimestamp as logintime,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
+from extensionmobilitydynamic emd
+         INNER JOIN device d ON d.pkid = emd.fkdevice
+         INNER JOIN enduser eu ON eu.pkid = emd.fkenduser
+         LEFT OUTER JOIN device p ON p.pkid = emd.fkdevice_currentloginprofile
+ORDER BY d.name`
+
+// SelectChangedTable select only rows for changed enduser, device or numplan pkid
+const SelectChangedTable = selectCompleteTable + `
+  AND (eu.pkid in (:pkid) or d.pkid in (:pkid) or np.pkid in (:pkid))` + orderCompleteTable
+
+const selectLoginUsers = `select enduser.pkid as user_pkid,
        enduser.firstname,
        enduser.middlename,
        enduser.lastname,
@@ -62,105 +105,227 @@ const SelectLoginUsers = `select enduser.pkid as user_pkid,
        eunp.uccx,
        enduser.directoryuri,
        enduser.mailid,
+       dg.name as accessgroup,
        (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
 from enduser
          LEFT OUTER JOIN (SELECT fkenduser, max(CASE tkdnusage WHEN 2 THEN tkdnusage ELSE null END) is not null AS uccx
                           FROM endusernumplanmap
                           GROUP BY fkenduser
 ) AS eunp ON eunp.fkenduser = enduser.pkid
-where enduser.pkid in (
-    select e.fkenduser
-    from enduserdirgroupmap as e
-             inner join dirgroup as dg on e.fkdirgroup = dg.pkid
-    where dg.name = '` + token01 + `')`
+         INNER JOIN enduserdirgroupmap e ON e.fkenduser = enduser.pkid
+         INNER JOIN dirgroup dg ON dg.pkid = e.fkdirgroup
+where dg.name in (:groups)`
+
+const orderLoginUsers = `
+ORDER BY enduser.pkid, dg.name`
+
+const SelectLoginUsers = selectLoginUsers + orderLoginUsers
+
+// SelectChangedLoginUsers select only changed login users
+const SelectChangedLoginUsers = selectLoginUsers + `
+  and enduser.pkid in (:pkid)` + orderLoginUsers
+
+const selectUserGroups = `select eu.pkid as user_pkid,
+       dg.name as groupname,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
+from enduserdirgroupmap m
+         INNER JOIN enduser eu ON eu.pkid = m.fkenduser
+         INNER JOIN dirgroup dg ON dg.pkid = m.fkdirgroup
+where lower(dg.name) in (:groups)`
+
+const orderUserGroups = `
+ORDER BY eu.pkid, dg.name`
+
+const SelectUserGroups = selectUserGroups + orderUserGroups
+
+// SelectChangedUserGroups select group membership only for changed users
+const SelectChangedUserGroups = selectUserGroups + `
+  and eu.pkid in (:pkid)` + orderUserGroups
+
+// SelectAccessGroups select names of all access control groups for wildcard and regex matching
+const SelectAccessGroups = "select name from dirgroup order by name"
 
 const SelectCompleteTableMax = "select * from device"
 
-var tokens = []string{token01, token02, token03}
+// SqlParam is typed SQL parameter rendered as Informix literal
+type SqlParam interface {
+	Literal() (string, error)
+}
+
+// SqlString is string parameter, quotes are escaped by doubling
+type SqlString string
+
+// SqlStringList is list of strings for IN (...) condition, empty list is rendered as NULL
+type SqlStringList []string
 
-type ApiSqlBody interface {
-	sqlParameterClean(data string) string
-	addParameter(data string) int
-	ToString() string
-	IsParametersValid() bool
+// SqlQuery is SQL template with named parameters (:name). Placeholders inside string literals are not replaced.
+type SqlQuery struct {
+	id     string
+	sql    string
+	params map[string]SqlParam
+	err    error
+}
+
+func (p SqlString) Literal() (string, error) {
+	for _, r := range string(p) {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return "", errors.New(fmt.Sprintf("SQL parameter %q contains not allowed character", string(p)))
+		}
+	}
+	return "'" + strings.ReplaceAll(string(p), "'", "''") + "'", nil
 }
 
-type SqlBody struct {
-	id         string
-	sql        string
-	parameter  []string
-	needParams int
+func (p SqlStringList) Literal() (string, error) {
+	if len(p) < 1 {
+		return "NULL", nil
+	}
+	items := make([]string, 0, len(p))
+	for _, v := range p {
+		item, err := SqlString(v).Literal()
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ","), nil
 }
 
-func NewUserDeviceLineSql(users []string) *SqlBody {
-	return stringListParameterSql(users, SelectCompleteTable)
+func NewSqlQuery(sql string) *SqlQuery {
+	a := RandomString()
+	log.WithField("id", a).Trace("Prepare SQL request")
+	return &SqlQuery{id: a, sql: sql, params: map[string]SqlParam{}}
 }
 
-func NewLoginUserSql(accessGroup string) *SqlBody {
-	n := newSqlBody(SelectLoginUsers, 1)
-	n.addParameter(accessGroup)
-	return n
+// Set bind parameter to placeholder :name
+func (q *SqlQuery) Set(name string, param SqlParam) *SqlQuery {
+	q.params[name] = param
+	return q
 }
 
-func stringListParameterSql(devices []string, sql string) *SqlBody {
-	listId := ""
-	addComa := ""
-	for _, r := range devices {
-		listId += addComa + "'" + r + "'"
-		addComa = ","
+// Build return SQL with rendered parameters, every placeholder must have parameter
+func (q *SqlQuery) Build() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	var sb strings.Builder
+	sb.Grow(len(q.sql))
+	quoted := false
+	for i := 0; i < len(q.sql); i++ {
+		c := q.sql[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		if quoted || c != ':' || i+1 >= len(q.sql) || !isSqlNameChar(q.sql[i+1]) {
+			sb.WriteByte(c)
+			continue
+		}
+		end := i + 1
+		for end < len(q.sql) && isSqlNameChar(q.sql[end]) {
+			end++
+		}
+		name := q.sql[i+1 : end]
+		param, ok := q.params[name]
+		if !ok {
+			return "", errors.New(fmt.Sprintf("SQL parameter :%s not defined", name))
+		}
+		literal, err := param.Literal()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(literal)
+		i = end - 1
 	}
-	n := newSqlBody(sql, 1)
-	n.addParameter(listId)
-	return n
+	return sb.String(), nil
 }
 
-func newSqlBody(sql string, parameters int) *SqlBody {
-	a := RandomString()
-	log.WithField("id", a).Tracef("Prepare SQL request with %d parameters", parameters)
-	return &SqlBody{
-		id:         a,
-		sql:        sql,
-		parameter:  nil,
-		needParams: parameters,
+func (q *SqlQuery) IsParametersValid() bool {
+	_, err := q.Build()
+	if err != nil {
+		log.WithFields(log.Fields{"id": q.id, "error": err}).Errorf("not valid SQL parameters")
 	}
+	return err == nil
 }
 
-func (a *SqlBody) sqlParameterClean(data string) string {
-	invalid := []string{"%", "*", "?", ";"}
-	if data == "" {
+// ToString return SQL with parameters, empty string when parameters are not valid
+func (q *SqlQuery) ToString() string {
+	sql, err := q.Build()
+	if err != nil {
 		return ""
 	}
-	for _, s := range invalid {
-		data = strings.ReplaceAll(data, s, " ")
+	return sql
+}
+
+func isSqlNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func lowerList(values []string) []string {
+	data := make([]string, 0, len(values))
+	for _, v := range values {
+		data = append(data, strings.ToLower(v))
 	}
 	return data
 }
 
-func (a *SqlBody) IsParametersValid() bool {
-	var re = regexp.MustCompile(`(?mi)[\s;]+(insert|update|select|delete)[\s;]+`)
-	ret := true
-	for _, s := range a.parameter {
-		match := re.MatchString(s)
-		ret = ret && !match
-	}
-	return ret
+// NewUserDeviceLineSql select user/device/line rows for devices of JTAPI users
+func NewUserDeviceLineSql(users []string) *SqlQuery {
+	return NewSqlQuery(SelectCompleteTable).Set("users", SqlStringList(lowerList(users)))
 }
 
-func (a *SqlBody) addParameter(data string) int {
-	data = a.sqlParameterClean(data)
-	if data != "" {
-		a.parameter = append(a.parameter, data)
-	}
-	return len(a.parameter)
+// NewDeviceProfileSql select Extension Mobility device profiles with lines
+func NewDeviceProfileSql() *SqlQuery {
+	return NewSqlQuery(SelectDeviceProfiles)
 }
 
-func (a *SqlBody) ToString() string {
-	if a.needParams > len(a.parameter) || !a.IsParametersValid() {
-		return ""
+// NewChangedDeviceProfileSql select device profiles only for changed pkid
+func NewChangedDeviceProfileSql(pkid []string) *SqlQuery {
+	return NewDeviceProfileSql().withSql(SelectChangedDeviceProfiles).Set("pkid", SqlStringList(pkid))
+}
+
+// NewEmSessionSql select actual Extension Mobility logins
+func NewEmSessionSql() *SqlQuery {
+	return NewSqlQuery(SelectEmSessions)
+}
+
+// NewAccessGroupSql select all access control group names
+func NewAccessGroupSql() *SqlQuery {
+	return NewSqlQuery(SelectAccessGroups)
+}
+
+// NewLoginUserSql select users in access control groups, user in more groups has row for every group
+func NewLoginUserSql(accessGroups []string) *SqlQuery {
+	q := NewSqlQuery(SelectLoginUsers).Set("groups", SqlStringList(accessGroups))
+	if len(accessGroups) < 1 {
+		q.err = errors.New("access control group not defined")
 	}
-	data := a.sql
-	for i, parameter := range a.parameter {
-		data = strings.ReplaceAll(data, tokens[i], parameter)
+	return q
+}
+
+// NewChangedUserDeviceLineSql select user/device/line rows only for changed pkid
+func NewChangedUserDeviceLineSql(users []string, pkid []string) *SqlQuery {
+	return NewUserDeviceLineSql(users).withSql(SelectChangedTable).Set("pkid", SqlStringList(pkid))
+}
+
+// NewChangedLoginUserSql select login users only for changed pkid
+func NewChangedLoginUserSql(accessGroups []string, pkid []string) *SqlQuery {
+	return NewLoginUserSql(accessGroups).withSql(SelectChangedLoginUsers).Set("pkid", SqlStringList(pkid))
+}
+
+// NewUserGroupSql select membership of users in access control groups used in role mapping
+func NewUserGroupSql(groups []string) *SqlQuery {
+	q := NewSqlQuery(SelectUserGroups).Set("groups", SqlStringList(lowerList(groups)))
+	if len(groups) < 1 {
+		q.err = errors.New("access control groups for role mapping not defined")
 	}
-	return data
+	return q
+}
+
+// NewChangedUserGroupSql select group membership only for changed users
+func NewChangedUserGroupSql(groups []string, pkid []string) *SqlQuery {
+	return NewUserGroupSql(groups).withSql(SelectChangedUserGroups).Set("pkid", SqlStringList(pkid))
+}
+
+func (q *SqlQuery) withSql(sql string) *SqlQuery {
+	q.sql = sql
+	return q
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestSqlQuery_Golden(t *testing.T) {
+	tables := []struct {
+		query *SqlQuery
+		file  string
+	}{
+		{NewUserDeviceLineSql([]string{"CallRec", "zqm"}), "user-device-line.sql"},
+		{NewLoginUserSql([]string{"QM Access"}), "login-user.sql"},
+		{NewLoginUserSql([]string{"O'Brien's team", "QM Site B"}), "login-user-quote.sql"},
+		{NewChangedUserDeviceLineSql([]string{"callrec"}, []string{"aaa", "bbb"}), "changed-user-device-line.sql"},
+		{NewChangedLoginUserSql([]string{"QM Access"}, []string{"aaa"}), "changed-login-user.sql"},
+		{NewChangedLoginUserSql([]string{"QM Access"}, nil), "changed-login-user-empty.sql"},
+		{NewUserGroupSql([]string{"QM Supervisors", "QM Evaluators"}), "user-group.sql"},
+		{NewChangedUserGroupSql([]string{"QM Supervisors"}, []string{"aaa"}), "changed-user-group.sql"},
+		{NewDeviceProfileSql(), "device-profile.sql"},
+		{NewChangedDeviceProfileSql([]string{"aaa"}), "changed-device-profile.sql"},
+		{NewEmSessionSql(), "em-session.sql"},
+		{NewAccessGroupSql(), "access-group.sql"},
+	}
+	for _, table := range tables {
+		sql, err := table.query.Build()
+		if err != nil {
+			t.Errorf("query not build for [%s] - %s", table.file, err)
+			continue
+		}
+		golden := filepath.Join("testdata", "sql", table.file)
+		if *updateGolden {
+			if err := ioutil.WriteFile(golden, []byte(sql+"\n"), 0644); err != nil {
+				t.Fatalf("golden file not updated: %s", err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("golden file not read for [%s] - %s", table.file, err)
+			continue
+		}
+		if sql+"\n" != string(expected) {
+			t.Errorf("not expected SQL for [%s]:\n%s", table.file, sql)
+		}
+	}
+}
+
+func TestSqlParam_Literal(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		param   SqlParam
+		literal string
+		valid   bool
+	}{
+		{SqlString("QM Access"), "'QM Access'", true},
+		{SqlString("O'Brien"), "'O''Brien'", true},
+		{SqlString("x'); delete from enduser; --"), "'x''); delete from enduser; --'", true},
+		{SqlString("100%"), "'100%'", true},
+		{SqlString(""), "''", true},
+		{SqlString("line\nbreak"), "", false},
+		{SqlString("bad\xffutf"), "", false},
+		{SqlStringList{"a", "b'c"}, "'a','b''c'", true},
+		{SqlStringList{}, "NULL", true},
+		{SqlStringList{"a", "\x00"}, "", false},
+	}
+	for _, table := range tables {
+		literal, err := table.param.Literal()
+		if (err == nil) != table.valid || literal != table.literal {
+			t.Errorf("not expected literal for [%v] - [%s %v / %s]", table.param, literal, err, table.literal)
+		}
+	}
+}
+
+func TestSqlQuery_Build(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		query *SqlQuery
+		sql   string
+		valid bool
+		name  string
+	}{
+		{NewSqlQuery("select 1 from t where a = :a and b in (:b)").Set("a", SqlString("x")).Set("b", SqlStringList{"y", "z"}), "select 1 from t where a = 'x' and b in ('y','z')", true, "parameters"},
+		{NewSqlQuery("select ':a' from t where a = :a").Set("a", SqlString("x")), "select ':a' from t where a = 'x'", true, "placeholder in literal"},
+		{NewSqlQuery("select 1 from t where a = :a"), "", false, "missing parameter"},
+		{NewSqlQuery("select a:b from t").Set("b", SqlString(":a")), "select a':a' from t", true, "parameter value not expanded"},
+		{NewLoginUserSql(nil), "", false, "empty access group"},
+		{NewUserGroupSql(nil), "", false, "empty role groups"},
+	}
+	for _, table := range tables {
+		sql, err := table.query.Build()
+		if (err == nil) != table.valid || sql != table.sql {
+			t.Errorf("not expected SQL for [%s] - [%s %v / %s]", table.name, sql, err, table.sql)
+		}
+		if table.query.IsParametersValid() != table.valid {
+			t.Errorf("not expected validity for [%s]", table.name)
+		}
+	}
+}
+
+func TestRequest_getSqlRequestBodyEscape(t *testing.T) {
+	t.Parallel()
+	connection := NewConnection("localhost", "user", "pwd")
+	connection.dbVersion = "12.0"
+	sql := NewLoginUserSql([]string{"R&D <QM>"}).ToString()
+	body := NewRequest(nil, connection).getSqlRequestBody(sql)
+	if !strings.Contains(body, "R&amp;D &lt;QM&gt;") {
+		t.Errorf("SQL not escaped in request body")
+	}
+	var decoded string
+	if err := xml.Unmarshal([]byte(soapElement(body, "sql")), &decoded); err != nil || decoded != sql {
+		t.Errorf("SQL not decoded from request body [%v]", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const (
+	TlsModeIgnore   = "certificate not verified (ignoreCertificate)"
+	TlsModeSystemCa = "verify by system CA"
+	TlsModeCaFile   = "verify by CA bundle"
+	TlsModePinned   = "pinned certificate fingerprint"
+)
+
+var certificatePinFormat = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// NormalizeCertificatePin remove separators from SHA-256 fingerprint and lower case it
+func NormalizeCertificatePin(pin string) string {
+	pin = strings.ToLower(strings.TrimSpace(pin))
+	pin = strings.ReplaceAll(pin, ":", "")
+	pin = strings.ReplaceAll(pin, " ", "")
+	return pin
+}
+
+func IsValidCertificatePin(pin string) bool {
+	return certificatePinFormat.MatchString(NormalizeCertificatePin(pin))
+}
+
+// TlsMode return description of active TLS verification
+func (a *ConfigAxl) TlsMode() string {
+	if a.IgnoreCertificate {
+		return TlsModeIgnore
+	}
+	mode := TlsModeSystemCa
+	if len(a.CaFile) > 0 {
+		mode = fmt.Sprintf("%s %s", TlsModeCaFile, a.CaFile)
+	}
+	if len(a.CertificatePin) > 0 {
+		if len(a.CaFile) > 0 {
+			mode = fmt.Sprintf("%s + %s", mode, TlsModePinned)
+		} else {
+			mode = TlsModePinned
+		}
+	}
+	if len(a.ClientCert) > 0 {
+		mode = fmt.Sprintf("%s, client certificate %s", mode, a.ClientCert)
+	}
+	return mode
+}
+
+// TlsConfig prepare TLS configuration for AXL connection
+func (a *ConfigAxl) TlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if a.IgnoreCertificate {
+		cfg.InsecureSkipVerify = true
+		return cfg, nil
+	}
+	if len(a.CaFile) > 0 {
+		pem, err := ioutil.ReadFile(a.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("no valid certificate in CA file %s", a.CaFile))
+		}
+		cfg.RootCAs = pool
+	}
+	if len(a.CertificatePin) > 0 {
+		pin, err := hex.DecodeString(NormalizeCertificatePin(a.CertificatePin))
+		if err != nil {
+			return nil, err
+		}
+		// pin without CA file is trust anchor itself, self signed CUCM certificates can't be verified by chain
+		cfg.InsecureSkipVerify = len(a.CaFile) == 0
+		cfg.VerifyPeerCertificate = certificatePinVerify(pin)
+	}
+	if len(a.ClientCert) > 0 {
+		cert, err := tls.LoadX509KeyPair(a.ClientCert, a.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func certificatePinVerify(pin []byte) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) < 1 {
+			return errors.New("AXL server not present certificate")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(sum[:], pin) {
+			return errors.New(fmt.Sprintf("AXL server certificate fingerprint %s not match pinned fingerprint", hex.EncodeToString(sum[:])))
+		}
+		return nil
+	}
+}
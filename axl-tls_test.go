@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsValidCertificatePin(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t       string
+		success bool
+	}{
+		{strings.Repeat("ab", 32), true},
+		{strings.ToUpper(strings.Repeat("ab:", 31) + "ab"), true},
+		{strings.Repeat("ab", 31), false},
+		{strings.Repeat("xy", 32), false},
+		{"", false},
+	}
+	for _, table := range tables {
+		if IsValidCertificatePin(table.t) != table.success {
+			t.Errorf("not expected pin validation for [%s] - expect %t", table.t, table.success)
+		}
+	}
+}
+
+func TestConfigAxl_TlsConfig(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	pin := hex.EncodeToString(sum[:])
+
+	tables := []struct {
+		t       ConfigAxl
+		mode    string
+		success bool
+		name    string
+	}{
+		{ConfigAxl{}, TlsModeSystemCa, false, "self signed not trusted by system CA"},
+		{ConfigAxl{IgnoreCertificate: true}, TlsModeIgnore, true, "ignore certificate"},
+		{ConfigAxl{CertificatePin: pin}, TlsModePinned, true, "valid pin"},
+		{ConfigAxl{CertificatePin: strings.Repeat("0", 64)}, TlsModePinned, false, "invalid pin"},
+	}
+	for _, table := range tables {
+		if table.t.TlsMode() != table.mode {
+			t.Errorf("not expected TLS mode for [%s] - [%s / %s]", table.name, table.t.TlsMode(), table.mode)
+		}
+		cfg, err := table.t.TlsConfig()
+		if err != nil {
+			t.Errorf("not expected TLS config error for [%s]. Error: %s", table.name, err)
+			continue
+		}
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(srv.URL)
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		if (err == nil) != table.success {
+			t.Errorf("not expected TLS connection result for [%s]. Error: %v", table.name, err)
+		}
+	}
+}
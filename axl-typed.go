@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"time"
+)
+
+const typedRequest = "<soapenv:Header/><soapenv:Body><ns:%s sequence=\"%d\">%s</ns:%s></soapenv:Body></soapenv:Envelope>"
+
+// page size for typed list requests (listUser, listPhone)
+const typedPageSize = 500
+
+const (
+	listUserContent   = `<searchCriteria><userid>%%</userid></searchCriteria><returnedTags uuid=""><firstName/><middleName/><lastName/><userid/><department/><directoryUri/><mailid/></returnedTags><skip>%d</skip><first>%d</first>`
+	getUserContent    = `<uuid>%s</uuid><returnedTags><status/><ldapDirectoryName/><ipccExtension/><associatedDevices><device/></associatedDevices><associatedGroups><userGroup><name/></userGroup></associatedGroups><primaryExtension><pattern/><routePartitionName/></primaryExtension></returnedTags>`
+	getAppUserContent = `<userid>%s</userid><returnedTags><associatedDevices><device/></associatedDevices></returnedTags>`
+	listPhoneContent  = `<searchCriteria><name>%%</name></searchCriteria><returnedTags uuid=""><name/><description/><model/><class/><ownerUserName/></returnedTags><skip>%d</skip><first>%d</first>`
+	getPhoneContent   = `<name>%s</name><returnedTags uuid=""><name/><lines><line><dirn uuid=""><pattern/></dirn></line></lines></returnedTags>`
+	getLineContent    = `<uuid>%s</uuid><returnedTags uuid=""><pattern/><description/><asciiAlertingName/><routePartitionName/></returnedTags>`
+)
+
+type TypedUser struct {
+	Uuid         string `xml:"uuid,attr"`
+	FirstName    string `xml:"firstName"`
+	MiddleName   string `xml:"middleName"`
+	LastName     string `xml:"lastName"`
+	UserId       string `xml:"userid"`
+	Department   string `xml:"department"`
+	DirectoryUri string `xml:"directoryUri"`
+	MailId       string `xml:"mailid"`
+}
+
+type TypedUserDetail struct {
+	Status            int      `xml:"status"`
+	LdapDirectoryName string   `xml:"ldapDirectoryName"`
+	IpccExtension     string   `xml:"ipccExtension"`
+	Devices           []string `xml:"associatedDevices>device"`
+	Groups            []string `xml:"associatedGroups>userGroup>name"`
+	PrimaryExtension  struct {
+		Pattern            string `xml:"pattern"`
+		RoutePartitionName string `xml:"routePartitionName"`
+	} `xml:"primaryExtension"`
+}
+
+type TypedPhone struct {
+	Uuid        string      `xml:"uuid,attr"`
+	Name        string      `xml:"name"`
+	Description string      `xml:"description"`
+	Model       string      `xml:"model"`
+	Class       string      `xml:"class"`
+	Owner       string      `xml:"ownerUserName"`
+	Lines       []TypedDirn `xml:"lines>line>dirn"`
+}
+
+type TypedDirn struct {
+	Uuid    string `xml:"uuid,attr"`
+	Pattern string `xml:"pattern"`
+}
+
+type TypedLine struct {
+	Uuid               string `xml:"uuid,attr"`
+	Pattern            string `xml:"pattern"`
+	Description        string `xml:"description"`
+	AsciiAlertingName  string `xml:"asciiAlertingName"`
+	RoutePartitionName string `xml:"routePartitionName"`
+}
+
+// typedCache keep data read by typed API during one AXL update
+type typedCache struct {
+	users   []typedUserRecord
+	phones  map[string]*TypedPhone
+	details map[string]*TypedPhone
+	lines   map[string]*TypedLine
+}
+
+type typedUserRecord struct {
+	user   TypedUser
+	detail TypedUserDetail
+}
+
+// typedPkid convert AXL uuid {ABCD-...} to pkid format used by executeSQLQuery
+func typedPkid(uuid string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(uuid), "{}"))
+}
+
+func xmlEscape(value string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+func (s *Request) getTypedRequestBody(operation string, content string) string {
+	s.connection.sequence++
+	return fmt.Sprintf(xmlHeaderFormat+typedRequest, s.connection.dbVersion, operation, s.connection.sequence, content, operation)
+}
+
+// typedResponse call typed AXL method, return success response or error with fault string
+func (s *Request) typedResponse(operation string, content string) (*Response, error) {
+	response := s.doAxlRequest(s.getTypedRequestBody(operation, content))
+	if response.statusCode == 200 {
+		return response, nil
+	}
+	msg, err := response.ResponseError()
+	response.Close()
+	if err == nil {
+		err = errors.New(msg)
+	}
+	if response.IsNotAuthorized() {
+		return nil, fmt.Errorf("%w: %s", ErrAxlNotAuthorized, operation)
+	}
+	if response.fault != nil && len(response.fault.FaultString) > 0 {
+		err = &AxlFaultError{Fault: response.fault}
+	}
+	log.WithFields(log.Fields{"id": s.id, "server": s.connection.server, "operation": operation}).Debugf("%s. HTTP Status [%s]", msg, response.statusMessage)
+	return nil, err
+}
+
+// TypedRequest call typed AXL method and unmarshal <return> element to data
+func (s *Request) TypedRequest(operation string, content string, data interface{}) error {
+	response, err := s.typedResponse(operation, content)
+	if err != nil {
+		return err
+	}
+	body := response.GetResponseBody()
+	if response.err != nil {
+		return response.err
+	}
+	return xml.Unmarshal([]byte(body), data)
+}
+
+// ListUser read all end users, request is split to pages
+func (s *Request) ListUser() ([]TypedUser, error) {
+	var users []TypedUser
+	for skip := 0; ; skip += typedPageSize {
+		var data struct {
+			Users []TypedUser `xml:"user"`
+		}
+		if err := s.TypedRequest("listUser", fmt.Sprintf(listUserContent, skip, typedPageSize), &data); err != nil {
+			return nil, err
+		}
+		users = append(users, data.Users...)
+		if len(data.Users) < typedPageSize {
+			return users, nil
+		}
+	}
+}
+
+func (s *Request) GetUser(uuid string) (*TypedUserDetail, error) {
+	var data struct {
+		User TypedUserDetail `xml:"user"`
+	}
+	if err := s.TypedRequest("getUser", fmt.Sprintf(getUserContent, xmlEscape(uuid)), &data); err != nil {
+		return nil, err
+	}
+	return &data.User, nil
+}
+
+// GetAppUserDevices return devices controlled by application user
+func (s *Request) GetAppUserDevices(name string) ([]string, error) {
+	var data struct {
+		Devices []string `xml:"appUser>associatedDevices>device"`
+	}
+	if err := s.TypedRequest("getAppUser", fmt.Sprintf(getAppUserContent, xmlEscape(name)), &data); err != nil {
+		return nil, err
+	}
+	return data.Devices, nil
+}
+
+// ListPhone read all phones, request is split to pages
+func (s *Request) ListPhone() ([]TypedPhone, error) {
+	var phones []TypedPhone
+	for skip := 0; ; skip += typedPageSize {
+		var data struct {
+			Phones []TypedPhone `xml:"phone"`
+		}
+		if err := s.TypedRequest("listPhone", fmt.Sprintf(listPhoneContent, skip, typedPageSize), &data); err != nil {
+			return nil, err
+		}
+		phones = append(phones, data.Phones...)
+		if len(data.Phones) < typedPageSize {
+			return phones, nil
+		}
+	}
+}
+
+func (s *Request) GetPhone(name string) (*TypedPhone, error) {
+	var data struct {
+		Phone TypedPhone `xml:"phone"`
+	}
+	if err := s.TypedRequest("getPhone", fmt.Sprintf(getPhoneContent, xmlEscape(name)), &data); err != nil {
+		return nil, err
+	}
+	return &data.Phone, nil
+}
+
+func (s *Request) GetLine(uuid string) (*TypedLine, error) {
+	var data struct {
+		Line TypedLine `xml:"line"`
+	}
+	if err := s.TypedRequest("getLine", fmt.Sprintf(getLineContent, xmlEscape(uuid)), &data); err != nil {
+		return nil, err
+	}
+	return &data.Line, nil
+}
+
+// useTypedApi identify connection configured for typed API or switched after authorization fault
+func (s *Connection) useTypedApi() bool {
+	return s.api == ApiTyped
+}
+
+// switchToTypedApi change API after executeSQLQuery authorization fault, return false when change is not allowed
+func (s *Connection) switchToTypedApi(err error) bool {
+	if s.api != ApiAuto || !errors.Is(err, ErrAxlNotAuthorized) {
+		return false
+	}
+	if len(s.clusterName()) < 1 {
+		// rows from typed API with other cluster name replace all rows imported by SQL
+		log.WithFields(log.Fields{"id": s.id, "server": s.server}).Errorf("AXL user not authorized for executeSQLQuery, typed AXL API need configured cluster name")
+		return false
+	}
+	log.WithFields(log.Fields{"id": s.id, "server": s.server}).Warningf("AXL user not authorized for executeSQLQuery, switch to typed AXL API")
+	s.api = ApiTyped
+	return true
+}
+
+// typedReadDuration return minimal duration of typed requests paced by rate limit, zero without limit
+func typedReadDuration(requests int, rateLimit int) time.Duration {
+	if rateLimit < 1 {
+		return 0
+	}
+	return time.Duration(requests) * time.Minute / time.Duration(rateLimit)
+}
+
+// checkTypedDuration refuse typed read which can not finish before AXL update timeout
+func (s *Connection) checkTypedDuration(users int) error {
+	if s.cluster == nil || s.ctx == nil {
+		return nil
+	}
+	deadline, ok := s.ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	need := typedReadDuration(users, s.cluster.Retry.RateLimit)
+	if remaining := time.Until(deadline); need > remaining {
+		return errors.New(fmt.Sprintf("typed AXL API need %d getUser requests, with rate limit %d requests/min it takes %s, only %s remains to AXL timeout. "+
+			"Allow executeSQLQuery for AXL user, increase rateLimit or axlTimeout", users, s.cluster.Retry.RateLimit, need.Round(time.Minute), remaining.Round(time.Minute)))
+	}
+	return nil
+}
+
+// loadTypedUsers read all end users with details, data are cached for login users and user/device/line list
+func (s *Connection) loadTypedUsers() error {
+	if s.typed != nil {
+		return nil
+	}
+	request := NewRequest(s.client, s)
+	users, err := request.ListUser()
+	if err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read user list by typed AXL API")
+		return err
+	}
+	// every end user need own getUser request, users relevant for import are known only from details
+	if err := s.checkTypedDuration(len(users)); err != nil {
+		log.WithFields(log.Fields{"id": s.id, "users": len(users), "error": err}).Errorf("typed AXL API read not possible")
+		return err
+	}
+	cache := &typedCache{phones: map[string]*TypedPhone{}, details: map[string]*TypedPhone{}, lines: map[string]*TypedLine{}}
+	for _, user := range users {
+		detail, err := request.GetUser(user.Uuid)
+		if err != nil {
+			log.WithFields(log.Fields{"id": s.id, "user": user.UserId, "error": err}).Errorf("problem read user detail by typed AXL API")
+			return err
+		}
+		cache.users = append(cache.users, typedUserRecord{user: user, detail: *detail})
+	}
+	sort.Slice(cache.users, func(i, j int) bool {
+		return typedPkid(cache.users[i].user.Uuid) < typedPkid(cache.users[j].user.Uuid)
+	})
+	s.typed = cache
+	log.WithFields(log.Fields{"id": s.id, "users": len(cache.users)}).Debugf("typed AXL API read %d users", len(cache.users))
+	return nil
+}
+
+func (r *typedUserRecord) loginUser() LoginUser {
+	return LoginUser{
+		UserPKID:     typedPkid(r.user.Uuid),
+		FirstName:    r.user.FirstName,
+		MiddleName:   r.user.MiddleName,
+		LastName:     r.user.LastName,
+		UserId:       r.user.UserId,
+		Department:   r.user.Department,
+		Status:       r.detail.Status,
+		IsLocalUser:  len(r.detail.LdapDirectoryName) < 1,
+		Uccx:         len(r.detail.IpccExtension) > 0 && config.Processing.CoexistCcxImporter,
+		DirectoryUri: r.user.DirectoryUri,
+		MailId:       r.user.MailId,
+	}
+}
+
+// accessGroup return first matched access control group of user, -1 when user is not in any group
+func (r *typedUserRecord) accessGroup(matcher *AccessGroupMatcher) (string, int) {
+	name, best := "", -1
+	for _, g := range r.detail.Groups {
+		if p := matcher.Match(g); p > -1 && (best < 0 || p < best) {
+			name, best = g, p
+		}
+	}
+	return name, best
+}
+
+// getTypedLoginUserList build login user rows from typed API, users are members of access control group
+func (s *Connection) getTypedLoginUserList() *LoginUserList {
+	log.WithField("id", s.id).Trace("get login user list by typed AXL API")
+	if err := s.loadTypedUsers(); err != nil {
+		return nil
+	}
+	matcher, err := NewAccessGroupMatcher(s.accessGroups())
+	if err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("access control groups not valid")
+		return nil
+	}
+	data := &LoginUserList{Rows: []LoginUser{}}
+	for i := range s.typed.users {
+		if group, p := s.typed.users[i].accessGroup(matcher); p > -1 {
+			row := s.typed.users[i].loginUser()
+			row.AccessGroup = group
+			row.DefaultTeam = matcher.groups[p].Team
+			row.DefaultRole = matcher.groups[p].Role
+			data.Rows = append(data.Rows, row)
+		}
+	}
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read login user list by typed AXL API")
+	return data
+}
+
+// typedUserPkid return pkid of end user, empty when user is not read
+func (s *Connection) typedUserPkid(userId string) string {
+	if len(userId) < 1 {
+		return ""
+	}
+	for i := range s.typed.users {
+		if strings.EqualFold(s.typed.users[i].user.UserId, userId) {
+			return typedPkid(s.typed.users[i].user.Uuid)
+		}
+	}
+	return ""
+}
+
+// typedJtapiDevices return names of devices controlled by JTAPI application or end users
+func (s *Connection) typedJtapiDevices(request *Request) (map[string]bool, error) {
+	devices := map[string]bool{}
+	for _, jtapi := range s.jtapiUsers() {
+		list, err := request.GetAppUserDevices(jtapi)
+		if errors.Is(err, ErrAxlNotAuthorized) {
+			return nil, err
+		}
+		if err != nil {
+			// JTAPI user can be end user
+			for _, u := range s.typed.users {
+				if strings.EqualFold(u.user.UserId, jtapi) {
+					list = append(list, u.detail.Devices...)
+				}
+			}
+		}
+		for _, device := range list {
+			devices[strings.ToLower(device)] = true
+		}
+	}
+	return devices, nil
+}
+
+func (s *Connection) typedPhoneDetail(request *Request, name string) (*TypedPhone, error) {
+	if phone, ok := s.typed.details[name]; ok {
+		return phone, nil
+	}
+	phone, err := request.GetPhone(name)
+	if err != nil {
+		return nil, err
+	}
+	s.typed.details[name] = phone
+	return phone, nil
+}
+
+func (s *Connection) typedLine(request *Request, uuid string) (*TypedLine, error) {
+	if line, ok := s.typed.lines[uuid]; ok {
+		return line, nil
+	}
+	line, err := request.GetLine(uuid)
+	if err != nil {
+		return nil, err
+	}
+	s.typed.lines[uuid] = line
+	return line, nil
+}
+
+// getTypedUserDeviceLineList build user/device/line rows from typed API in same order as SQL select
+func (s *Connection) getTypedUserDeviceLineList() *UserDeviceLineList {
+	log.WithField("id", s.id).Trace("get user/device/line list by typed AXL API")
+	if err := s.loadTypedUsers(); err != nil {
+		return nil
+	}
+	request := NewRequest(s.client, s)
+	devices, err := s.typedJtapiDevices(request)
+	if err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read JTAPI devices by typed AXL API")
+		return nil
+	}
+	if len(s.typed.phones) < 1 {
+		phones, err := request.ListPhone()
+		if err != nil {
+			log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read phone list by typed AXL API")
+			return nil
+		}
+		for i := range phones {
+			s.typed.phones[strings.ToLower(phones[i].Name)] = &phones[i]
+		}
+	}
+	data := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	for i := range s.typed.users {
+		record := &s.typed.users[i]
+		user := record.loginUser()
+		var rows []UserDeviceLine
+		for _, name := range record.detail.Devices {
+			phone, ok := s.typed.phones[strings.ToLower(name)]
+			if !devices[strings.ToLower(name)] || !ok {
+				continue
+			}
+			detail, err := s.typedPhoneDetail(request, phone.Name)
+			if err != nil {
+				log.WithFields(log.Fields{"id": s.id, "device": phone.Name, "error": err}).Errorf("problem read phone by typed AXL API")
+				return nil
+			}
+			for _, dirn := range detail.Lines {
+				line, err := s.typedLine(request, dirn.Uuid)
+				if err != nil {
+					log.WithFields(log.Fields{"id": s.id, "line": dirn.Pattern, "error": err}).Errorf("problem read line by typed AXL API")
+					return nil
+				}
+				rows = append(rows, UserDeviceLine{
+					UserPKID:          user.UserPKID,
+					DevicePKID:        typedPkid(phone.Uuid),
+					LinePKID:          typedPkid(line.Uuid),
+					FirstName:         user.FirstName,
+					MiddleName:        user.MiddleName,
+					LastName:          user.LastName,
+					UserId:            user.UserId,
+					Department:        user.Department,
+					Status:            user.Status,
+					IsLocalUser:       user.IsLocalUser,
+					Uccx:              user.Uccx,
+					DirectoryUri:      user.DirectoryUri,
+					MailId:            user.MailId,
+					DeviceName:        phone.Name,
+					DeviceDescription: phone.Description,
+					LineNumber:        line.Pattern,
+					LineAlertingName:  line.AsciiAlertingName,
+					LineDescription:   line.Description,
+					DeviceModel:       phone.Model,
+					DeviceClass:       phone.Class,
+					Partition:         line.RoutePartitionName,
+					DeviceOwner:       s.typedUserPkid(phone.Owner),
+					PrimaryLine:       record.detail.PrimaryExtension.Pattern == line.Pattern && record.detail.PrimaryExtension.RoutePartitionName == line.RoutePartitionName,
+				})
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].DevicePKID != rows[j].DevicePKID {
+				return rows[i].DevicePKID < rows[j].DevicePKID
+			}
+			return rows[i].LinePKID < rows[j].LinePKID
+		})
+		data.Rows = append(data.Rows, rows...)
+	}
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read user/device/line list by typed AXL API")
+	return data
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	typedOperation = regexp.MustCompile(`<ns:(\w+) sequence`)
+	typedUuid      = regexp.MustCompile(`<uuid>([^<]+)</uuid>`)
+	typedName      = regexp.MustCompile(`<(?:name|userid)>([^<%]+)</(?:name|userid)>`)
+)
+
+// typedAxl simulate CUCM where AXL user has not permission for executeSQLQuery
+func typedAxl(requests map[string]int) roundTripFunc {
+	users := map[string]string{
+		"{AAA-1}": `<status>1</status><ldapDirectoryName/><ipccExtension>1001</ipccExtension><associatedDevices><device>SEP001</device><device>SEP002</device></associatedDevices><associatedGroups><userGroup><name>QM Access</name></userGroup></associatedGroups>`,
+		"{BBB-2}": `<status>1</status><ldapDirectoryName>LDAP</ldapDirectoryName><associatedDevices><device>SEP003</device></associatedDevices>`,
+	}
+	phones := map[string]string{
+		"SEP001": `<lines><line><dirn uuid="{L-1}"><pattern>1001</pattern></dirn></line><line><dirn uuid="{L-2}"><pattern>1002</pattern></dirn></line></lines>`,
+		"SEP003": `<lines><line><dirn uuid="{L-3}"><pattern>1003</pattern></dirn></line></lines>`,
+	}
+	return func(r *http.Request) *http.Response {
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		operation := typedOperation.FindStringSubmatch(body)[1]
+		requests[operation]++
+		switch operation {
+		case "executeSQLQuery":
+			return soapResponse(500, authorizationFault)
+		case "listUser":
+			return soapResponse(200, `<return><user uuid="{BBB-2}"><firstName>Jane</firstName><userid>agent2</userid></user>`+
+				`<user uuid="{AAA-1}"><firstName>John</firstName><lastName>Doe</lastName><userid>agent1</userid><department>Sales</department></user></return>`)
+		case "getUser":
+			return soapResponse(200, "<return><user>"+users[typedUuid.FindStringSubmatch(body)[1]]+"</user></return>")
+		case "getAppUser":
+			return soapResponse(200, `<return><appUser><associatedDevices><device>SEP001</device><device>SEP003</device></associatedDevices></appUser></return>`)
+		case "listPhone":
+			return soapResponse(200, `<return><phone uuid="{D-1}"><name>SEP001</name><description>desk 1</description></phone>`+
+				`<phone uuid="{D-2}"><name>SEP002</name></phone><phone uuid="{D-3}"><name>SEP003</name></phone></return>`)
+		case "getPhone":
+			name := typedName.FindStringSubmatch(body)[1]
+			return soapResponse(200, "<return><phone><name>"+name+"</name>"+phones[name]+"</phone></return>")
+		case "getLine":
+			uuid := typedUuid.FindStringSubmatch(body)[1]
+			return soapResponse(200, fmt.Sprintf(`<return><line uuid="%s"><pattern>x</pattern><description>line %s</description><asciiAlertingName>Alert</asciiAlertingName></line></return>`, uuid, uuid))
+		}
+		return soapResponse(500, authorizationFault)
+	}
+}
+
+func TestConnection_TypedApiFallback(t *testing.T) {
+	t.Parallel()
+	requests := map[string]int{}
+	cluster := &ConfigAxl{Name: "TYPED", Server: "cucm-typed", User: "user", Password: "pwd", AccessGroup: "QM Access", JtapiUser: []string{"callrec"}, Api: ApiAuto}
+	connection, err := NewClusterConnection(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("connection not created: %s", err)
+	}
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: typedAxl(requests)})
+
+	login := connection.GetLoginUserList()
+	if login == nil || len(login.Rows) != 1 {
+		t.Fatalf("not expected login users %v", login)
+	}
+	if login.Rows[0].UserPKID != "aaa-1" || login.Rows[0].ClusterName != "TYPED" || !login.Rows[0].IsLocalUser {
+		t.Errorf("not expected login user %+v", login.Rows[0])
+	}
+	devices := connection.GetUserDeviceLineList()
+	if devices == nil {
+		t.Fatalf("typed API not return user/device/line list")
+	}
+	expected := []string{"aaa-1/d-1/l-1", "aaa-1/d-1/l-2", "bbb-2/d-3/l-3"}
+	var actual []string
+	for _, row := range devices.Rows {
+		actual = append(actual, row.UserPKID+"/"+row.DevicePKID+"/"+row.LinePKID)
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("not expected rows [%s / %s]", strings.Join(actual, ","), strings.Join(expected, ","))
+	}
+	if devices.Rows[0].DeviceDescription != "desk 1" || devices.Rows[0].LineAlertingName != "Alert" || devices.Rows[0].LineDescription != "line {L-1}" {
+		t.Errorf("not expected row content %+v", devices.Rows[0])
+	}
+	if requests["executeSQLQuery"] != 1 {
+		t.Errorf("SQL request not expected after switch to typed API [%d]", requests["executeSQLQuery"])
+	}
+	if requests["listUser"] != 1 || requests["getUser"] != 2 {
+		t.Errorf("typed user data not cached [listUser %d, getUser %d]", requests["listUser"], requests["getUser"])
+	}
+}
+
+func TestConnection_SqlApiNoFallback(t *testing.T) {
+	t.Parallel()
+	requests := map[string]int{}
+	cluster := &ConfigAxl{Name: "SQL-ONLY", Server: "cucm-sql", User: "user", Password: "pwd", AccessGroup: "QM Access", JtapiUser: []string{"callrec"}, Api: ApiSql}
+	connection, err := NewClusterConnection(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("connection not created: %s", err)
+	}
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: typedAxl(requests)})
+	if connection.GetLoginUserList() != nil {
+		t.Errorf("login users returned without executeSQLQuery permission")
+	}
+	if requests["listUser"] != 0 {
+		t.Errorf("typed API used for sql mode")
+	}
+}
+
+func TestConnection_TypedApiNeedName(t *testing.T) {
+	t.Parallel()
+	requests := map[string]int{}
+	cluster := &ConfigAxl{Server: "cucm-noname", User: "user", Password: "pwd", AccessGroup: "QM Access", JtapiUser: []string{"callrec"}, Api: ApiAuto}
+	connection, err := NewClusterConnection(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("connection not created: %s", err)
+	}
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: typedAxl(requests)})
+	if connection.GetLoginUserList() != nil || connection.useTypedApi() {
+		t.Errorf("cluster without name switched to typed API")
+	}
+	if requests["listUser"] != 0 {
+		t.Errorf("typed API used for cluster without name")
+	}
+}
+
+func TestConnection_TypedApiTimeout(t *testing.T) {
+	t.Parallel()
+	requests := map[string]int{}
+	cluster := &ConfigAxl{Name: "TYPED-SLOW", Server: "cucm-slow", User: "user", Password: "pwd", AccessGroup: "QM Access", JtapiUser: []string{"callrec"}, Api: ApiTyped}
+	cluster.Retry.RateLimit = 1
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	connection, err := NewClusterConnection(ctx, cluster)
+	if err != nil {
+		t.Fatalf("connection not created: %s", err)
+	}
+	connection.dbVersion = "12.0"
+	connection.SetClient(&http.Client{Transport: typedAxl(requests)})
+	if connection.GetLoginUserList() != nil {
+		t.Errorf("typed read started without time to finish")
+	}
+	if requests["listUser"] != 1 || requests["getUser"] != 0 {
+		t.Errorf("not expected typed requests [listUser %d, getUser %d]", requests["listUser"], requests["getUser"])
+	}
+}
+
+func TestTypedReadDuration(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		requests  int
+		rateLimit int
+		e         time.Duration
+	}{
+		{7200, 120, time.Hour},
+		{90, 60, 90 * time.Second},
+		{5000, 0, 0},
+	}
+	for _, table := range tables {
+		if d := typedReadDuration(table.requests, table.rateLimit); d != table.e {
+			t.Errorf("not expected duration for %d requests with limit %d [%s / %s]", table.requests, table.rateLimit, d, table.e)
+		}
+	}
+}
+
+func TestTypedPkid(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		uuid string
+		pkid string
+	}{
+		{"{9C0A4B2D-1E2F-3A4B-5C6D-7E8F9A0B1C2D}", "9c0a4b2d-1e2f-3a4b-5c6d-7e8f9a0b1c2d"},
+		{"abc", "abc"},
+		{" {ABC} ", "abc"},
+	}
+	for _, table := range tables {
+		if typedPkid(table.uuid) != table.pkid {
+			t.Errorf("not expected pkid for [%s] - [%s / %s]", table.uuid, typedPkid(table.uuid), table.pkid)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"strings"
@@ -33,28 +34,77 @@ type UserDeviceLine struct {
 	LineAlertingName  string   `xml:"alertingnameascii" json:"alertingnameascii"`
 	LineDescription   string   `xml:"line_description" json:"line_description"`
 	ClusterName       string   `xml:"cluster_name" json:"cluster_name"`
+	DeviceModel       string   `xml:"devicemodel" json:"devicemodel"`
+	Partition         string   `xml:"partitionname" json:"partitionname"`
+	DeviceOwner       string   `xml:"deviceowner" json:"deviceowner"` // pkid of device owner user
+	PrimaryLine       bool     `xml:"primaryline" json:"primaryline"` // line is primary extension of user
+	ModelEnum         int      `xml:"modelenum" json:"modelenum"`     // CUCM device model (tkmodel)
+	ClassEnum         int      `xml:"classenum" json:"classenum"`     // CUCM device class (tkclass)
+	DeviceClass       string   `xml:"deviceclass" json:"deviceclass"` // CUCM device class name
+	DeviceTypeName    string   `xml:"-" json:"devicetype"`            // device type from classification
+	ExcludeMapping    bool     `xml:"-" json:"exclude_mapping"`       // device type is not used for couple mapping
 }
 
 func NewUserDeviceLineList(response string) (*UserDeviceLineList, error) {
-	var data UserDeviceLineList
-	d := []byte(response)
-	err := xml.Unmarshal(d, &data)
+	data := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	fault, err := DecodeSoapRows(strings.NewReader(response), data.rowHandler)
+	if err == nil && fault != nil {
+		err = errors.New(fault.FaultString)
+	}
 	if err != nil {
 		log.WithField("error", err).Errorf("problem unmarshal data from response")
-		data = UserDeviceLineList{Rows: []UserDeviceLine{}}
-	} else {
-		log.WithField("data", response).Tracef("use this list of data")
-		if !config.Processing.CoexistCcxImporter {
-			for i, _ := range data.Rows {
-				data.Rows[i].Uccx = false
-			}
-			log.Tracef("remove UCCX Integration value")
-		}
+		data.Rows = []UserDeviceLine{}
+	}
+	return data, err
+}
+
+// rowHandler decode one row and add it to list
+func (u *UserDeviceLineList) rowHandler(decoder *xml.Decoder, start *xml.StartElement) error {
+	var row UserDeviceLine
+	if err := decoder.DecodeElement(&row, start); err != nil {
+		return err
+	}
+	if !config.Processing.CoexistCcxImporter {
+		row.Uccx = false
 	}
-	return &data, err
+	u.Rows = append(u.Rows, row)
+	return nil
+}
+
+// SetClusterName replace cluster name from CUCM by configured name
+func (u *UserDeviceLineList) SetClusterName(name string) {
+	if len(name) < 1 {
+		return
+	}
+	for i := range u.Rows {
+		u.Rows[i].ClusterName = name
+	}
+}
+
+// clusterKey make pkid unique across clusters
+func (u *UserDeviceLine) clusterKey(pkid string) string {
+	return u.ClusterName + "_" + pkid
+}
+
+// lineKey identify line by DN and route partition, same DN in other partition is other line
+func (u *UserDeviceLine) lineKey() string {
+	return u.clusterKey(u.LineNumber + "@" + u.Partition)
+}
+
+// lineName return DN with route partition for messages
+func (u *UserDeviceLine) lineName() string {
+	if len(u.Partition) < 1 {
+		return u.LineNumber
+	}
+	return u.LineNumber + " in " + u.Partition
 }
 
 func (u *UserDeviceLineList) GetDuplicateDevices() *Duplicates {
+	return u.ResolveDuplicateDevices(nil)
+}
+
+// ResolveDuplicateDevices find devices and lines associated to more users and choose winners by resolver
+func (u *UserDeviceLineList) ResolveDuplicateDevices(resolver *SharedResolver) *Duplicates {
 
 	data := Duplicates{
 		device: make(map[string]*UniqueList),
@@ -64,46 +114,58 @@ func (u *UserDeviceLineList) GetDuplicateDevices() *Duplicates {
 	}
 
 	for _, r := range u.Rows {
-		if _, ok := data.device[r.DevicePKID]; ok {
-			data.device[r.DevicePKID].Add(r.UserPKID)
+		if r.ExcludeMapping {
+			// device type not used for couple mapping
+			continue
+		}
+		userKey := r.clusterKey(r.UserPKID)
+		deviceKey := r.clusterKey(r.DevicePKID)
+		lineKey := r.lineKey()
+		if _, ok := data.device[deviceKey]; ok {
+			data.device[deviceKey].Add(userKey)
 		} else {
-			data.device[r.DevicePKID] = NewUniqueList(r.DeviceName, r.DeviceDescription, r.UserPKID)
+			data.device[deviceKey] = NewUniqueList(r.DeviceName, r.DeviceDescription, userKey)
+			data.device[deviceKey].deviceType = r.DeviceType()
 		}
 
-		if _, ok := data.line[r.LinePKID]; ok {
-			data.line[r.LinePKID].Add(r.UserPKID)
+		if _, ok := data.line[lineKey]; ok {
+			data.line[lineKey].Add(userKey)
 		} else {
-			data.line[r.LinePKID] = NewUniqueList(r.LineNumber, r.LineAlertingName, r.UserPKID)
+			data.line[lineKey] = NewUniqueList(r.lineName(), r.LineAlertingName, userKey)
 		}
 
-		if _, ok := data.user[r.UserPKID]; ok {
+		if _, ok := data.user[userKey]; ok {
 		} else {
-			data.user[r.UserPKID] = NewUniqueList(r.UserId, fmt.Sprintf("%s %s", r.FirstName, r.LastName), "x")
+			data.user[userKey] = NewUniqueList(r.UserId, fmt.Sprintf("%s %s", r.FirstName, r.LastName), "x")
 		}
 	}
+	data.Resolve(u.Rows, resolver)
 	data.GenerateErrors()
 
 	return &data
 }
 
-func (u *UserDeviceLineList) cleanDeviceLineList() []UserDeviceLine {
+// cleanDeviceLineList remove rows with not resolved duplicates, return valid rows and duplicates for report
+func (u *UserDeviceLineList) cleanDeviceLineList() ([]UserDeviceLine, *Duplicates) {
 	log.WithField("rows", len(u.Rows)).Debugf("from AXL select %d rows combination user/device/line", len(u.Rows))
-	duplicates := u.GetDuplicateDevices()
+	duplicates := u.ResolveDuplicateDevices(NewSharedResolver(&config.Shared))
 	if len(duplicates.errors) > 0 {
-		log.Error("all duplicate association remove from source data")
+		log.Error("duplicate association found, rows without resolved winner remove from source data")
 		for _, d := range duplicates.errors {
 			log.Error(d)
 		}
 	}
 	ret := u.removeDuplicates(duplicates)
-	return ret
+	return ret, duplicates
 }
 
+// inDuplicates identify row with shared device or line, row of winner is kept
 func (u *UserDeviceLine) inDuplicates(dup *Duplicates) bool {
-	if _, ok := dup.device[u.DevicePKID]; ok {
+	userKey := u.clusterKey(u.UserPKID)
+	if d, ok := dup.device[u.clusterKey(u.DevicePKID)]; ok && !d.IsWinner(userKey) {
 		return true
 	}
-	if _, ok := dup.line[u.LinePKID]; ok {
+	if l, ok := dup.line[u.lineKey()]; ok && !l.IsWinner(userKey) {
 		return true
 	} else {
 		return false
@@ -124,28 +186,61 @@ func (u *UserDeviceLineList) removeDuplicates(dup *Duplicates) []UserDeviceLine
 
 func (s *Connection) GetUserDeviceLineList() *UserDeviceLineList {
 	log.WithField("id", s.id).Trace("get table with user/device/line details from AXL")
-	var jtapi []string
-	users := strings.Join(config.Zqm.JtapiUser, "','")
-	jtapi = append(jtapi, strings.ToLower(users))
-	sql := NewUserDeviceLineSql(jtapi)
+	if s.useTypedApi() {
+		return s.getTypedUserDeviceLineList()
+	}
+	sql := NewUserDeviceLineSql(s.jtapiUsers())
 	if !sql.IsParametersValid() {
 		log.WithField("id", s.id).Errorf("Not valid request parameters")
 		return nil
 	}
 	request := NewRequest(s.client, s)
-	log.WithFields(log.Fields{"id": s.id, "sql": sql.ToString()}).Debugf("Request for %s", strings.Join(config.Zqm.JtapiUser, ","))
-	response := request.SqlRequest(sql.ToString())
-	msg, err := response.ResponseError()
+	log.WithFields(log.Fields{"id": s.id, "sql": sql.ToString()}).Debugf("Request for %s", strings.Join(s.jtapiUsers(), ","))
+	data := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	err := request.SqlRowsRequest(sql.ToString(), data.rowHandler)
 	if err != nil {
-		response.Close()
-		log.WithField("id", s.id).Errorf("%s. HTTP Status [%s]", msg, response.statusMessage)
+		if s.switchToTypedApi(err) {
+			return s.getTypedUserDeviceLineList()
+		}
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read user/device/line list from AXL")
 		return nil
 	}
-	data, err := NewUserDeviceLineList(response.GetResponseBody())
-	if err != nil {
-		log.WithField("id", s.id).Errorf("Can't convert returned data to Version structure")
-		return nil
+	if config.Processing.ExtensionMobility {
+		if err := s.readDeviceProfiles(NewDeviceProfileSql(), data); err != nil {
+			return nil
+		}
 	}
-	log.WithField("id", s.id).Trace("Success read DB version from AXL")
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read user/device/line list from AXL")
 	return data
 }
+
+// AppendRows add rows not already in list, device profile can be controlled by JTAPI user too
+func (u *UserDeviceLineList) AppendRows(rows []UserDeviceLine) {
+	known := map[string]bool{}
+	for _, r := range u.Rows {
+		known[r.UserPKID+r.DevicePKID+r.LinePKID] = true
+	}
+	for _, r := range rows {
+		if !known[r.UserPKID+r.DevicePKID+r.LinePKID] {
+			known[r.UserPKID+r.DevicePKID+r.LinePKID] = true
+			u.Rows = append(u.Rows, r)
+		}
+	}
+}
+
+// readDeviceProfiles add Extension Mobility device profiles and their lines to user/device/line rows
+func (s *Connection) readDeviceProfiles(sql *SqlQuery, data *UserDeviceLineList) error {
+	if !sql.IsParametersValid() {
+		log.WithField("id", s.id).Errorf("Not valid request parameters for device profiles")
+		return errors.New("not valid request parameters")
+	}
+	profiles := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	if err := NewRequest(s.client, s).SqlRowsRequest(sql.ToString(), profiles.rowHandler); err != nil {
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read device profiles from AXL")
+		return err
+	}
+	data.AppendRows(profiles.Rows)
+	log.WithFields(log.Fields{"id": s.id, "rows": len(profiles.Rows)}).Trace("Success read device profiles from AXL")
+	return nil
+}
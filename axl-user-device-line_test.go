@@ -1,6 +1,10 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
 
 func TestNewUserDeviceLineList(t *testing.T) {
 	t.Parallel()
@@ -134,3 +138,114 @@ var deviceLineTables = []struct {
 	{deviceLineResponse, "11.5.1.14900(11)", "11.0"},
 	{failResponse, "", ""},
 }
+
+func TestUserDeviceLineList_GetDuplicateDevicesCluster(t *testing.T) {
+	t.Parallel()
+	row := UserDeviceLine{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1", UserId: "agent", DeviceName: "SEP001", LineNumber: "1001"}
+	tables := []struct {
+		clusters []string
+		users    []string
+		devices  int
+		lines    int
+		name     string
+	}{
+		{[]string{"A", "B"}, []string{"u1", "u2"}, 0, 0, "same pkid in two clusters"},
+		{[]string{"A", "A"}, []string{"u1", "u2"}, 1, 1, "shared device in one cluster"},
+		{[]string{"A", "B"}, []string{"u1", "u1"}, 0, 0, "same user pkid in two clusters"},
+	}
+	for _, table := range tables {
+		list := UserDeviceLineList{}
+		for i, cluster := range table.clusters {
+			r := row
+			r.ClusterName = cluster
+			r.UserPKID = table.users[i]
+			list.Rows = append(list.Rows, r)
+		}
+		dup := list.GetDuplicateDevices()
+		if len(dup.device) != table.devices || len(dup.line) != table.lines {
+			t.Errorf("not expected duplicates for [%s] - devices [%d / %d], lines [%d / %d]", table.name, len(dup.device), table.devices, len(dup.line), table.lines)
+		}
+		if clean, _ := list.cleanDeviceLineList(); len(clean) != len(list.Rows)-2*table.devices {
+			t.Errorf("not expected clean rows for [%s]", table.name)
+		}
+	}
+}
+
+func TestUserDeviceLineList_GetDuplicateDevicesPartition(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		partitions []string
+		lines      int
+		name       string
+	}{
+		{[]string{"Internal_PT", "Lobby_PT"}, 0, "same DN in two partitions"},
+		{[]string{"Internal_PT", "Internal_PT"}, 1, "shared line in one partition"},
+		{[]string{"", "Internal_PT"}, 0, "DN without partition"},
+	}
+	for _, table := range tables {
+		list := UserDeviceLineList{}
+		for i, partition := range table.partitions {
+			list.Rows = append(list.Rows, UserDeviceLine{UserPKID: fmt.Sprintf("u%d", i), DevicePKID: fmt.Sprintf("d%d", i), LinePKID: fmt.Sprintf("l%d", i),
+				UserId: fmt.Sprintf("agent%d", i), DeviceName: fmt.Sprintf("SEP00%d", i), LineNumber: "2101", Partition: partition, ClusterName: "A"})
+		}
+		dup := list.GetDuplicateDevices()
+		if len(dup.line) != table.lines || len(dup.device) != 0 {
+			t.Errorf("not expected duplicates for [%s] - lines [%d / %d]", table.name, len(dup.line), table.lines)
+		}
+		if table.lines > 0 && !strings.Contains(strings.Join(dup.errors, ""), "2101 in Internal_PT") {
+			t.Errorf("partition not in duplicate message for [%s] - %v", table.name, dup.errors)
+		}
+	}
+}
+
+func TestUserDeviceLineList_ResolveDuplicateDevices(t *testing.T) {
+	t.Parallel()
+	// agent0 own shared device SEP001, line 2101 is primary extension of agent1
+	rows := []UserDeviceLine{
+		{UserPKID: "u0", DevicePKID: "d1", LinePKID: "l1", UserId: "agent0", DeviceName: "SEP001", LineNumber: "2101", Partition: "Internal_PT", ClusterName: "A", DeviceOwner: "u0"},
+		{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1", UserId: "agent1", DeviceName: "SEP001", LineNumber: "2101", Partition: "Internal_PT", ClusterName: "A", DeviceOwner: "u0", PrimaryLine: true},
+	}
+	tables := []struct {
+		shared ConfigShared
+		winner string
+		reason string
+		name   string
+	}{
+		{ConfigShared{}, "", "removed", "default drop"},
+		{ConfigShared{Policy: []string{SharedDrop, SharedOwner}}, "", "removed", "drop before owner"},
+		{ConfigShared{Policy: []string{SharedOwner}}, "agent0", "device owner", "device owner"},
+		{ConfigShared{Policy: []string{SharedPrimary, SharedOwner}}, "agent1", "primary extension", "primary extension"},
+		{ConfigShared{Policy: []string{SharedManual, SharedOwner}, Winners: []ConfigSharedWinner{{Device: "sep001", UserId: "agent1"}, {Line: "2101", Partition: "Internal_PT", UserId: "agent1"}}}, "agent1", "manual winner", "manual winner"},
+		{ConfigShared{Policy: []string{SharedManual}, Winners: []ConfigSharedWinner{{Device: "SEP001", UserId: "agent1"}, {Line: "2101", Partition: "Lobby_PT", UserId: "agent1"}}}, "", "removed", "manual line in other partition"},
+	}
+	for _, table := range tables {
+		list := UserDeviceLineList{Rows: rows}
+		dup := list.ResolveDuplicateDevices(NewSharedResolver(&table.shared))
+		if len(dup.errors) != 2 || !strings.Contains(strings.Join(dup.errors, ""), table.reason) {
+			t.Errorf("not expected duplicate message for [%s] - %v", table.name, dup.errors)
+		}
+		clean := list.removeDuplicates(dup)
+		if len(table.winner) < 1 {
+			if len(clean) != 0 {
+				t.Errorf("not expected rows for [%s] - %v", table.name, clean)
+			}
+			continue
+		}
+		if len(clean) != 1 || clean[0].UserId != table.winner {
+			t.Errorf("not expected winner for [%s] - %v", table.name, clean)
+		}
+	}
+}
+
+func TestUserDeviceLineList_AppendRows(t *testing.T) {
+	t.Parallel()
+	list := UserDeviceLineList{Rows: []UserDeviceLine{{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1"}}}
+	list.AppendRows([]UserDeviceLine{
+		{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1"},
+		{UserPKID: "u1", DevicePKID: "p1", LinePKID: "l2"},
+		{UserPKID: "u1", DevicePKID: "p1", LinePKID: "l2"},
+	})
+	if len(list.Rows) != 2 || list.Rows[1].DevicePKID != "p1" {
+		t.Errorf("not expected rows after append %v", list.Rows)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+type UserGroupList struct {
+	XMLName xml.Name    `xml:"return"`
+	Rows    []UserGroup `xml:"row"`
+}
+
+// UserGroup is membership of end user in access control group used in role mapping
+type UserGroup struct {
+	XMLName     xml.Name `xml:"row"`
+	UserPKID    string   `xml:"user_pkid" json:"user_pkid"`
+	GroupName   string   `xml:"groupname" json:"groupname"`
+	ClusterName string   `xml:"cluster_name" json:"cluster_name"`
+}
+
+// rowHandler decode one row and add it to list
+func (u *UserGroupList) rowHandler(decoder *xml.Decoder, start *xml.StartElement) error {
+	var row UserGroup
+	if err := decoder.DecodeElement(&row, start); err != nil {
+		return err
+	}
+	u.Rows = append(u.Rows, row)
+	return nil
+}
+
+// SetClusterName replace cluster name from CUCM by configured name
+func (u *UserGroupList) SetClusterName(name string) {
+	if len(name) < 1 {
+		return
+	}
+	for i := range u.Rows {
+		u.Rows[i].ClusterName = name
+	}
+}
+
+// GetUserGroupList read membership in access control groups from role mapping, empty list when groups are not defined
+func (s *Connection) GetUserGroupList(groups []string) *UserGroupList {
+	if len(groups) < 1 {
+		return &UserGroupList{Rows: []UserGroup{}}
+	}
+	log.WithField("id", s.id).Trace("get access control group membership from AXL")
+	if s.useTypedApi() {
+		return s.getTypedUserGroupList(groups)
+	}
+	sql := NewUserGroupSql(groups)
+	if !sql.IsParametersValid() {
+		log.WithField("id", s.id).Errorf("Not valid request parameters for role mapping groups")
+		return nil
+	}
+	log.WithFields(log.Fields{"id": s.id, "sql": sql.ToString()}).Debugf("Request for %s", strings.Join(groups, ","))
+	data := &UserGroupList{Rows: []UserGroup{}}
+	err := NewRequest(s.client, s).SqlRowsRequest(sql.ToString(), data.rowHandler)
+	if err != nil {
+		if s.switchToTypedApi(err) {
+			return s.getTypedUserGroupList(groups)
+		}
+		log.WithFields(log.Fields{"id": s.id, "error": err}).Errorf("problem read access control group membership from AXL")
+		return nil
+	}
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read access control group membership from AXL")
+	return data
+}
+
+// GetChangedUserGroupList read group membership only for changed users
+func (s *Connection) GetChangedUserGroupList(groups []string, pkid []string) *UserGroupList {
+	data := &UserGroupList{Rows: []UserGroup{}}
+	if len(groups) < 1 {
+		return data
+	}
+	if err := s.changedRowsRequest(NewChangedUserGroupSql(groups, pkid), data.rowHandler); err != nil {
+		return nil
+	}
+	data.SetClusterName(s.clusterName())
+	return data
+}
+
+// getTypedUserGroupList build group membership from user details read by typed API
+func (s *Connection) getTypedUserGroupList(groups []string) *UserGroupList {
+	if err := s.loadTypedUsers(); err != nil {
+		return nil
+	}
+	data := &UserGroupList{Rows: []UserGroup{}}
+	for _, r := range s.typed.users {
+		for _, g := range r.detail.Groups {
+			for _, group := range groups {
+				if strings.EqualFold(g, group) {
+					data.Rows = append(data.Rows, UserGroup{UserPKID: typedPkid(r.user.Uuid), GroupName: g})
+					break
+				}
+			}
+		}
+	}
+	data.SetClusterName(s.clusterName())
+	log.WithFields(log.Fields{"id": s.id, "rows": len(data.Rows)}).Trace("Success read access control group membership by typed AXL API")
+	return data
+}
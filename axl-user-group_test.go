@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"go-zqm-axl-importer/fakeaxl"
+	"testing"
+)
+
+func TestFakeAxl_GetUserGroupList(t *testing.T) {
+	server := fakeaxl.NewServer(fakeaxl.Options{Fixtures: fakeFixtures})
+	defer server.Close()
+	connection := fakeConnection(t, context.Background(), "FAKE-GROUP", server)
+	connection.dbVersion = "12.5"
+	if data := connection.GetUserGroupList(nil); data == nil || len(data.Rows) != 0 {
+		t.Errorf("not expected group membership without role mapping %v", data)
+	}
+	if server.Requests("executeSQLQuery") != 0 {
+		t.Errorf("group membership read without role mapping")
+	}
+	data := connection.GetUserGroupList([]string{"QM Supervisors", "QM Evaluators"})
+	if data == nil || len(data.Rows) != 4 {
+		t.Fatalf("not expected group membership %v", data)
+	}
+	if data.Rows[3].GroupName != "QM Supervisors" || data.Rows[3].ClusterName != "FAKE-GROUP" {
+		t.Errorf("not expected group membership row %+v", data.Rows[3])
+	}
+	if changed := connection.GetChangedUserGroupList(nil, []string{"aaa"}); changed == nil || len(changed.Rows) != 0 {
+		t.Errorf("not expected changed group membership without role mapping %v", changed)
+	}
+}
@@ -4,9 +4,17 @@ import (
 	"encoding/xml"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+var (
+	schemaVersionFormat = regexp.MustCompile(`^\d{1,2}\.\d$`)
+	cucmVersionPrefix   = regexp.MustCompile(`^(\d+)\.(\d+)`)
+	faultSchemaVersion  = regexp.MustCompile(`(?:^|[^\d.])(\d{1,2}\.\d)(?:[^\d.]|$)`)
+)
+
 type Version struct {
 	XMLName xml.Name `xml:"return"`
 	Version string   `xml:"componentVersion>version"`
@@ -48,6 +56,41 @@ func (v *Version) GetDbVersion() string {
 	return ver
 }
 
+// GetSchemaVersion return AXL schema version (major.minor) for CUCM version, 12.5.1.11900-146 is 12.5
+func (v *Version) GetSchemaVersion() string {
+	m := cucmVersionPrefix.FindStringSubmatch(v.Version)
+	if m == nil {
+		return ""
+	}
+	return m[1] + "." + m[2]
+}
+
+func IsValidSchemaVersion(version string) bool {
+	return schemaVersionFormat.MatchString(version)
+}
+
+// nextSchemaVersion select next schema version for negotiation. Highest not tried version from fault text
+// is preferred, then versions from default list.
+func nextSchemaVersion(fault string, tried map[string]bool) string {
+	best, bestValue := "", 0.0
+	for _, m := range faultSchemaVersion.FindAllStringSubmatch(fault, -1) {
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil || tried[m[1]] || value < bestValue {
+			continue
+		}
+		best, bestValue = m[1], value
+	}
+	if len(best) > 0 {
+		return best
+	}
+	for _, version := range dbVersionSupport {
+		if !tried[version] {
+			return version
+		}
+	}
+	return ""
+}
+
 func (s *Connection) GetVersion() *Version {
 	request := NewRequest(s.client, s)
 	response := request.DbVersionRequest()
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"net/http"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -85,6 +88,84 @@ func TestVersion_GetDbVersion(t *testing.T) {
 	}
 }
 
+func TestVersion_GetSchemaVersion(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		version string
+		schema  string
+	}{
+		{"11.5.1.14900(11)", "11.5"},
+		{"12.5.1.11900-146", "12.5"},
+		{"15.0.1.10000-32", "15.0"},
+		{"", ""},
+		{"unknown", ""},
+	}
+	for _, table := range tables {
+		v := Version{Version: table.version}
+		if v.GetSchemaVersion() != table.schema {
+			t.Errorf("invalid schema version for [%s] - [%s / %s]", table.version, v.GetSchemaVersion(), table.schema)
+		}
+	}
+}
+
+func TestNextSchemaVersion(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		fault string
+		tried []string
+		next  string
+		name  string
+	}{
+		{failResponse, []string{"10.0"}, "12.0", "EPR fault with IP address"},
+		{"Supported AXL versions: 10.5, 11.0, 12.5", []string{"10.0"}, "12.5", "supported list"},
+		{"Supported AXL versions: 10.5, 11.0, 12.5", []string{"10.0", "12.5"}, "11.0", "highest already tried"},
+		{"", []string{"10.0", "12.0", "14.0", "16.0"}, "", "all tried"},
+	}
+	for _, table := range tables {
+		tried := map[string]bool{}
+		for _, v := range table.tried {
+			tried[v] = true
+		}
+		if next := nextSchemaVersion(table.fault, tried); next != table.next {
+			t.Errorf("not expected next version for [%s] - [%s / %s]", table.name, next, table.next)
+		}
+	}
+}
+
+func TestConnection_DbVersionNegotiation(t *testing.T) {
+	t.Parallel()
+	namespace := regexp.MustCompile(`AXL/API/([\d.]+)`)
+	tables := []struct {
+		hint     string
+		fixed    bool
+		version  string
+		requests int
+		name     string
+	}{
+		{"", false, "12.5", 2, "negotiate from fault"},
+		{"12.5", false, "12.5", 1, "cached version"},
+		{"11.0", true, DbVersionError, 1, "fixed version not supported"},
+		{"12.5", true, "12.5", 1, "fixed version"},
+	}
+	for _, table := range tables {
+		var requests int
+		connection := NewConnection("localhost", "user", "pwd")
+		connection.SetSchemaVersion(table.hint, table.fixed)
+		connection.SetClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+			requests++
+			b, _ := ioutil.ReadAll(r.Body)
+			if namespace.FindStringSubmatch(string(b))[1] != "12.5" {
+				return soapResponse(599, "<faultstring>Unsupported AXL version, supported versions: 10.5, 11.0, 12.5</faultstring>")
+			}
+			return soapResponse(200, "<return><componentVersion><version>12.5.1.11900-146</version></componentVersion></return>")
+		})})
+		version, _ := connection.DbVersion()
+		if version != table.version || requests != table.requests {
+			t.Errorf("not expected negotiation for [%s] - [%s %d / %s %d]", table.name, version, requests, table.version, table.requests)
+		}
+	}
+}
+
 const (
 	versionSuccess11 = `<return><componentVersion><version>11.5.1.14900(11)</version></componentVersion></return>`
 	versionSuccess10 = `<return><componentVersion><version>10.5.0</version></componentVersion></return>`
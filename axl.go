@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/xml"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -14,6 +16,9 @@ var dbVersionSupport = [...]string{"10.0", "12.0", "14.0", "16.0"}
 type Connection struct {
 	id          string
 	server      string
+	port        int
+	nodes       []ConfigAxlNode
+	node        int
 	user        string
 	pwd         string
 	dbVersion   string
@@ -21,6 +26,16 @@ type Connection struct {
 	sequence    int
 	isAuthValid bool
 	client      *http.Client
+	tlsConfig   *tls.Config
+	retry       *RetryPolicy
+	limiter     *RateLimiter
+	cluster     *ConfigAxl
+	ctx         context.Context
+	api         string
+	typed       *typedCache
+	schemaHint  string // AXL schema version tried first
+	schemaFixed bool   // schema version from configuration, not negotiated
+	cucmVersion string
 }
 
 type AxlRowsData struct {
@@ -51,20 +66,78 @@ type IApiData interface {
 }
 
 func NewConnection(server string, user string, pwd string, time ...int) *Connection {
+	return NewNodesConnection([]ConfigAxlNode{{Server: server, Port: AxlPort.Default}}, user, pwd, time...)
+}
+
+// NewNodesConnection create connection with list of CUCM nodes, next node is used when active node fails
+func NewNodesConnection(nodes []ConfigAxlNode, user string, pwd string, time ...int) *Connection {
 	a := RandomString()
-	log.WithFields(log.Fields{"id": a, "server": server, "user": user, "pwd": pwd}).Tracef("create connection")
+	log.WithFields(log.Fields{"id": a, "nodes": len(nodes), "user": user, "pwd": pwd}).Tracef("create connection")
 	timeOut := 30
 	if len(time) > 0 {
 		timeOut = time[0]
 	}
-	con := Connection{server: server, user: user, pwd: pwd, dbVersion: "", timeOut: timeOut, sequence: 10, isAuthValid: false, client: nil, id: a}
+	con := Connection{nodes: nodes, user: user, pwd: pwd, dbVersion: "", timeOut: timeOut, sequence: 10, isAuthValid: false, client: nil, id: a,
+		retry: &RetryPolicy{MaxAttempts: 1}, limiter: nil, ctx: context.Background(), api: DefaultApi}
+	con.SetActiveNode(0)
 	return &con
 }
 
+// SetActiveNode select node used for next requests
+func (s *Connection) SetActiveNode(node int) {
+	if len(s.nodes) < 1 {
+		return
+	}
+	if node < 0 || node >= len(s.nodes) {
+		node = 0
+	}
+	s.node = node
+	s.server = s.nodes[node].Server
+	s.port = s.nodes[node].Port
+}
+
+func (s *Connection) ActiveNode() int {
+	return s.node
+}
+
+func (s *Connection) nextNode() {
+	failed := s.nodes[s.node].String()
+	s.SetActiveNode((s.node + 1) % len(s.nodes))
+	log.WithFields(log.Fields{"id": s.id, "failed": failed, "server": s.server}).Warningf("AXL node %s not available, switch to node %s", failed, s.nodes[s.node].String())
+}
+
 func (s *Connection) SetClient(client *http.Client) {
 	s.client = client
 }
 
+// SetContext set context for all requests, cancelled context stop requests and retries
+func (s *Connection) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// SetSchemaVersion set AXL schema version tried first, fixed version is not negotiated
+func (s *Connection) SetSchemaVersion(version string, fixed bool) {
+	s.schemaHint = version
+	s.schemaFixed = fixed && len(version) > 0
+}
+
+// SetApi select AXL API used for read data (sql, typed, auto)
+func (s *Connection) SetApi(api string) {
+	if len(api) < 1 {
+		api = DefaultApi
+	}
+	s.api = api
+}
+
+func (s *Connection) SetTlsConfig(tlsConfig *tls.Config) {
+	s.tlsConfig = tlsConfig
+}
+
+func (s *Connection) SetRetry(retry *RetryPolicy, limiter *RateLimiter) {
+	s.retry = retry
+	s.limiter = limiter
+}
+
 func (s *Connection) IsLoginValid() (bool, error) {
 	if s.dbVersion == "" {
 		_, err := s.DbVersion()
@@ -77,12 +150,21 @@ func (s *Connection) IsLoginValid() (bool, error) {
 	return s.isAuthValid, nil
 }
 
+// DbVersion negotiate AXL schema version. Configured or cached version is tried first, other versions are read
+// from getCCMVersion response or from fault of unsupported schema.
 func (s *Connection) DbVersion() (string, error) {
 	log.WithFields(log.Fields{"id": s.id, "server": s.server}).Trace("start identify AXL DB version")
 	var err error
 	if s.dbVersion == "" {
-		for i := 0; i < len(dbVersionSupport); i++ {
-			s.dbVersion = dbVersionSupport[i]
+		tried := map[string]bool{}
+		next := s.schemaHint
+		if next == "" {
+			next = dbVersionSupport[0]
+		}
+		for next != "" {
+			tried[next] = true
+			s.dbVersion = next
+			next = ""
 			log.WithFields(log.Fields{"id": s.id, "server": s.server}).Debugf("test version [%s]", s.dbVersion)
 
 			request := NewRequest(s.client, s)
@@ -92,11 +174,6 @@ func (s *Connection) DbVersion() (string, error) {
 				resp.Close()
 				return resp.lastMessage, resp.err
 			}
-			if resp.statusCode == 599 {
-				s.dbVersion = DbVersionError
-				resp.Close()
-				continue
-			}
 			if resp.statusCode == 401 {
 				s.isAuthValid = false
 				resp.Close()
@@ -105,16 +182,27 @@ func (s *Connection) DbVersion() (string, error) {
 			}
 			if resp.statusCode == 200 {
 				v, err := VersionData(resp.GetResponseBody())
-				if err == nil {
-					log.WithFields(log.Fields{"id": s.id, "AXLVersion": v.Version, "AXL-DB": v.GetDbVersion(), "server": s.server}).Infof("actual AXL version [%s], DbVersion [%s]", v.Version, v.GetDbVersion())
-					s.dbVersion = v.GetDbVersion()
+				if err == nil && v.IsValid() {
+					s.cucmVersion = v.Version
+					if !s.schemaFixed && len(v.GetSchemaVersion()) > 0 {
+						s.dbVersion = v.GetSchemaVersion()
+					}
+					log.WithFields(log.Fields{"id": s.id, "AXLVersion": v.Version, "AXL-DB": s.dbVersion, "server": s.server}).Infof("actual AXL version [%s], DbVersion [%s]", v.Version, s.dbVersion)
 					resp.Close()
 					break
 				}
 				log.WithFields(log.Fields{"id": s.id, "server": s.server}).Warningf("problem convert XML data to version structure")
+				s.dbVersion = DbVersionError
+				resp.Close()
+				break
 			}
+			body, _ := resp.GetRawBody()
 			s.dbVersion = DbVersionError
-			resp.Close()
+			if s.schemaFixed {
+				log.WithFields(log.Fields{"id": s.id, "server": s.server, "status": resp.statusMessage}).Errorf("configured AXL schema version not accepted")
+				break
+			}
+			next = nextSchemaVersion(body, tried)
 		}
 	}
 	s.isAuthValid = true
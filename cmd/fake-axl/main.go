@@ -0,0 +1,53 @@
+// Command fake-axl run local fake CUCM AXL server for demos and manual tests of importer.
+// Configure importer cluster with ignoreCertificate, server and port from --listen.
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go-zqm-axl-importer/fakeaxl"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+var (
+	listen   = kingpin.Flag("listen", "Listen address").Default("127.0.0.1:8443").String()
+	fixtures = kingpin.Flag("fixtures", "Directory with fixture files").Default("fakeaxl/fixtures").ExistingDir()
+	version  = kingpin.Flag("version", "CUCM version returned by getCCMVersion").Default(fakeaxl.DefaultVersion).String()
+	schemas  = kingpin.Flag("schemas", "Accepted AXL schema versions separated by comma, empty accept all").Default("").String()
+	user     = kingpin.Flag("user", "AXL user, empty disable authorization").Default("").String()
+	password = kingpin.Flag("password", "AXL password").Default("").String()
+	fetchMax = kingpin.Flag("fetch-max", "Rows limit of one executeSQLQuery response").Default("1000").Int()
+	delay    = kingpin.Flag("delay", "Delay before every response").Default("0s").Duration()
+)
+
+func main() {
+	kingpin.HelpFlag.Short('h')
+	kingpin.Parse()
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("can't listen on %s: %s", *listen, err)
+	}
+	var accepted []string
+	if len(*schemas) > 0 {
+		accepted = strings.Split(*schemas, ",")
+	}
+	server := fakeaxl.NewServerListener(l, fakeaxl.Options{
+		Fixtures: *fixtures,
+		Version:  *version,
+		Schemas:  accepted,
+		User:     *user,
+		Password: *password,
+		FetchMax: *fetchMax,
+		Delay:    *delay,
+	})
+	defer server.Close()
+	log.Infof("fake AXL server listen on %s", server.URL)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	<-quit
+	log.Info("fake AXL server stopped")
+}
@@ -0,0 +1,246 @@
+// Package fakeaxl is fake CUCM AXL SOAP server for tests and demos without real cluster.
+// Server answer getCCMVersion and executeSQLQuery with rows from fixture files and simulate
+// authorization problem (401), not supported schema (599), "Query request too large" and slow responses.
+package fakeaxl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultVersion  = "12.5.1.11900-146"
+	DefaultFetchMax = 1000
+)
+
+var (
+	operationPattern = regexp.MustCompile(`<(?:\w+:)?(\w+)\s+sequence=`)
+	schemaPattern    = regexp.MustCompile(`http://www\.cisco\.com/AXL/API/([\d.]+)`)
+	sqlPattern       = regexp.MustCompile(`(?s)<sql>(.*)</sql>`)
+	pagePattern      = regexp.MustCompile(`(?i)^\s*select\s+skip\s+(\d+)\s+limit\s+(\d+)\s`)
+	rowPattern       = regexp.MustCompile(`(?s)<row>.*?</row>`)
+)
+
+// DefaultQueries map SQL fragment to fixture file, first match is used
+var DefaultQueries = []Query{
+	{Match: "d.tkclass = 254", Fixture: "device-profile.xml"},
+	{Match: "devicenumplanmap", Fixture: "user-device-line.xml"},
+	{Match: "from extensionmobilitydynamic", Fixture: "em-session.xml"},
+	{Match: "as groupname", Fixture: "user-group.xml"},
+	{Match: "enduserdirgroupmap", Fixture: "login-user.xml"},
+	{Match: "from numplan", Fixture: "numplan.xml"},
+	{Match: "from dirgroup", Fixture: "dirgroup.xml"},
+}
+
+type Query struct {
+	Match   string // SQL fragment (case insensitive)
+	Fixture string // fixture file with <row> elements
+}
+
+type Options struct {
+	Fixtures string        // directory with fixture files
+	Queries  []Query       // SQL to fixture mapping, default is DefaultQueries
+	Version  string        // CUCM version returned by getCCMVersion
+	Schemas  []string      // accepted AXL schema versions, other return 599. Empty accept all
+	User     string        // AXL user, empty disable authorization
+	Password string        // AXL password
+	FetchMax int           // rows limit of one response, bigger response return "Query request too large"
+	Delay    time.Duration // delay before every response
+}
+
+type Server struct {
+	*httptest.Server
+	options  Options
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// NewServer start fake AXL server on random local port with TLS
+func NewServer(options Options) *Server {
+	s := newServer(options)
+	s.StartTLS()
+	return s
+}
+
+// NewServerListener start fake AXL server with TLS on listener, used by fake-axl command
+func NewServerListener(l net.Listener, options Options) *Server {
+	s := newServer(options)
+	_ = s.Server.Listener.Close()
+	s.Server.Listener = l
+	s.StartTLS()
+	return s
+}
+
+func newServer(options Options) *Server {
+	if len(options.Version) < 1 {
+		options.Version = DefaultVersion
+	}
+	if options.FetchMax < 1 {
+		options.FetchMax = DefaultFetchMax
+	}
+	if len(options.Queries) < 1 {
+		options.Queries = DefaultQueries
+	}
+	s := &Server{options: options, requests: map[string]int{}}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Host return server address without port
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Listener.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Requests return number of requests for AXL operation
+func (s *Server) Requests(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[operation]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.options.Delay > 0 {
+		select {
+		case <-time.After(s.options.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if len(s.options.User) > 0 {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != s.options.User || password != s.options.Password {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := string(b)
+	operation := ""
+	if m := operationPattern.FindStringSubmatch(body); m != nil {
+		operation = m[1]
+	}
+	s.mu.Lock()
+	s.requests[operation]++
+	s.mu.Unlock()
+
+	if !s.schemaSupported(body) {
+		w.WriteHeader(599)
+		_, _ = fmt.Fprintf(w, "Unsupported AXL schema version, supported versions: %s", strings.Join(s.options.Schemas, ", "))
+		return
+	}
+	switch operation {
+	case "getCCMVersion":
+		writeEnvelope(w, http.StatusOK, fmt.Sprintf("<ns:getCCMVersionResponse xmlns:ns=\"http://www.cisco.com/AXL/API/%s\"><return><componentVersion><version>%s</version></componentVersion></return></ns:getCCMVersionResponse>", s.schema(body), s.options.Version))
+	case "executeSQLQuery":
+		s.executeSql(w, body)
+	default:
+		writeFault(w, fmt.Sprintf("Operation %s not supported by fake AXL", operation))
+	}
+}
+
+func (s *Server) schema(body string) string {
+	if m := schemaPattern.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func (s *Server) schemaSupported(body string) bool {
+	if len(s.options.Schemas) < 1 {
+		return true
+	}
+	schema := s.schema(body)
+	for _, v := range s.options.Schemas {
+		if v == schema {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) executeSql(w http.ResponseWriter, body string) {
+	m := sqlPattern.FindStringSubmatch(body)
+	if m == nil {
+		writeFault(w, "SQL statement not found in request")
+		return
+	}
+	var sql string
+	if err := xml.Unmarshal([]byte("<sql>"+m[1]+"</sql>"), &sql); err != nil {
+		writeFault(w, "SQL statement not valid XML")
+		return
+	}
+	rows, err := s.rows(sql)
+	if err != nil {
+		writeFault(w, err.Error())
+		return
+	}
+	if page := pagePattern.FindStringSubmatch(sql); page != nil {
+		skip, _ := strconv.Atoi(page[1])
+		limit, _ := strconv.Atoi(page[2])
+		rows = slice(rows, skip, limit)
+	}
+	if len(rows) >= s.options.FetchMax {
+		writeFault(w, fmt.Sprintf("Query request too large. Total rows matched: %d rows. Suggestive Row Fetch: less than %d rows", len(rows), s.options.FetchMax))
+		return
+	}
+	writeEnvelope(w, http.StatusOK, "<ns:executeSQLQueryResponse xmlns:ns=\"http://www.cisco.com/AXL/API/"+s.schema(body)+"\"><return>"+strings.Join(rows, "")+"</return></ns:executeSQLQueryResponse>")
+}
+
+// rows return fixture rows for SQL, SQL without fixture return no rows
+func (s *Server) rows(sql string) ([]string, error) {
+	lower := strings.ToLower(sql)
+	for _, q := range s.options.Queries {
+		if strings.Contains(lower, strings.ToLower(q.Match)) {
+			content, err := ioutil.ReadFile(filepath.Join(s.options.Fixtures, q.Fixture))
+			if err != nil {
+				return nil, err
+			}
+			return rowPattern.FindAllString(string(content), -1), nil
+		}
+	}
+	return nil, nil
+}
+
+func slice(rows []string, skip int, limit int) []string {
+	if skip >= len(rows) {
+		return nil
+	}
+	end := skip + limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[skip:end]
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, content string) {
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<?xml version='1.0' encoding='UTF-8'?><soapenv:Envelope xmlns:soapenv=\"http://schemas.xmlsoap.org/soap/envelope/\"><soapenv:Body>%s</soapenv:Body></soapenv:Envelope>", content)
+}
+
+func writeFault(w http.ResponseWriter, message string) {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(message))
+	writeEnvelope(w, http.StatusInternalServerError, fmt.Sprintf("<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>%s</faultstring><detail><axlError><axlcode>-1</axlcode><axlmessage>%s</axlmessage><request>executeSQLQuery</request></axlError></detail></soapenv:Fault>", escaped.String(), escaped.String()))
+}
@@ -23,7 +23,6 @@ copy /y "config.json" "./builds/config.json"
 copy /y "flush_sc_cache.txt" "./builds/"
 copy /y "jmxterm-1.0.1-uber.jar" "./builds/"
 copy /y "DBScripts\01_createschema.sql" "./builds/"
-copy /y "DBScripts\02_createtable.sql" "./builds/"
 copy /y "DBScripts\00_cleanup.sql" "./builds/"
 copy /y "install_zqm_axl_importer.sh" "./builds/"
 copy /y "remove_zqm_axl_importer.sh" "./builds/"
@@ -1,7 +1,8 @@
 #!/bin/bash
 # This installation script deploys the callrec-zqm-axl-importer tool
-# Version 2.1.0_01
-# Tested with allrec-zqm-axl-importer tool versions: 2.1.x
+# Version 2.2.0_01
+# Tested with allrec-zqm-axl-importer tool versions: 2.2.x
+# 2.2.0_01 Version update:      Database schema is upgraded by embedded migrations (migrate up), data are kept
 # 2.1.0_01 Version update:      Added Configuration option Support for Co-existance with UCCX importer 
 #                               Added Configuration option Support for setting Call direction 
 #                               Fixed: Tomcat parameters after re-install are missing ssl=false parameter
@@ -12,10 +13,10 @@
 # 2.0.1_01 Version update: 	Fixed: Editing of callrec-tomcat paramaters.
 #				Added versioning
 
-VERSION="2.1.0_01"
+VERSION="2.2.0_01"
 
 # Installation files
-SOURCE_FILES_SQL="00_cleanup.sql 01_createschema.sql 02_createtable.sql"
+SOURCE_FILES_SQL="00_cleanup.sql 01_createschema.sql"
 SOURCE_FILES_TOOL="config.json flush_sc_cache.txt jmxterm-1.0.1-uber.jar zqm-axl-importer remove_zqm_axl_importer.sh install_zqm_axl_importer.sh"
 SOURCE_FILE_SERVICE="callrec-zqm-axl-importer.service"
 
@@ -271,6 +272,8 @@ function copy_files() {
     echo "     INFO     Copying ${SRC_FILE}"
     yes | cp ${SOURCE_SQL_DIR}/${SRC_FILE} ${TARGET_SQL_DIR}
   done
+  # tables and functions are created by migrations embedded in tool
+  rm -f ${TARGET_SQL_DIR}/02_createtable.sql
 
   for SRC_FILE in $(echo "${SOURCE_FILES_TOOL}"); do
     echo "     INFO     Copying ${SRC_FILE}"
@@ -668,17 +671,22 @@ function cleanup_db() {
 
 function create_db() {
   echo
-  echo "     INFO     Creating new Database Tables."
-  echo "     -------------------------------------"
-  for sql_script in $(find ${TARGET_SQL_DIR} -name "*.sql" | grep -v "/00" | sort); do
-    echo
-    echo "         Running SQL script: ${sql_script}"
-    echo "         --------------------------------"
-    psql --quiet -U postgres -d callrec -h ${DB_HOST} <${sql_script}
-  done
+  echo "     INFO     Creating Database schema and user."
+  echo "     -----------------------------------------"
+  psql --quiet -U postgres -d callrec -h ${DB_HOST} <${TARGET_SQL_DIR}/01_createschema.sql
   psql --quiet -U postgres -d callrec -h ${DB_HOST} -c"ALTER USER axlUser PASSWORD '${AXL_PASS}';"
 }
 
+function migrate_db() {
+  echo
+  echo "     INFO     Upgrading Database Tables, existing data are kept."
+  echo "     ---------------------------------------------------------"
+  ${TARGET_DIR}/zqm-axl-importer --config=${TARGET_DIR}/${CONFIG_FILE} migrate up --db-user=postgres
+  if [ $? -ne 0 ]; then
+    echo "     ERROR    Database migration failed. Service will not start with old Database schema."
+  fi
+}
+
 function is_finished() {
   echo
   echo "-------------------------------"
@@ -811,8 +819,8 @@ new_values_for_config_temp
 update_config_temp
 stop_running_instance
 copy_files
-cleanup_db
 create_db
+migrate_db
 edit_web_service_for_reload
 restart_web_ui
 enable_service
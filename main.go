@@ -60,46 +60,41 @@ func ShortBody(body string) string {
 	return body
 }
 
-func processDeviceOnSql(deviceIdList []UserDeviceLine) int {
+func processDeviceOnSql(ctx context.Context, deviceIdList []UserDeviceLine, duplicates []DuplicateReportRow) int {
 	if len(deviceIdList) < 1 {
 		log.WithField("error", "list data for processing is empty").Error("not valid list of users read from AXl server")
 		return 1
 	}
-	conn, err := connectDb()
+	conn, err := connectDb(ctx)
 	if err != nil {
 		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
 		return 2
 	} else {
-		defer func() {
-		_:
-			conn.Close(context.Background())
-		}()
-		err = connectRunUserDeviceFunc(conn, deviceIdList)
+		defer conn.Release()
+		err = connectRunUserDeviceFunc(ctx, conn, deviceIdList, nil)
 		if err != nil {
 			log.WithField("error", err.Error()).Error("can't update AXL source DB table")
 			return 3
 		}
+		_ = connectSaveDuplicates(ctx, conn, duplicates)
 		log.WithField("rows", len(deviceIdList)).Infof("now update prepare %d rows", len(deviceIdList))
-		err = connectUpdateQm(conn)
+		err = connectUpdateQm(ctx, conn)
 	}
 	return 0
 }
 
-func processLoginUserOnSql(users []LoginUser) int {
+func processLoginUserOnSql(ctx context.Context, users []LoginUser) int {
 	if len(users) < 1 {
 		log.WithField("error", "list data for processing is empty").Error("not valid list of users read from AXl server")
 		return 1
 	}
-	conn, err := connectDb()
+	conn, err := connectDb(ctx)
 	if err != nil {
 		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
 		return 2
 	} else {
-		defer func() {
-		_:
-			conn.Close(context.Background())
-		}()
-		err = connectRunLoginUserFunc(conn, users)
+		defer conn.Release()
+		err = connectRunLoginUserFunc(ctx, conn, users, nil)
 		if err != nil {
 			log.WithField("error", err.Error()).Error("can't update AXL source DB table for login users")
 			return 3
@@ -109,6 +104,60 @@ func processLoginUserOnSql(users []LoginUser) int {
 	return 0
 }
 
+// processUserGroupsOnSql store role group membership, problem is only logged and roles stay unchanged
+func processUserGroupsOnSql(ctx context.Context, groups []UserGroup, clusters []string) int {
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
+		return 2
+	}
+	defer conn.Release()
+	if err = connectRunUserGroupFunc(ctx, conn, groups, clusters, nil); err != nil {
+		log.WithField("error", err.Error()).Error("can't update AXL group membership table")
+		return 3
+	}
+	return 0
+}
+
+// processEmSessions poll Extension Mobility logins from all clusters and store login history
+func processEmSessions(ctx context.Context) {
+	log.WithField("process", "EM logins").Trace("start poll Extension Mobility logins")
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.AxlTimeout)*time.Minute)
+	defer cancel()
+	sessions := &EmSessionList{Rows: []EmSession{}}
+	var clusters []string
+	allClusters, read := false, 0
+	axlClusters := config.AxlClusters()
+	for i := range axlClusters {
+		cluster := &axlClusters[i]
+		list := readEmSessions(ctx, cluster)
+		if list == nil {
+			continue
+		}
+		read++
+		sessions.Rows = append(sessions.Rows, list.Rows...)
+		if len(cluster.Name) > 0 {
+			clusters = append(clusters, cluster.Name)
+		} else {
+			// cluster without name is only configured cluster, name is from CUCM
+			allClusters = true
+		}
+	}
+	if read < 1 || ctx.Err() != nil {
+		return
+	}
+	if allClusters {
+		clusters = nil
+	}
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
+		return
+	}
+	defer conn.Release()
+	_ = connectRunEmSessionFunc(ctx, conn, sessions.Rows, clusters)
+}
+
 func IsTimeToAxlUpdate(now time.Time) bool {
 	current := now.Hour()
 	for _, hour := range config.Processing.UserImportHour {
@@ -119,37 +168,283 @@ func IsTimeToAxlUpdate(now time.Time) bool {
 	return false
 }
 
-func processAxlUpdate() {
+// AXL update modes
+const (
+	AxlUpdateFull          = iota // full import of all clusters
+	AxlUpdateChanges              // incremental sync, cluster without valid change cursor wait for full import
+	AxlUpdateChangesOrFull        // incremental sync, cluster without valid change cursor is imported fully (run once)
+)
+
+// readCursor is change cursor read before full import of cluster
+type readCursor struct {
+	cursor *ChangeCursor
+	login  bool // cluster has login user rows
+}
+
+// processAxlUpdate import data from all clusters. Incremental modes apply changes from change cursor,
+// cluster without valid cursor is skipped or imported fully by mode.
+func processAxlUpdate(ctx context.Context, mode int) {
 	log.WithField("process", "AXL Update").Trace("start process AXL update")
-	axlConnection := NewConnection(config.Axl.Server, config.Axl.User, config.Axl.Password)
-	accessible, _ := axlConnection.IsLoginValid()
-	if accessible {
-		db, err := axlConnection.DbVersion()
-		if err == nil && db != DbVersionError {
-			needClearCache := false
-			loginUser := axlConnection.GetLoginUserList()
-			if loginUser != nil && len(loginUser.Rows) > 0 {
-				log.WithFields(log.Fields{"validRows": len(loginUser.Rows)}).Infof("From source AXL table prepare %d valid login user rows", len(loginUser.Rows))
-				i := processLoginUserOnSql(loginUser.Rows)
-				needClearCache = i == 0
-			}
-			deviceIdList := axlConnection.GetUserDeviceLineList()
-			if deviceIdList != nil {
-				newList := deviceIdList.cleanDeviceLineList()
-				log.WithFields(log.Fields{"validRows": len(newList)}).Infof("From source AXL table prepare %d valid user/device/line rows", len(newList))
-				i := processDeviceOnSql(newList)
-				needClearCache = needClearCache || i == 0
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.AxlTimeout)*time.Minute)
+	defer cancel()
+	clusters := config.AxlClusters()
+	loadSchemaVersions(ctx, clusters)
+	defer saveSchemaVersions(ctx, clusters)
+	var fullClusters []*ConfigAxl
+	needClearCache := false
+	for i := range clusters {
+		if mode != AxlUpdateFull {
+			done, updated := processAxlChanges(ctx, &clusters[i])
+			needClearCache = needClearCache || updated
+			if done {
+				continue
 			}
-			if needClearCache {
-				refreshCache()
+			if mode == AxlUpdateChanges {
+				log.WithFields(log.Fields{"cluster": clusters[i].ClusterKey(), "hours": config.Processing.UserImportHour}).
+					Warning("incremental sync not possible, cluster is updated by full import in import hours")
+				continue
 			}
-		} else {
-			log.Errorf("problem with AXL connection or DB version not supported")
 		}
+		fullClusters = append(fullClusters, &clusters[i])
+	}
+	if len(fullClusters) < 1 {
+		if needClearCache && ctx.Err() == nil {
+			refreshCache()
+		}
+		log.WithField("process", "AXL Update").Trace("end process AXL update")
+		return
+	}
+	loginUser := &LoginUserList{Rows: []LoginUser{}}
+	deviceIdList := &UserDeviceLineList{Rows: []UserDeviceLine{}}
+	userGroups := &UserGroupList{Rows: []UserGroup{}}
+	var cursors []readCursor
+	var groupClusters []string
+	readLogin, readDevice := 0, 0
+	for _, cluster := range fullClusters {
+		login, device, groups, cursor := readAxlCluster(ctx, cluster)
+		if login != nil {
+			loginUser.Rows = append(loginUser.Rows, login.Rows...)
+			readLogin++
+		}
+		if device != nil {
+			deviceIdList.Rows = append(deviceIdList.Rows, device.Rows...)
+			readDevice++
+		}
+		if groups != nil && login != nil && device != nil {
+			// group membership is replaced only for completely read clusters
+			userGroups.Rows = append(userGroups.Rows, groups.Rows...)
+			groupClusters = append(groupClusters, clusterRowsName(cluster, login, device))
+		}
+		if cursor != nil && login != nil && device != nil && groups != nil {
+			cursor.ClusterName = clusterRowsName(cluster, login, device)
+			cursors = append(cursors, readCursor{cursor: cursor, login: len(login.Rows) > 0})
+		}
+	}
+	log.WithFields(log.Fields{"clusters": joinClusterNames(fullClusters), "loginClusters": readLogin, "deviceClusters": readDevice}).Debugf("read data from %d clusters", len(fullClusters))
+	loginDone, deviceDone := false, false
+	if len(loginUser.Rows) > 0 {
+		log.WithFields(log.Fields{"validRows": len(loginUser.Rows)}).Infof("From source AXL table prepare %d valid login user rows", len(loginUser.Rows))
+		i := processLoginUserOnSql(ctx, loginUser.Rows)
+		loginDone = i == 0
+		needClearCache = needClearCache || loginDone
+	}
+	if len(groupClusters) > 0 {
+		processUserGroupsOnSql(ctx, userGroups.Rows, groupClusters)
+	}
+	if readDevice > 0 {
+		deviceIdList.FilterRows(configRowFilter())
+		deviceIdList.ClassifyDevices(config.DeviceTypes)
+		newList, duplicates := deviceIdList.cleanDeviceLineList()
+		log.WithFields(log.Fields{"validRows": len(newList)}).Infof("From source AXL table prepare %d valid user/device/line rows", len(newList))
+		i := processDeviceOnSql(ctx, newList, duplicates.Report())
+		deviceDone = i == 0
+		needClearCache = needClearCache || deviceDone
+	}
+	// cursor is valid when all rows of its cluster are merged, cluster without login users has only device rows
+	var merged []*ChangeCursor
+	for _, c := range cursors {
+		if deviceDone && (loginDone || !c.login) {
+			merged = append(merged, c.cursor)
+		}
+	}
+	if len(merged) > 0 {
+		saveChangeCursors(ctx, merged)
+	}
+	if needClearCache && ctx.Err() == nil {
+		refreshCache()
 	}
 	log.WithField("process", "AXL Update").Trace("end process AXL update")
 }
 
+// clusterRowsName return cluster name stored in DB rows
+func clusterRowsName(cluster *ConfigAxl, login *LoginUserList, device *UserDeviceLineList) string {
+	if len(cluster.Name) > 0 {
+		return cluster.Name
+	}
+	if len(device.Rows) > 0 {
+		return device.Rows[0].ClusterName
+	}
+	if len(login.Rows) > 0 {
+		return login.Rows[0].ClusterName
+	}
+	return ""
+}
+
+// processAxlChanges apply changes from CUCM change queue. Return done false when full import is necessary
+// and updated true when DB data changed. Problem with AXL or DB is repeated in next sync.
+func processAxlChanges(ctx context.Context, cluster *ConfigAxl) (done bool, updated bool) {
+	if cluster.Api == ApiTyped {
+		log.WithField("cluster", cluster.ClusterKey()).Debug("incremental sync need executeSQLQuery, typed API cluster use full import")
+		return false, false
+	}
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
+		return true, false
+	}
+	defer conn.Release()
+	cursor, err := connectReadChangeCursor(ctx, conn, cluster.ClusterKey())
+	if err != nil || cursor == nil || len(cursor.ClusterName) < 1 {
+		log.WithField("cluster", cluster.ClusterKey()).Info("change cursor not exists")
+		return false, false
+	}
+	axlConnection, err := NewClusterConnection(ctx, cluster)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "error": err.Error()}).Errorf("problem prepare TLS configuration for AXL connection")
+		return true, false
+	}
+	defer axlConnection.storeClusterState()
+	accessible, _ := axlConnection.IsLoginValid()
+	if !accessible {
+		return true, false
+	}
+	db, err := axlConnection.DbVersion()
+	if err != nil || db == DbVersionError {
+		log.WithField("cluster", cluster.ClusterKey()).Errorf("problem with AXL connection or DB version not supported")
+		return true, false
+	}
+	pkid, next, err := axlConnection.ReadChanges(cursor)
+	if err == ErrChangeCursorExpired || err == ErrChangesOverLimit {
+		log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "error": err.Error()}).Warning("change cursor not usable")
+		return false, false
+	}
+	if err != nil {
+		return true, false
+	}
+	if len(pkid) < 1 {
+		log.WithField("cluster", cluster.ClusterKey()).Debug("no changes on AXL")
+		_ = connectSaveChangeCursor(ctx, conn, next)
+		return true, false
+	}
+	// shared device or line is resolved from all its rows, rows of other users are read and updated too
+	affected, err := connectReadChangedObjects(ctx, conn, cursor.ClusterName, pkid)
+	if err != nil {
+		return true, false
+	}
+	device, affected, err := axlConnection.GetAffectedUserDeviceLineList(affected)
+	if err == ErrChangesOverLimit {
+		log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "error": err.Error()}).Warning("changes not usable for incremental sync")
+		return false, false
+	}
+	if err != nil {
+		return true, false
+	}
+	login := axlConnection.GetChangedLoginUserList(pkid)
+	groups := axlConnection.GetChangedUserGroupList(config.Mapping.RoleGroups(), pkid)
+	if login == nil || groups == nil {
+		return true, false
+	}
+	device.FilterRows(configRowFilter())
+	device.ClassifyDevices(config.DeviceTypes)
+	scope := &ChangeScope{ClusterName: cursor.ClusterName, Pkid: affected}
+	log.WithFields(log.Fields{"cluster": cluster.ClusterKey(), "changes": len(pkid), "affected": len(affected), "loginRows": len(login.Rows), "deviceRows": len(device.Rows)}).Infof("incremental sync %d changed objects", len(pkid))
+	if err = connectRunLoginUserFunc(ctx, conn, login.Rows, scope); err != nil {
+		return true, false
+	}
+	// duplicate report is stored only by full import, changed rows are not complete report
+	rows, _ := device.cleanDeviceLineList()
+	if err = connectRunUserDeviceFunc(ctx, conn, rows, scope); err != nil {
+		return true, false
+	}
+	if err = connectRunUserGroupFunc(ctx, conn, groups.Rows, nil, scope); err != nil {
+		return true, false
+	}
+	if err = connectUpdateQm(ctx, conn); err != nil {
+		return true, false
+	}
+	_ = connectSaveChangeCursor(ctx, conn, next)
+	return true, true
+}
+
+// loadSchemaVersions read cached AXL schema versions for clusters without known version
+func loadSchemaVersions(ctx context.Context, clusters []ConfigAxl) {
+	var missing []*clusterState
+	var keys []string
+	for i := range clusters {
+		state := getClusterState(&clusters[i])
+		if len(clusters[i].SchemaVersion) < 1 && len(state.schemaVersion) < 1 {
+			missing = append(missing, state)
+			keys = append(keys, clusters[i].ClusterKey())
+		}
+	}
+	if len(missing) < 1 {
+		return
+	}
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Warningf("problem connect to DB, AXL schema version will be negotiated")
+		return
+	}
+	defer conn.Release()
+	for i, state := range missing {
+		version, err := connectReadSchemaVersion(ctx, conn, keys[i])
+		if err == nil && IsValidSchemaVersion(version) {
+			state.schemaVersion = version
+			state.storedVersion = version
+		}
+	}
+}
+
+// saveSchemaVersions store negotiated AXL schema versions changed in this update
+func saveSchemaVersions(ctx context.Context, clusters []ConfigAxl) {
+	var changed []ConfigAxl
+	for i := range clusters {
+		state := getClusterState(&clusters[i])
+		if len(state.schemaVersion) > 0 && state.schemaVersion != state.storedVersion {
+			changed = append(changed, clusters[i])
+		}
+	}
+	if len(changed) < 1 || ctx.Err() != nil {
+		return
+	}
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
+		return
+	}
+	defer conn.Release()
+	for i := range changed {
+		state := getClusterState(&changed[i])
+		if connectSaveSchemaVersion(ctx, conn, changed[i].ClusterKey(), state.schemaVersion, state.cucmVersion) == nil {
+			state.storedVersion = state.schemaVersion
+		}
+	}
+}
+
+func saveChangeCursors(ctx context.Context, cursors []*ChangeCursor) {
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem connect to DB. %s", err.Error())
+		return
+	}
+	defer conn.Release()
+	for _, cursor := range cursors {
+		if len(cursor.ClusterName) > 0 {
+			_ = connectSaveChangeCursor(ctx, conn, cursor)
+		}
+	}
+}
+
 func refreshCache() {
 	if !config.Zqm.IsCleanCache() {
 		log.WithField("process", "Clear cache").Trace("not clean cache configured")
@@ -168,25 +463,24 @@ func refreshCache() {
 	log.WithFields(log.Fields{"process": "Clear cache"}).Info("success clear cache")
 }
 
-func processCallsUpdate() int {
-	conn, err := connectDb()
+func processCallsUpdate(ctx context.Context) int {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.DbTimeout)*time.Minute)
+	defer cancel()
+	conn, err := connectDb(ctx)
 	if err != nil {
 		log.Errorf("problem connect to DB. %s", err.Error())
 		return 2
 	} else {
 		log.WithField("update at", time.Now().Format(TimeFormat)).Infof("now update call data")
-		defer func() {
-		_:
-			conn.Close(context.Background())
-		}()
+		defer conn.Release()
 		if config.Processing.MappingType == MappingBoth || config.Processing.MappingType == MappingDevice {
-			err = connectUpdateCalls(conn, processCallUpdateByDevice)
+			err = connectUpdateCalls(ctx, conn, processCallUpdateByDevice)
 			if err != nil {
 				return 1
 			}
 		}
 		if config.Processing.MappingType == MappingBoth || config.Processing.MappingType == MappingLine {
-			err = connectUpdateCalls(conn, processCallUpdateByLine)
+			err = connectUpdateCalls(ctx, conn, processCallUpdateByLine)
 			if err != nil {
 				return 2
 			}
@@ -195,58 +489,88 @@ func processCallsUpdate() int {
 	return 0
 }
 
-func scheduleCallsUpdate(done chan bool, wg *sync.WaitGroup) {
+func scheduleCallsUpdate(ctx context.Context, wg *sync.WaitGroup) {
 	tick := time.NewTicker(time.Minute * time.Duration(config.Processing.UpdateInterval))
 	defer wg.Done()
 	defer tick.Stop()
-	processCallsUpdate()
+	processCallsUpdate(ctx)
 	for {
 		select {
 		case <-tick.C:
 			log.Trace("process call updates")
-			processCallsUpdate()
-		case <-done:
+			processCallsUpdate(ctx)
+		case <-ctx.Done():
 			log.Debug("call update routine shutdown")
 			return
 		}
 	}
 }
 
-func scheduleAxlUpdate(done chan bool, wg *sync.WaitGroup) {
+func scheduleAxlUpdate(ctx context.Context, wg *sync.WaitGroup) {
 	tick := time.NewTicker(time.Hour)
 	defer wg.Done()
 	defer tick.Stop()
+	var changes <-chan time.Time
+	if config.Processing.Incremental {
+		changeTick := time.NewTicker(time.Minute * time.Duration(config.Processing.IncrementalPeriod))
+		defer changeTick.Stop()
+		changes = changeTick.C
+	}
+	// EM logins are polled in same routine, AXL cluster state is not shared between routines
+	var emLogins <-chan time.Time
+	if config.Processing.ExtensionMobility {
+		emTick := time.NewTicker(time.Minute * time.Duration(config.Processing.EmPeriod))
+		defer emTick.Stop()
+		emLogins = emTick.C
+		processEmSessions(ctx)
+	}
 	for {
 		select {
 		case <-tick.C:
 			log.Trace("tick for AXL update")
 			if IsTimeToAxlUpdate(time.Now()) {
 				log.Trace("update AXL")
-				processAxlUpdate()
+				processAxlUpdate(ctx, AxlUpdateFull)
 			}
-		case <-done:
+		case <-changes:
+			log.Trace("incremental AXL update")
+			processAxlUpdate(ctx, AxlUpdateChanges)
+		case <-emLogins:
+			log.Trace("poll Extension Mobility logins")
+			processEmSessions(ctx)
+		case <-ctx.Done():
 			log.Debug("AXL update routine shutdown")
 			return
 		}
 	}
 }
 
-func serviceLoop() {
-	doneUpdate := make(chan bool, 1)
-	doneAxl := make(chan bool, 1)
+// shutdownContext return root context cancelled by interrupt signal
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 	quit := make(chan os.Signal, 1)
-	var wg sync.WaitGroup
 	signal.Notify(quit, os.Interrupt)
+	go func() {
+		select {
+		case s := <-quit:
+			log.Infof("stop request signal is [%s]", s)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(quit)
+	}()
+	return ctx, cancel
+}
+
+func serviceLoop(ctx context.Context) {
+	var wg sync.WaitGroup
 
 	log.Infof("start scheduled routines")
-	go scheduleCallsUpdate(doneUpdate, &wg)
-	go scheduleAxlUpdate(doneAxl, &wg)
 	wg.Add(2)
+	go scheduleCallsUpdate(ctx, &wg)
+	go scheduleAxlUpdate(ctx, &wg)
 
-	s := <-quit
-	doneAxl <- true
-	doneUpdate <- true
-	log.Infof("stop request signal is [%s]", s)
+	<-ctx.Done()
 	wg.Wait()
 }
 
@@ -256,12 +580,21 @@ func main() {
 
 	kingpin.Version(VersionDetail())
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 	err := config.LoadFile(*configFile)
 	if err != nil && !*showConfig {
 		fmt.Printf("Problem read config file [%s]. Error: %s\r\n", *configFile, err)
 		os.Exit(1)
 	}
+	migrate := command == migrateUpCommand.FullCommand() || command == migrateStatusCommand.FullCommand()
+	if command == queryCommand.FullCommand() || command == duplicatesCommand.FullCommand() || migrate {
+		// stdout is reserved for query result
+		config.Log.Quiet = true
+	}
+	if migrate && len(*migrateDbUser) > 0 {
+		config.Zqm.DbUser = *migrateDbUser
+		config.Zqm.DbPassword = *migrateDbPassword
+	}
 	initLog()
 	if *showConfig {
 		fmt.Println(config.Print())
@@ -271,12 +604,48 @@ func main() {
 		}
 		os.Exit(0)
 	}
-	if *runOnce {
-		processAxlUpdate()
-		processCallsUpdate()
-	} else {
-		serviceLoop()
+	ctx, cancel := shutdownContext()
+	defer cancel()
+	switch {
+	case command == queryCommand.FullCommand():
+		if err := runAxlQuery(ctx, os.Stdout, *queryClusterId, *querySql, *queryFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Problem run AXL query. Error: %s\r\n", err)
+			exitCode = 1
+		}
+	case command == duplicatesCommand.FullCommand():
+		if err := runDuplicatesExport(ctx, os.Stdout, *duplicatesFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Problem export duplicate report. Error: %s\r\n", err)
+			exitCode = 1
+		}
+	case migrate:
+		action := MigrateStatus
+		if command == migrateUpCommand.FullCommand() {
+			action = MigrateUp
+		}
+		if err := runMigrate(ctx, os.Stdout, action); err != nil {
+			fmt.Fprintf(os.Stderr, "Problem migrate DB schema. Error: %s\r\n", err)
+			exitCode = 1
+		}
+	default:
+		if err := checkDbSchema(ctx); err != nil {
+			log.WithField("error", err.Error()).Error("DB schema or configuration is not compatible with program")
+			fmt.Fprintf(os.Stderr, "Problem check DB schema. Error: %s\r\n", err)
+			exitCode = 1
+		} else if *runOnce {
+			if config.Processing.Incremental {
+				processAxlUpdate(ctx, AxlUpdateChangesOrFull)
+			} else {
+				processAxlUpdate(ctx, AxlUpdateFull)
+			}
+			if config.Processing.ExtensionMobility {
+				processEmSessions(ctx)
+			}
+			processCallsUpdate(ctx)
+		} else {
+			serviceLoop(ctx)
+		}
 	}
+	closeDbPool()
 	timeEnd := time.Now()
 	log.WithFields(log.Fields{"duration": timeEnd.Sub(timeStart).String()}).Infof("Program end at %s", time.Now().Format(TimeFormat))
 	time.Sleep(time.Second)
@@ -16,14 +16,36 @@ import (
 )
 
 const (
-	DbServer            = "localhost"
-	DefaultRoleName     = "Agent"
-	MappingDevice       = "device"
-	MappingLine         = "line"
-	MappingBoth         = "both"
-	DefaultMapping      = MappingBoth
-	DefaultSetDirection = true
-	DefaultCcxImporter  = false
+	DbServer             = "localhost"
+	DefaultRoleName      = "Agent"
+	MappingDevice        = "device"
+	MappingLine          = "line"
+	MappingBoth          = "both"
+	DefaultMapping       = MappingBoth
+	DefaultSetDirection  = true
+	DefaultCcxImporter   = false
+	ApiSql               = "sql"
+	ApiTyped             = "typed"
+	ApiAuto              = "auto"
+	DefaultApi           = ApiAuto
+	maxTeamName          = 50 // wbsc.ccgroups.ccgroupname length
+	SharedDrop           = "drop"
+	SharedOwner          = "owner"
+	SharedPrimary        = "primary"
+	SharedManual         = "manual"
+	DeviceTypeDesk       = "desk"
+	DeviceTypeJabber     = "jabber"
+	DeviceTypeCtiPort    = "ctiport"
+	DeviceTypeRoutePoint = "routepoint"
+	DeviceTypeGateway    = "gateway"
+	DeviceTypeProfile    = "profile"
+	DeviceTypeOther      = "other"
+	DbName               = "callrec"
+	DbSchema             = "axl_data"
+	DbSslDisable         = "disable"
+	DbSslRequire         = "require"
+	DbSslVerifyCa        = "verify-ca"
+	DbSslVerifyFull      = "verify-full"
 )
 
 type Intervals struct {
@@ -33,28 +55,70 @@ type Intervals struct {
 }
 
 type Config struct {
-	Axl        ConfigAxl        `json:"axl" yaml:"axl"`               // AXl server
-	Zqm        ConfigZqm        `json:"zqm" yaml:"zqm"`               // ZQM connection
-	Log        ConfigLog        `json:"log" yaml:"log"`               // Log configuration
-	Processing ConfigProcessing `json:"processing" yaml:"processing"` // processing
+	Axl         ConfigAxl         `json:"axl" yaml:"axl"`                 // AXl server
+	Zqm         ConfigZqm         `json:"zqm" yaml:"zqm"`                 // ZQM connection
+	Log         ConfigLog         `json:"log" yaml:"log"`                 // Log configuration
+	Processing  ConfigProcessing  `json:"processing" yaml:"processing"`   // processing
+	Clusters    []ConfigAxl       `json:"clusters" yaml:"clusters"`       // AXL clusters, when defined replace axl section
+	Filter      ConfigFilter      `json:"filter" yaml:"filter"`           // Include/exclude rules for imported user/device/line rows
+	Mapping     ConfigMapping     `json:"mapping" yaml:"mapping"`         // Mapping CUCM user data to QM teams and roles
+	Shared      ConfigShared      `json:"shared" yaml:"shared"`           // Resolution of devices and lines associated to more users
+	DeviceTypes ConfigDeviceTypes `json:"deviceTypes" yaml:"deviceTypes"` // Device type rules, type without rule is used for couple mapping
 }
 
 type ConfigAxl struct {
-	Server            string `json:"server" yaml:"server"`                       // FQDN or IP address of AXL server
-	User              string `json:"user" yaml:"user"`                           // AXL user
-	Password          string `json:"password" yaml:"password"`                   // AXL user password
-	AccessGroup       string `json:"accessGroup" yaml:"accessGroup"`             // Name of Access Control Group valid for allow login user to QM
-	IgnoreCertificate bool   `json:"ignoreCertificate" yaml:"ignoreCertificate"` // Ignore AXL certificate
+	Name              string              `json:"name" yaml:"name"`                           // Cluster name used in user identity. Default is CUCM ClusterID
+	Server            string              `json:"server" yaml:"server"`                       // FQDN or IP address of AXL server
+	Nodes             []ConfigAxlNode     `json:"nodes" yaml:"nodes"`                         // Publisher and subscriber nodes in failover order
+	User              string              `json:"user" yaml:"user"`                           // AXL user
+	Password          string              `json:"password" yaml:"password"`                   // AXL user password
+	AccessGroup       string              `json:"accessGroup" yaml:"accessGroup"`             // Name of Access Control Group valid for allow login user to QM
+	AccessGroups      []ConfigAccessGroup `json:"accessGroups" yaml:"accessGroups"`           // Access Control Groups valid for login to QM, first matched group is used for user
+	JtapiUser         []string            `json:"jtapiUser" yaml:"jtapiUser"`                 // JTAPI users for this cluster. Default are ZQM JTAPI users
+	IgnoreCertificate bool                `json:"ignoreCertificate" yaml:"ignoreCertificate"` // Ignore AXL certificate
+	CaFile            string              `json:"caFile" yaml:"caFile"`                       // PEM bundle with CA certificates for verify AXL server
+	CertificatePin    string              `json:"certificatePin" yaml:"certificatePin"`       // SHA-256 fingerprint of CUCM Tomcat certificate
+	ClientCert        string              `json:"clientCert" yaml:"clientCert"`               // PEM client certificate for AXL connection
+	ClientKey         string              `json:"clientKey" yaml:"clientKey"`                 // PEM private key for client certificate
+	Retry             ConfigAxlRetry      `json:"retry" yaml:"retry"`                         // Retry policy for AXL requests
+	Api               string              `json:"api" yaml:"api"`                             // AXL API for read data sql, typed or auto. Default auto
+	SchemaVersion     string              `json:"schemaVersion" yaml:"schemaVersion"`         // Exact AXL schema version (12.5), disable negotiation
+}
+
+type ConfigAccessGroup struct {
+	Name  string `json:"name" yaml:"name"`   // Access Control Group name, * and ? are wildcards (case insensitive)
+	Regex bool   `json:"regex" yaml:"regex"` // Name is regular expression
+	Team  string `json:"team" yaml:"team"`   // Default QM team for users of group. Default is processing default team
+	Role  string `json:"role" yaml:"role"`   // Default QM role for users of group. Default is processing default role
+}
+
+type ConfigAxlRetry struct {
+	MaxAttempts  int `json:"maxAttempts" yaml:"maxAttempts"`   // Maximal attempts for one AXL request. Default 5
+	InitialDelay int `json:"initialDelay" yaml:"initialDelay"` // Delay before first retry in seconds. Default 2
+	MaxDelay     int `json:"maxDelay" yaml:"maxDelay"`         // Maximal delay between retries in seconds. Default 60
+	RateLimit    int `json:"rateLimit" yaml:"rateLimit"`       // Maximal AXL requests per minute, 0 disable limit. Default 120
+}
+
+type ConfigAxlNode struct {
+	Server string `json:"server" yaml:"server"` // FQDN or IP address of CUCM node
+	Port   int    `json:"port" yaml:"port"`     // AXL HTTPS port. Default is 8443
 }
 
 type ConfigZqm struct {
-	JtapiUser  []string `json:"jtapiUser" yaml:"jtapiUser"`   // ZQM JTAPI user name
-	DbServer   string   `json:"dbServer" yaml:"dbServer"`     // Database FQDN or IP. Default is localhost
-	DbPort     int      `json:"dbPort" yaml:"dbPort"`         // Database TCP port. Default is 5432
-	DbUser     string   `json:"dbUser" yaml:"dbUser"`         // Database user
-	DbPassword string   `json:"dbPassword" yaml:"dbPassword"` // Database password
-	JavaXTerm  string   `json:"javaXTerm" yaml:"javaXTerm"`   // Full path to JAVA-Xterm jar
-	JavaFlush  string   `json:"javaFlush" yaml:"javaFlush"`   // Full path command line for terminal
+	JtapiUser          []string `json:"jtapiUser" yaml:"jtapiUser"`                   // ZQM JTAPI user name
+	DbServer           string   `json:"dbServer" yaml:"dbServer"`                     // Database FQDN or IP. Default is localhost
+	DbPort             int      `json:"dbPort" yaml:"dbPort"`                         // Database TCP port. Default is 5432
+	DbName             string   `json:"dbName" yaml:"dbName"`                         // Database name. Default is callrec
+	DbSchema           string   `json:"dbSchema" yaml:"dbSchema"`                     // Schema with importer tables and functions. Default is axl_data
+	DbUser             string   `json:"dbUser" yaml:"dbUser"`                         // Database user
+	DbPassword         string   `json:"dbPassword" yaml:"dbPassword"`                 // Database password
+	DbSslMode          string   `json:"dbSslMode" yaml:"dbSslMode"`                   // TLS mode disable, require, verify-ca or verify-full. Default is disable
+	DbCaFile           string   `json:"dbCaFile" yaml:"dbCaFile"`                     // PEM bundle with CA certificates for verify DB server, required for verify-ca and verify-full
+	DbConnectTimeout   int      `json:"dbConnectTimeout" yaml:"dbConnectTimeout"`     // Timeout for open DB connection in seconds. Default is 10
+	DbStatementTimeout int      `json:"dbStatementTimeout" yaml:"dbStatementTimeout"` // Maximal duration of one DB statement in seconds, 0 disable
+	DbMaxConns         int      `json:"dbMaxConns" yaml:"dbMaxConns"`                 // Maximal number of pooled DB connections. Default is 4
+	JavaXTerm          string   `json:"javaXTerm" yaml:"javaXTerm"`                   // Full path to JAVA-Xterm jar
+	JavaFlush          string   `json:"javaFlush" yaml:"javaFlush"`                   // Full path command line for terminal
 }
 
 type ConfigLog struct {
@@ -77,6 +141,62 @@ type ConfigProcessing struct {
 	MappingType        string `json:"mappingType" yaml:"mappingType"`               // Use update couples based on lines, device names or both
 	SetDirection       bool   `json:"setDirection" yaml:"setDirection"`             // Update direction in CR when update agents
 	CoexistCcxImporter bool   `json:"coexistCcxImporter" yaml:"coexistCcxImporter"` // Is on same system enabled standard SC CCX Importer
+	AxlTimeout         int    `json:"axlTimeout" yaml:"axlTimeout"`                 // Maximal duration of AXL import in minutes. Default 60
+	DbTimeout          int    `json:"dbTimeout" yaml:"dbTimeout"`                   // Maximal duration of couple update in minutes. Default 10
+	Incremental        bool   `json:"incremental" yaml:"incremental"`               // Enable incremental sync by AXL change notification (CUCM 12.5+)
+	IncrementalPeriod  int    `json:"incrementalPeriod" yaml:"incrementalPeriod"`   // Delay between incremental sync in minutes. Default 15
+	IncrementalMax     int    `json:"incrementalMax" yaml:"incrementalMax"`         // Maximal changed users, devices and lines in incremental sync, more wait for full import. Default 500
+	ExtensionMobility  bool   `json:"extensionMobility" yaml:"extensionMobility"`   // Import device profiles and attribute calls to Extension Mobility user
+	EmPeriod           int    `json:"emPeriod" yaml:"emPeriod"`                     // Delay between Extension Mobility login polls in minutes. Default 2
+}
+
+type ConfigFilter struct {
+	UserId       ConfigFilterRule `json:"userId" yaml:"userId"`             // Regular expressions for CUCM user ID
+	Department   ConfigFilterRule `json:"department" yaml:"department"`     // Department names, case insensitive
+	DevicePrefix ConfigFilterRule `json:"devicePrefix" yaml:"devicePrefix"` // Device name prefixes, case insensitive
+	DeviceModel  ConfigFilterRule `json:"deviceModel" yaml:"deviceModel"`   // Device model names (Cisco 8845), case insensitive
+	Partition    ConfigFilterRule `json:"partition" yaml:"partition"`       // Line route partition names, case insensitive
+}
+
+type ConfigFilterRule struct {
+	Include []string `json:"include" yaml:"include"` // Row must match one of values, empty include all rows
+	Exclude []string `json:"exclude" yaml:"exclude"` // Row matching one of values is not imported
+}
+
+type ConfigMapping struct {
+	Teams    []ConfigTeamMapping `json:"teams" yaml:"teams"`       // Department to QM team mapping, first match is used. Fallback is default team
+	MoveTeam bool                `json:"moveTeam" yaml:"moveTeam"` // Move user to mapped team when department changed on CUCM
+	Roles    []ConfigRoleMapping `json:"roles" yaml:"roles"`       // Access control group to QM role mapping, first group has highest priority. Fallback is default role
+}
+
+type ConfigTeamMapping struct {
+	Department string `json:"department" yaml:"department"` // Department name (case insensitive) or regular expression
+	Regex      bool   `json:"regex" yaml:"regex"`           // Department is PostgreSQL regular expression (POSIX ARE, case insensitive), checked in DB on start
+	Team       string `json:"team" yaml:"team"`             // QM team name, missing team is created
+}
+
+type ConfigRoleMapping struct {
+	Group string `json:"group" yaml:"group"` // CUCM access control group (dirgroup) name, case insensitive
+	Role  string `json:"role" yaml:"role"`   // QM role name, role must exist in QM
+}
+
+type ConfigShared struct {
+	Policy  []string             `json:"policy" yaml:"policy"`   // Policies tried in order (manual, owner, primary). Not resolved device or line is dropped
+	Winners []ConfigSharedWinner `json:"winners" yaml:"winners"` // Manual winners for shared devices and lines
+}
+
+type ConfigSharedWinner struct {
+	Device    string `json:"device" yaml:"device"`       // Shared device name (case insensitive)
+	Line      string `json:"line" yaml:"line"`           // Shared line DN
+	Partition string `json:"partition" yaml:"partition"` // Route partition of line, empty match every partition
+	UserId    string `json:"userId" yaml:"userId"`       // User ID of winner
+}
+
+type ConfigDeviceTypes []ConfigDeviceType
+
+type ConfigDeviceType struct {
+	Type    string `json:"type" yaml:"type"`       // Device type desk, jabber, ctiport, routepoint, gateway, profile or other
+	Mapping bool   `json:"mapping" yaml:"mapping"` // Devices of type are used for couple mapping and duplicate check
 }
 
 type ConfigValid interface {
@@ -85,35 +205,78 @@ type ConfigValid interface {
 }
 
 var (
-	showConfig     = kingpin.Flag("show", "Show actual configuration and ends").Default("false").Bool()
-	configFile     = kingpin.Flag("config", "Configuration file default is \"server.yml\".").PlaceHolder("cfg.yml").Default("server.yml").String()
-	runOnce        = kingpin.Flag("cli", "Run only once and ends").Default("false").Bool()
-	config         = NewConfig()
-	LogMaxSize     = Intervals{Default: 50, Min: 1, Max: 5000}        // Limits and defaults for Log MaxSize
-	LogMaxBackups  = Intervals{Default: 5, Min: 0, Max: 100}          // Limits and defaults for Log MaxBackups
-	LogMaxAge      = Intervals{Default: 30, Min: 1, Max: 365}         // Limits and defaults for Log MaxAge
-	DbPort         = Intervals{Default: 5432, Min: 1025, Max: 65535}  // Limits and defaults for Db port
-	UpdateInterval = Intervals{Default: 5, Min: 1, Max: 30 * 24 * 60} // Limits and defaults for Update Agent interval
-	HoursBack      = Intervals{Default: 48, Min: 1, Max: 30 * 24}     // Limits and defaults for Update call attach data
-	UserImportHour = Intervals{Default: 4, Min: 0, Max: 23}           // Limits for Processing AXL update
+	showConfig           = kingpin.Flag("show", "Show actual configuration and ends").Default("false").Bool()
+	configFile           = kingpin.Flag("config", "Configuration file default is \"server.yml\".").PlaceHolder("cfg.yml").Default("server.yml").String()
+	runOnce              = kingpin.Flag("cli", "Run only once and ends").Default("false").Bool()
+	runCommand           = kingpin.Command("run", "Run import service, default command").Default()
+	queryCommand         = kingpin.Command("query", "Run AXL SQL query and print returned rows")
+	querySql             = queryCommand.Arg("sql", "SQL select, add ORDER BY for large result").Required().String()
+	queryFormat          = queryCommand.Flag("format", "Output format table, csv or json").Short('f').Default(QueryFormatTable).Enum(QueryFormatTable, QueryFormatCsv, QueryFormatJson)
+	queryClusterId       = queryCommand.Flag("cluster", "Cluster name, default is first configured cluster").Default("").String()
+	duplicatesCommand    = kingpin.Command("duplicates", "Export latest duplicate association report from DB")
+	duplicatesFormat     = duplicatesCommand.Flag("format", "Output format csv or json").Short('f').Default(QueryFormatCsv).Enum(QueryFormatCsv, QueryFormatJson)
+	migrateCommand       = kingpin.Command("migrate", "Apply or show embedded DB schema migrations")
+	migrateUpCommand     = migrateCommand.Command(MigrateUp, "Apply pending migrations and show status")
+	migrateStatusCommand = migrateCommand.Command(MigrateStatus, "Show applied and pending migrations")
+	migrateDbUser        = migrateCommand.Flag("db-user", "DB user owner of schema objects, default is zqm.dbUser").Default("").String()
+	migrateDbPassword    = migrateCommand.Flag("db-password", "Password of db-user, empty use PGPASSWORD or .pgpass").Default("").String()
+	config               = NewConfig()
+	LogMaxSize           = Intervals{Default: 50, Min: 1, Max: 5000}        // Limits and defaults for Log MaxSize
+	LogMaxBackups        = Intervals{Default: 5, Min: 0, Max: 100}          // Limits and defaults for Log MaxBackups
+	LogMaxAge            = Intervals{Default: 30, Min: 1, Max: 365}         // Limits and defaults for Log MaxAge
+	DbPort               = Intervals{Default: 5432, Min: 1025, Max: 65535}  // Limits and defaults for Db port
+	DbConnectTimeout     = Intervals{Default: 10, Min: 1, Max: 300}         // Limits and defaults for DB connect timeout in seconds
+	DbStatement          = Intervals{Default: 0, Min: 0, Max: 24 * 60 * 60} // Limits and defaults for DB statement timeout in seconds
+	DbMaxConns           = Intervals{Default: 4, Min: 1, Max: 50}           // Limits and defaults for DB pool size
+	AxlPort              = Intervals{Default: 8443, Min: 1, Max: 65535}     // Limits and defaults for AXL port
+	RetryAttempts        = Intervals{Default: 5, Min: 1, Max: 20}           // Limits and defaults for AXL request attempts
+	RetryInitial         = Intervals{Default: 2, Min: 1, Max: 300}          // Limits and defaults for first AXL retry delay
+	RetryMaxDelay        = Intervals{Default: 60, Min: 1, Max: 3600}        // Limits and defaults for maximal AXL retry delay
+	AxlRateLimit         = Intervals{Default: 120, Min: 0, Max: 6000}       // Limits and defaults for AXL requests per minute
+	UpdateInterval       = Intervals{Default: 5, Min: 1, Max: 30 * 24 * 60} // Limits and defaults for Update Agent interval
+	HoursBack            = Intervals{Default: 48, Min: 1, Max: 30 * 24}     // Limits and defaults for Update call attach data
+	UserImportHour       = Intervals{Default: 4, Min: 0, Max: 23}           // Limits for Processing AXL update
+	AxlTimeout           = Intervals{Default: 60, Min: 1, Max: 24 * 60}     // Limits and defaults for AXL import duration
+	DbTimeout            = Intervals{Default: 10, Min: 1, Max: 24 * 60}     // Limits and defaults for couple update duration
+	ChangePeriod         = Intervals{Default: 15, Min: 1, Max: 24 * 60}     // Limits and defaults for incremental sync period
+	ChangeMaxObjects     = Intervals{Default: 500, Min: 1, Max: 10000}      // Limits and defaults for objects in incremental sync
+	EmPollPeriod         = Intervals{Default: 2, Min: 1, Max: 60}           // Limits and defaults for Extension Mobility login poll period
 )
 
 func NewConfig() *Config {
 	return &Config{
 		Axl: ConfigAxl{Server: "",
+			Nodes:             []ConfigAxlNode{},
 			User:              "",
 			Password:          "",
 			AccessGroup:       "",
+			JtapiUser:         []string{},
 			IgnoreCertificate: false,
+			CaFile:            "",
+			CertificatePin:    "",
+			ClientCert:        "",
+			ClientKey:         "",
+			Retry: ConfigAxlRetry{
+				MaxAttempts:  RetryAttempts.Default,
+				InitialDelay: RetryInitial.Default,
+				MaxDelay:     RetryMaxDelay.Default,
+				RateLimit:    AxlRateLimit.Default,
+			},
+			Api: DefaultApi,
 		},
 		Zqm: ConfigZqm{
-			JtapiUser:  []string{},
-			DbServer:   DbServer,
-			DbPort:     DbPort.Default,
-			DbUser:     "",
-			DbPassword: "",
-			JavaXTerm:  "",
-			JavaFlush:  "",
+			JtapiUser:        []string{},
+			DbServer:         DbServer,
+			DbPort:           DbPort.Default,
+			DbName:           DbName,
+			DbSchema:         DbSchema,
+			DbUser:           "",
+			DbPassword:       "",
+			DbSslMode:        DbSslDisable,
+			DbConnectTimeout: DbConnectTimeout.Default,
+			DbMaxConns:       DbMaxConns.Default,
+			JavaXTerm:        "",
+			JavaFlush:        "",
 		},
 		Log: ConfigLog{
 			Level:          "INFO",
@@ -134,6 +297,13 @@ func NewConfig() *Config {
 			MappingType:        DefaultMapping,
 			SetDirection:       DefaultSetDirection,
 			CoexistCcxImporter: DefaultCcxImporter,
+			AxlTimeout:         AxlTimeout.Default,
+			DbTimeout:          DbTimeout.Default,
+			Incremental:        false,
+			IncrementalPeriod:  ChangePeriod.Default,
+			IncrementalMax:     ChangeMaxObjects.Default,
+			ExtensionMobility:  false,
+			EmPeriod:           EmPollPeriod.Default,
 		},
 	}
 }
@@ -161,14 +331,41 @@ func (c *Config) ProcessLoadFile(content []byte) (err error) {
 }
 
 func (c *Config) Validate() (err error) {
-	err = c.Axl.Validate()
-	if err != nil {
-		return err
+	if len(c.Clusters) == 0 {
+		err = c.Axl.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	names := map[string]bool{}
+	for i := range c.Clusters {
+		if c.Clusters[i].Retry == (ConfigAxlRetry{}) {
+			c.Clusters[i].Retry = c.Axl.Retry
+		}
+		if len(c.Clusters[i].Api) < 1 {
+			c.Clusters[i].Api = c.Axl.Api
+		}
+		err = c.Clusters[i].Validate()
+		if err != nil {
+			return errors.New(fmt.Sprintf("cluster on position %d: %s", i, err))
+		}
+		if len(c.Clusters) > 1 && len(c.Clusters[i].Name) < 1 {
+			return errors.New(fmt.Sprintf("cluster on position %d has not defined name", i))
+		}
+		if names[c.Clusters[i].Name] {
+			return errors.New(fmt.Sprintf("cluster name %s is not unique", c.Clusters[i].Name))
+		}
+		names[c.Clusters[i].Name] = true
 	}
 	err = c.Zqm.Validate()
 	if err != nil {
 		return err
 	}
+	for _, cluster := range c.AxlClusters() {
+		if len(cluster.JtapiUser) < 1 && len(c.Zqm.JtapiUser) < 1 {
+			return errors.New("ZQM JTAPI user not defined")
+		}
+	}
 	err = c.Log.Validate()
 	if err != nil {
 		return err
@@ -177,34 +374,170 @@ func (c *Config) Validate() (err error) {
 	if err != nil {
 		return err
 	}
+	err = c.Filter.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.Mapping.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.Shared.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.DeviceTypes.Validate()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (a *ConfigAxl) Validate() (err error) {
-	if len(a.Server) < 1 {
+	if len(a.Server) < 1 && len(a.Nodes) < 1 {
 		return errors.New("AXL server not defined")
 	}
-	if !validServer(a.Server) {
+	if len(a.Server) > 0 && !validServer(a.Server) {
 		return errors.New("AXL server not valid FQDN or IP")
 	}
+	for i := range a.Nodes {
+		if !validServer(a.Nodes[i].Server) {
+			return errors.New(fmt.Sprintf("AXL node on position %d not valid FQDN or IP", i))
+		}
+		if a.Nodes[i].Port == 0 {
+			a.Nodes[i].Port = AxlPort.Default
+		}
+		if !AxlPort.Validate(a.Nodes[i].Port) {
+			return errors.New(fmt.Sprintf("AXL node %s port is out of range (%d-%d)", a.Nodes[i].Server, AxlPort.Min, AxlPort.Max))
+		}
+	}
 	if len(a.User) < 1 {
 		return errors.New("AXL user not defined")
 	}
 	if len(a.Password) < 1 {
 		return errors.New("AXL password not defined")
 	}
-	if len(a.AccessGroup) < 1 {
+	if len(a.AccessGroupList()) < 1 {
 		return errors.New("AXL AccessControl Group not defined")
 	}
+	for i, g := range a.AccessGroups {
+		if len(g.Name) < 1 {
+			return errors.New(fmt.Sprintf("AXL AccessControl Group on position %d must define name", i))
+		}
+		if len(g.Team) > maxTeamName {
+			return errors.New(fmt.Sprintf("team name %s is longer than %d characters", g.Team, maxTeamName))
+		}
+		if _, err := g.Pattern(); err != nil {
+			return errors.New(fmt.Sprintf("AXL AccessControl Group %s is not valid regular expression: %s", g.Name, err))
+		}
+	}
+	for _, user := range a.JtapiUser {
+		if len(user) < 1 {
+			return errors.New("AXL JTAPI username is empty")
+		}
+	}
+	if len(a.CaFile) > 0 && !FileExists(a.CaFile) {
+		return errors.New(fmt.Sprintf("AXL CA file %s not found", a.CaFile))
+	}
+	if len(a.CertificatePin) > 0 {
+		if !IsValidCertificatePin(a.CertificatePin) {
+			return errors.New("AXL certificate pin is not valid SHA-256 fingerprint")
+		}
+		a.CertificatePin = NormalizeCertificatePin(a.CertificatePin)
+	}
+	a.Retry.Validate()
+	if len(a.SchemaVersion) > 0 && !IsValidSchemaVersion(a.SchemaVersion) {
+		return errors.New(fmt.Sprintf("AXL schema version %s not valid, use format major.minor (12.5)", a.SchemaVersion))
+	}
+	a.Api = strings.ToLower(a.Api)
+	if len(a.Api) < 1 {
+		a.Api = DefaultApi
+	}
+	if !(a.Api == ApiSql || a.Api == ApiTyped || a.Api == ApiAuto) {
+		return errors.New(fmt.Sprintf("AXL API %s not supported (%s, %s, %s)", a.Api, ApiSql, ApiTyped, ApiAuto))
+	}
+	if a.Api == ApiTyped && len(a.Name) < 1 {
+		return errors.New("AXL cluster with typed API must define name, CUCM ClusterID is available only by executeSQLQuery")
+	}
+	if (len(a.ClientCert) > 0) != (len(a.ClientKey) > 0) {
+		return errors.New("AXL client certificate and client key must be defined together")
+	}
+	if len(a.ClientCert) > 0 && !FileExists(a.ClientCert) {
+		return errors.New(fmt.Sprintf("AXL client certificate file %s not found", a.ClientCert))
+	}
+	if len(a.ClientKey) > 0 && !FileExists(a.ClientKey) {
+		return errors.New(fmt.Sprintf("AXL client key file %s not found", a.ClientKey))
+	}
 
 	return nil
 }
 
-func (a *ConfigZqm) Validate() (err error) {
-	if len(a.JtapiUser) < 1 {
-		return errors.New("ZQM JTAPI user not defined")
+func (a *ConfigAxlRetry) Validate() {
+	a.MaxAttempts = RetryAttempts.ValidOrDefault(a.MaxAttempts)
+	a.InitialDelay = RetryInitial.ValidOrDefault(a.InitialDelay)
+	a.MaxDelay = RetryMaxDelay.ValidOrDefault(a.MaxDelay)
+	if a.MaxDelay < a.InitialDelay {
+		a.MaxDelay = a.InitialDelay
+	}
+	a.RateLimit = AxlRateLimit.ValidOrDefault(a.RateLimit)
+}
+
+// AxlClusters return list of AXL clusters for import
+func (c *Config) AxlClusters() []ConfigAxl {
+	if len(c.Clusters) > 0 {
+		return c.Clusters
+	}
+	return []ConfigAxl{c.Axl}
+}
+
+// NodeList return AXL nodes in failover order, server is always first node
+func (a *ConfigAxl) NodeList() []ConfigAxlNode {
+	var nodes []ConfigAxlNode
+	if len(a.Server) > 0 {
+		nodes = append(nodes, ConfigAxlNode{Server: a.Server, Port: AxlPort.Default})
+	}
+	for _, node := range a.Nodes {
+		if node.Port == 0 {
+			node.Port = AxlPort.Default
+		}
+		if len(a.Server) > 0 && node.Server == a.Server && node.Port == AxlPort.Default {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// AccessGroupList return access control groups in priority order, accessGroup is always first group
+func (a *ConfigAxl) AccessGroupList() []ConfigAccessGroup {
+	var groups []ConfigAccessGroup
+	if len(a.AccessGroup) > 0 {
+		groups = append(groups, ConfigAccessGroup{Name: a.AccessGroup})
+	}
+	return append(groups, a.AccessGroups...)
+}
+
+// IsPattern identify group matched by wildcard or regular expression, other group is exact name
+func (g *ConfigAccessGroup) IsPattern() bool {
+	return g.Regex || strings.ContainsAny(g.Name, "*?")
+}
+
+// Pattern return regular expression for group name, wildcard is converted to case insensitive expression
+func (g *ConfigAccessGroup) Pattern() (*regexp.Regexp, error) {
+	if g.Regex {
+		return regexp.Compile(g.Name)
 	}
+	expr := regexp.QuoteMeta(g.Name)
+	expr = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(expr)
+	return regexp.Compile("(?i)^" + expr + "$")
+}
+
+func (n *ConfigAxlNode) String() string {
+	return fmt.Sprintf("%s:%d", n.Server, n.Port)
+}
+
+func (a *ConfigZqm) Validate() (err error) {
 	for _, user := range a.JtapiUser {
 		if len(user) < 1 {
 			return errors.New("ZQM JTAPI username is empty")
@@ -224,6 +557,37 @@ func (a *ConfigZqm) Validate() (err error) {
 	if !DbPort.Validate(a.DbPort) {
 		return errors.New(fmt.Sprintf("ZQM DB port is out of range (%d-%d)", DbPort.Min, DbPort.Max))
 	}
+	if len(a.DbName) < 1 {
+		a.DbName = DbName
+	}
+	if len(a.DbSchema) < 1 {
+		a.DbSchema = DbSchema
+	}
+	a.DbSchema = strings.ToLower(a.DbSchema)
+	if !dbIdentifier.MatchString(a.DbSchema) {
+		return errors.New(fmt.Sprintf("ZQM DB schema [%s] is not valid name", a.DbSchema))
+	}
+	if len(a.DbSslMode) < 1 {
+		a.DbSslMode = DbSslDisable
+	}
+	a.DbSslMode = strings.ToLower(a.DbSslMode)
+	switch a.DbSslMode {
+	case DbSslDisable, DbSslRequire:
+	case DbSslVerifyCa, DbSslVerifyFull:
+		if len(a.DbCaFile) < 1 {
+			return errors.New(fmt.Sprintf("ZQM DB sslmode %s require CA file", a.DbSslMode))
+		}
+	default:
+		return errors.New(fmt.Sprintf("ZQM DB sslmode %s not supported (%s, %s, %s, %s)", a.DbSslMode, DbSslDisable, DbSslRequire, DbSslVerifyCa, DbSslVerifyFull))
+	}
+	if len(a.DbCaFile) > 0 && !FileExists(a.DbCaFile) {
+		return errors.New(fmt.Sprintf("ZQM DB CA file %s not found", a.DbCaFile))
+	}
+	a.DbConnectTimeout = DbConnectTimeout.ValidOrDefault(a.DbConnectTimeout)
+	if !DbStatement.Validate(a.DbStatementTimeout) {
+		return errors.New(fmt.Sprintf("ZQM DB statement timeout is out of range (%d-%d)", DbStatement.Min, DbStatement.Max))
+	}
+	a.DbMaxConns = DbMaxConns.ValidOrDefault(a.DbMaxConns)
 	if len(a.JavaXTerm) > 0 && !FileExists(a.JavaXTerm) {
 		return errors.New(fmt.Sprintf("JAVA-XTERM jar file %s not found", a.JavaXTerm))
 	}
@@ -288,6 +652,11 @@ func (a *ConfigProcessing) Validate() (err error) {
 	if !UpdateInterval.Validate(a.UpdateInterval) {
 		return errors.New(fmt.Sprintf("update interval not between %d and  %d", UpdateInterval.Max, UpdateInterval.Max))
 	}
+	a.AxlTimeout = AxlTimeout.ValidOrDefault(a.AxlTimeout)
+	a.DbTimeout = DbTimeout.ValidOrDefault(a.DbTimeout)
+	a.IncrementalPeriod = ChangePeriod.ValidOrDefault(a.IncrementalPeriod)
+	a.IncrementalMax = ChangeMaxObjects.ValidOrDefault(a.IncrementalMax)
+	a.EmPeriod = EmPollPeriod.ValidOrDefault(a.EmPeriod)
 	if len(a.MappingType) > 0 {
 		a.MappingType = strings.ToLower(a.MappingType)
 		if !(a.MappingType == MappingBoth || a.MappingType == MappingDevice || a.MappingType == MappingLine) {
@@ -300,6 +669,120 @@ func (a *ConfigProcessing) Validate() (err error) {
 	return nil
 }
 
+func (a *ConfigFilter) Validate() (err error) {
+	for _, expr := range append(append([]string{}, a.UserId.Include...), a.UserId.Exclude...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			return errors.New(fmt.Sprintf("user ID filter %s is not valid regular expression: %s", expr, err))
+		}
+	}
+	return nil
+}
+
+func (a *ConfigMapping) Validate() (err error) {
+	for i, m := range a.Teams {
+		if len(m.Department) < 1 || len(m.Team) < 1 {
+			return errors.New(fmt.Sprintf("team mapping on position %d must define department and team", i))
+		}
+		if len(m.Team) > maxTeamName {
+			return errors.New(fmt.Sprintf("team name %s is longer than %d characters", m.Team, maxTeamName))
+		}
+	}
+	groups := map[string]bool{}
+	for i, m := range a.Roles {
+		if len(m.Group) < 1 || len(m.Role) < 1 {
+			return errors.New(fmt.Sprintf("role mapping on position %d must define group and role", i))
+		}
+		if groups[strings.ToLower(m.Group)] {
+			return errors.New(fmt.Sprintf("role mapping group %s is defined more than once", m.Group))
+		}
+		groups[strings.ToLower(m.Group)] = true
+	}
+	return nil
+}
+
+// RoleGroups return access control groups used in role mapping
+func (a *ConfigMapping) RoleGroups() []string {
+	var groups []string
+	for _, m := range a.Roles {
+		groups = append(groups, m.Group)
+	}
+	return groups
+}
+
+func (a *ConfigShared) Validate() (err error) {
+	for i, p := range a.Policy {
+		a.Policy[i] = strings.ToLower(p)
+		if !(a.Policy[i] == SharedDrop || a.Policy[i] == SharedOwner || a.Policy[i] == SharedPrimary || a.Policy[i] == SharedManual) {
+			return errors.New(fmt.Sprintf("shared policy %s not supported (%s, %s, %s, %s)", p, SharedManual, SharedOwner, SharedPrimary, SharedDrop))
+		}
+	}
+	for i, w := range a.Winners {
+		if len(w.UserId) < 1 || (len(w.Device) < 1 && len(w.Line) < 1) {
+			return errors.New(fmt.Sprintf("shared winner on position %d must define userId and device or line", i))
+		}
+	}
+	return nil
+}
+
+// DeviceTypeList return all supported device types
+func DeviceTypeList() []string {
+	return []string{DeviceTypeDesk, DeviceTypeJabber, DeviceTypeCtiPort, DeviceTypeRoutePoint, DeviceTypeGateway, DeviceTypeProfile, DeviceTypeOther}
+}
+
+func (a ConfigDeviceTypes) Validate() (err error) {
+	known := map[string]bool{}
+	for i := range a {
+		a[i].Type = strings.ToLower(a[i].Type)
+		supported := false
+		for _, t := range DeviceTypeList() {
+			supported = supported || a[i].Type == t
+		}
+		if !supported {
+			return errors.New(fmt.Sprintf("device type %s not supported (%s)", a[i].Type, strings.Join(DeviceTypeList(), ", ")))
+		}
+		if known[a[i].Type] {
+			return errors.New(fmt.Sprintf("device type %s defined more than once", a[i].Type))
+		}
+		known[a[i].Type] = true
+	}
+	return nil
+}
+
+// UseForMapping identify device type used for couple mapping, type without rule is used
+func (a ConfigDeviceTypes) UseForMapping(deviceType string) bool {
+	for _, t := range a {
+		if t.Type == deviceType {
+			return t.Mapping
+		}
+	}
+	return true
+}
+
+// IsEmpty identify filter without rules
+func (a *ConfigFilter) IsEmpty() bool {
+	for _, r := range a.rules() {
+		if len(r.rule.Include) > 0 || len(r.rule.Exclude) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type namedFilterRule struct {
+	name string
+	rule ConfigFilterRule
+}
+
+func (a *ConfigFilter) rules() []namedFilterRule {
+	return []namedFilterRule{
+		{"userId", a.UserId},
+		{"department", a.Department},
+		{"devicePrefix", a.DevicePrefix},
+		{"deviceModel", a.DeviceModel},
+		{"partition", a.Partition},
+	}
+}
+
 func (a *ConfigLog) LogToFile() bool {
 	return len(a.FileName) > 0
 }
@@ -322,9 +805,15 @@ func (c *Config) Print() string {
 	a = fmt.Sprintf("%s\t- Architecture            %s\r\n", a, runtime.GOARCH)
 	a = fmt.Sprintf("%s\t- Config file             %s\r\n", a, *configFile)
 	a = fmt.Sprintf("%s\t- Run once                %t\r\n", a, *runOnce)
-	a = fmt.Sprintf("%s%s", a, c.Axl.Print())
+	for _, cluster := range c.AxlClusters() {
+		a = fmt.Sprintf("%s%s", a, cluster.Print())
+	}
 	a = fmt.Sprintf("%s%s", a, c.Zqm.Print())
 	a = fmt.Sprintf("%s%s", a, c.Processing.Print())
+	a = fmt.Sprintf("%s%s", a, c.Filter.Print())
+	a = fmt.Sprintf("%s%s", a, c.Mapping.Print())
+	a = fmt.Sprintf("%s%s", a, c.Shared.Print())
+	a = fmt.Sprintf("%s%s", a, c.DeviceTypes.Print())
 	a = fmt.Sprintf("%s%s", a, c.Log.Print())
 
 	return a
@@ -338,22 +827,142 @@ func (a *ConfigProcessing) Print() string {
 	o = fmt.Sprintf("%s\t- Couple mapping by       %s\r\n", o, a.MappingType)
 	o = fmt.Sprintf("%s\t- Update call direction   %t\r\n", o, a.SetDirection)
 	o = fmt.Sprintf("%s\t- Coexist CCX Importer    %t\r\n", o, a.CoexistCcxImporter)
+	o = fmt.Sprintf("%s\t- AXL import timeout      %d min\r\n", o, a.AxlTimeout)
+	o = fmt.Sprintf("%s\t- Couple update timeout   %d min\r\n", o, a.DbTimeout)
+	if a.Incremental {
+		o = fmt.Sprintf("%s\t- Incremental sync every  %d min\r\n", o, a.IncrementalPeriod)
+		o = fmt.Sprintf("%s\t- Incremental max objects %d\r\n", o, a.IncrementalMax)
+	}
+	if a.ExtensionMobility {
+		o = fmt.Sprintf("%s\t- EM logins poll every    %d min\r\n", o, a.EmPeriod)
+	}
+	return o
+}
+
+func (a *ConfigFilter) Print() string {
+	if a.IsEmpty() {
+		return ""
+	}
+	o := fmt.Sprintf("Filter\r\n")
+	for _, r := range a.rules() {
+		if len(r.rule.Include) > 0 {
+			o = fmt.Sprintf("%s\t- %-23s [%s]\r\n", o, r.name+" include", strings.Join(r.rule.Include, ", "))
+		}
+		if len(r.rule.Exclude) > 0 {
+			o = fmt.Sprintf("%s\t- %-23s [%s]\r\n", o, r.name+" exclude", strings.Join(r.rule.Exclude, ", "))
+		}
+	}
+	return o
+}
+
+func (a *ConfigMapping) Print() string {
+	if len(a.Teams) < 1 && len(a.Roles) < 1 {
+		return ""
+	}
+	o := fmt.Sprintf("Mapping\r\n")
+	for _, m := range a.Teams {
+		kind := "department"
+		if m.Regex {
+			kind = "regex"
+		}
+		o = fmt.Sprintf("%s\t- Team %-18s %s [%s]\r\n", o, m.Team, kind, m.Department)
+	}
+	if len(a.Teams) > 0 {
+		o = fmt.Sprintf("%s\t- Move team on change     %t\r\n", o, a.MoveTeam)
+	}
+	for i, m := range a.Roles {
+		o = fmt.Sprintf("%s\t- Role %-18s group [%s] priority %d\r\n", o, m.Role, m.Group, i+1)
+	}
+	return o
+}
+
+func (a *ConfigShared) Print() string {
+	policy := SharedDrop
+	if len(a.Policy) > 0 {
+		policy = strings.Join(a.Policy, ", ")
+	}
+	o := fmt.Sprintf("Shared devices and lines\r\n")
+	o = fmt.Sprintf("%s\t- Policy                  [%s]\r\n", o, policy)
+	for _, w := range a.Winners {
+		target := "device " + w.Device
+		if len(w.Line) > 0 {
+			target = "line " + w.Line
+			if len(w.Partition) > 0 {
+				target = target + " in " + w.Partition
+			}
+		}
+		o = fmt.Sprintf("%s\t- Winner %-16s %s\r\n", o, w.UserId, target)
+	}
+	return o
+}
+
+func (a ConfigDeviceTypes) Print() string {
+	if len(a) < 1 {
+		return ""
+	}
+	o := fmt.Sprintf("Device types\r\n")
+	for _, t := range DeviceTypeList() {
+		o = fmt.Sprintf("%s\t- Mapping %-16s %t\r\n", o, t, a.UseForMapping(t))
+	}
 	return o
 }
 
 func (a *ConfigAxl) Print() string {
 	o := fmt.Sprintf("AXL\r\n")
-	o = fmt.Sprintf("%s\t- Server                  %s\r\n", o, a.Server)
+	if len(a.Name) > 0 {
+		o = fmt.Sprintf("%s\t- Cluster name            %s\r\n", o, a.Name)
+	}
+	var nodes []string
+	for _, node := range a.NodeList() {
+		nodes = append(nodes, node.String())
+	}
+	o = fmt.Sprintf("%s\t- Server nodes            [%s]\r\n", o, strings.Join(nodes, ", "))
 	o = fmt.Sprintf("%s\t- User                    %s\r\n", o, a.User)
-	o = fmt.Sprintf("%s\t- Access Control Group    %s\r\n", o, a.AccessGroup)
+	for _, g := range a.AccessGroupList() {
+		o = fmt.Sprintf("%s\t- Access Control Group    %s%s\r\n", o, g.Name, g.details())
+	}
+	if len(a.JtapiUser) > 0 {
+		o = fmt.Sprintf("%s\t- JTAPI User              [%s]\r\n", o, strings.Join(a.JtapiUser, ", "))
+	}
+	o = fmt.Sprintf("%s\t- AXL API                 %s\r\n", o, a.Api)
+	if len(a.SchemaVersion) > 0 {
+		o = fmt.Sprintf("%s\t- AXL schema version      %s\r\n", o, a.SchemaVersion)
+	}
+	o = fmt.Sprintf("%s\t- TLS mode                %s\r\n", o, a.TlsMode())
+	o = fmt.Sprintf("%s\t- Request attempts        %d (delay %ds - %ds)\r\n", o, a.Retry.MaxAttempts, a.Retry.InitialDelay, a.Retry.MaxDelay)
+	o = fmt.Sprintf("%s\t- Requests per minute     %d\r\n", o, a.Retry.RateLimit)
 	return o
 }
 
+func (g *ConfigAccessGroup) details() string {
+	var d []string
+	if g.Regex {
+		d = append(d, "regex")
+	}
+	if len(g.Team) > 0 {
+		d = append(d, "team "+g.Team)
+	}
+	if len(g.Role) > 0 {
+		d = append(d, "role "+g.Role)
+	}
+	if len(d) < 1 {
+		return ""
+	}
+	return " (" + strings.Join(d, ", ") + ")"
+}
+
 func (a *ConfigZqm) Print() string {
 	o := fmt.Sprintf("ZQM\r\n")
 	o = fmt.Sprintf("%s\t- JTAPI User              [%s]\r\n", o, strings.Join(a.JtapiUser, ", "))
 	o = fmt.Sprintf("%s\t- DB Server               %s:%d\r\n", o, a.DbServer, a.DbPort)
+	o = fmt.Sprintf("%s\t- DB Name                 %s\r\n", o, a.DbName)
+	o = fmt.Sprintf("%s\t- DB Schema               %s\r\n", o, a.DbSchema)
 	o = fmt.Sprintf("%s\t- DB User                 %s\r\n", o, a.DbUser)
+	o = fmt.Sprintf("%s\t- DB SSL mode             %s\r\n", o, a.DbSslMode)
+	o = fmt.Sprintf("%s\t- DB CA file              %s\r\n", o, a.DbCaFile)
+	o = fmt.Sprintf("%s\t- DB connect timeout      %ds\r\n", o, a.DbConnectTimeout)
+	o = fmt.Sprintf("%s\t- DB statement timeout    %ds\r\n", o, a.DbStatementTimeout)
+	o = fmt.Sprintf("%s\t- DB pool size            %d\r\n", o, a.DbMaxConns)
 	o = fmt.Sprintf("%s\t- JAVAX-Xterm             %s\r\n", o, a.JavaXTerm)
 	o = fmt.Sprintf("%s\t- Java Flush command      %s\r\n", o, a.JavaFlush)
 	return o
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
@@ -36,6 +37,56 @@ func TestConfig_ProcessLoadFile(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidateClusters(t *testing.T) {
+	t.Parallel()
+	cluster := func(name string, jtapi ...string) ConfigAxl {
+		return ConfigAxl{Name: name, Server: "cucm" + strings.ToLower(name), User: "user", Password: "pwd", AccessGroup: "access", JtapiUser: jtapi}
+	}
+	tables := []struct {
+		clusters []ConfigAxl
+		jtapi    []string
+		err      string
+		name     string
+	}{
+		{[]ConfigAxl{cluster("A"), cluster("B")}, []string{"callrec"}, "", "two clusters"},
+		{[]ConfigAxl{cluster("A", "jtapiA"), cluster("B", "jtapiB")}, []string{}, "", "own JTAPI users"},
+		{[]ConfigAxl{cluster("A", "jtapiA"), cluster("B")}, []string{}, "JTAPI", "missing JTAPI user"},
+		{[]ConfigAxl{cluster("A"), cluster("")}, []string{"callrec"}, "name", "missing name"},
+		{[]ConfigAxl{cluster("A"), cluster("A")}, []string{"callrec"}, "unique", "duplicate name"},
+		{[]ConfigAxl{cluster("")}, []string{"callrec"}, "", "one cluster without name"},
+	}
+	filter := NewConfig()
+	filter.Axl = cluster("A")
+	filter.Zqm = ConfigZqm{JtapiUser: []string{"callrec"}, DbServer: "localhost", DbUser: "user", DbPassword: "pwd", DbPort: DbPort.Default}
+	filter.Filter.UserId.Exclude = []string{"[test"}
+	if err := filter.Validate(); err == nil || !strings.Contains(err.Error(), "regular expression") {
+		t.Errorf("invalid user ID filter accepted. Error: %v", err)
+	}
+	for _, table := range tables {
+		cfg := NewConfig()
+		cfg.Clusters = table.clusters
+		cfg.Zqm = ConfigZqm{JtapiUser: table.jtapi, DbServer: "localhost", DbUser: "user", DbPassword: "pwd", DbPort: DbPort.Default}
+		err := cfg.Validate()
+		if len(table.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("not expected response for [%s]. Error: %v", table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("not expected error for [%s]. Error: %s", table.name, err)
+		}
+		if len(cfg.AxlClusters()) != len(table.clusters) {
+			t.Errorf("not expected number of clusters for [%s]", table.name)
+		}
+		for _, c := range cfg.AxlClusters() {
+			if c.Retry.MaxAttempts != RetryAttempts.Default {
+				t.Errorf("cluster retry policy not inherited for [%s]", table.name)
+			}
+		}
+	}
+}
+
 func TestConfigAxl_Validate(t *testing.T) {
 	t.Parallel()
 
@@ -55,6 +106,28 @@ func TestConfigAxl_Validate(t *testing.T) {
 			false, "password", "Empty password"},
 		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", IgnoreCertificate: true, AccessGroup: "access"},
 			false, "password", "All ok"},
+		{ConfigAxl{Nodes: []ConfigAxlNode{{Server: "_invalid"}}, User: "user", Password: "pwd", AccessGroup: "access"},
+			false, "AXL node", "Invalid node"},
+		{ConfigAxl{Nodes: []ConfigAxlNode{{Server: "sub", Port: AxlPort.Max + 1}}, User: "user", Password: "pwd", AccessGroup: "access"},
+			false, "port", "Invalid node port"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", CertificatePin: "aa:bb"},
+			false, "certificate pin", "Invalid pin"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", CaFile: "/not/exists/ca.pem"},
+			false, "CA file", "Missing CA file"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", ClientCert: "/not/exists/cert.pem"},
+			false, "client key", "Client certificate without key"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", Api: "soap"},
+			false, "AXL API", "Unknown API"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", SchemaVersion: "12"},
+			false, "schema version", "Invalid schema version"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", Api: ApiTyped},
+			false, "must define name", "Typed API without name"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroups: []ConfigAccessGroup{{Name: "QM *", Team: "Sites"}}},
+			true, "", "Only access group list"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroup: "access", AccessGroups: []ConfigAccessGroup{{Team: "Sites"}}},
+			false, "must define name", "Access group without name"},
+		{ConfigAxl{Server: "localhost", User: "user", Password: "pwd", AccessGroups: []ConfigAccessGroup{{Name: "(QM", Regex: true}}},
+			false, "regular expression", "Invalid access group regex"},
 	}
 
 	for _, table := range tables {
@@ -68,6 +141,59 @@ func TestConfigAxl_Validate(t *testing.T) {
 	}
 }
 
+func TestConfigAxl_AccessGroupList(t *testing.T) {
+	t.Parallel()
+	c := ConfigAxl{AccessGroup: "QM Access", AccessGroups: []ConfigAccessGroup{{Name: "QM Site *", Team: "Sites"}, {Name: "^qm-(b|c)$", Regex: true, Role: "Agent"}}}
+	groups := c.AccessGroupList()
+	if len(groups) != 3 || groups[0].Name != "QM Access" || groups[0].IsPattern() || !groups[1].IsPattern() {
+		t.Fatalf("not expected access group list %v", groups)
+	}
+	tables := []struct {
+		group int
+		name  string
+		match bool
+	}{
+		{1, "QM Site B", true},
+		{1, "qm site b", true},
+		{1, "QM Sites", false},
+		{2, "qm-b", true},
+		{2, "QM-B", false},
+	}
+	for _, table := range tables {
+		r, err := groups[table.group].Pattern()
+		if err != nil {
+			t.Errorf("pattern not created for [%s] - %s", groups[table.group].Name, err)
+			continue
+		}
+		if r.MatchString(table.name) != table.match {
+			t.Errorf("not expected match [%s / %s]", groups[table.group].Name, table.name)
+		}
+	}
+}
+
+func TestConfigAxl_NodeList(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t    ConfigAxl
+		e    []string
+		name string
+	}{
+		{ConfigAxl{Server: "pub"}, []string{"pub:8443"}, "only server"},
+		{ConfigAxl{Server: "pub", Nodes: []ConfigAxlNode{{Server: "sub", Port: 9443}}}, []string{"pub:8443", "sub:9443"}, "server and node"},
+		{ConfigAxl{Server: "pub", Nodes: []ConfigAxlNode{{Server: "pub"}, {Server: "sub"}}}, []string{"pub:8443", "sub:8443"}, "server repeated in nodes"},
+		{ConfigAxl{Nodes: []ConfigAxlNode{{Server: "sub1"}, {Server: "sub2", Port: 443}}}, []string{"sub1:8443", "sub2:443"}, "only nodes"},
+	}
+	for _, table := range tables {
+		var nodes []string
+		for _, node := range table.t.NodeList() {
+			nodes = append(nodes, node.String())
+		}
+		if strings.Join(nodes, ",") != strings.Join(table.e, ",") {
+			t.Errorf("not expected node list for [%s] - [%s / %s]", table.name, strings.Join(nodes, ","), strings.Join(table.e, ","))
+		}
+	}
+}
+
 func TestConfigZqm_Validate(t *testing.T) {
 	t.Parallel()
 	tables := []struct {
@@ -98,6 +224,50 @@ func TestConfigZqm_Validate(t *testing.T) {
 	}
 }
 
+func TestConfigZqm_ValidateDb(t *testing.T) {
+	t.Parallel()
+	valid := func(c ConfigZqm) ConfigZqm {
+		c.JtapiUser = []string{"aa"}
+		c.DbServer = "zqm"
+		c.DbUser = "aa"
+		c.DbPassword = "aa"
+		c.DbPort = DbPort.Default
+		return c
+	}
+	tables := []struct {
+		t           ConfigZqm
+		e           ConfigZqm
+		errContains string
+		name        string
+	}{
+		{valid(ConfigZqm{}), ConfigZqm{DbName: DbName, DbSchema: DbSchema, DbSslMode: DbSslDisable, DbConnectTimeout: DbConnectTimeout.Default, DbMaxConns: DbMaxConns.Default}, "", "defaults"},
+		{valid(ConfigZqm{DbName: "qm", DbSchema: "AXL_Import", DbSslMode: "REQUIRE", DbConnectTimeout: 30, DbStatementTimeout: 600, DbMaxConns: 8}),
+			ConfigZqm{DbName: "qm", DbSchema: "axl_import", DbSslMode: DbSslRequire, DbConnectTimeout: 30, DbStatementTimeout: 600, DbMaxConns: 8}, "", "custom values"},
+		{valid(ConfigZqm{DbSchema: "axl-data"}), ConfigZqm{}, "DB schema", "invalid schema"},
+		{valid(ConfigZqm{DbSslMode: "prefer"}), ConfigZqm{}, "not supported", "not supported sslmode"},
+		{valid(ConfigZqm{DbSslMode: DbSslVerifyFull}), ConfigZqm{}, "require CA file", "verify without CA"},
+		{valid(ConfigZqm{DbSslMode: DbSslVerifyCa, DbCaFile: "not-exists.pem"}), ConfigZqm{}, "not found", "missing CA file"},
+		{valid(ConfigZqm{DbStatementTimeout: -1}), ConfigZqm{}, "statement timeout", "negative statement timeout"},
+	}
+	for _, table := range tables {
+		err := table.t.Validate()
+		if len(table.errContains) > 0 {
+			if err == nil || !strings.Contains(err.Error(), table.errContains) {
+				t.Errorf("ZQM DB config expect error [%s] for [%s], got %v", table.errContains, table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ZQM DB config not expect error for [%s] - %s", table.name, err)
+			continue
+		}
+		if table.t.DbName != table.e.DbName || table.t.DbSchema != table.e.DbSchema || table.t.DbSslMode != table.e.DbSslMode ||
+			table.t.DbConnectTimeout != table.e.DbConnectTimeout || table.t.DbStatementTimeout != table.e.DbStatementTimeout || table.t.DbMaxConns != table.e.DbMaxConns {
+			t.Errorf("ZQM DB config not expect for [%s] - %+v", table.name, table.t)
+		}
+	}
+}
+
 func TestConfigLog_Validate(t *testing.T) {
 	t.Parallel()
 	tables := []struct {
@@ -485,3 +655,101 @@ const JsonSuccessFile = string(`{
     "coexistCcxImporter ": true
   }
 }`)
+
+func TestConfigMapping_Validate(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t    ConfigMapping
+		err  string
+		name string
+	}{
+		{ConfigMapping{}, "", "empty mapping"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Department: "Sales", Team: "Sales team"}, {Department: "^support", Regex: true, Team: "Support"}}}, "", "valid mapping"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Department: "Sales"}}}, "department and team", "missing team"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Team: "Sales"}}}, "department and team", "missing department"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Department: "Sales", Team: strings.Repeat("x", maxTeamName+1)}}}, "longer", "long team name"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Department: `^sales(?=.*eu)`, Regex: true, Team: "Sales"}}}, "", "PostgreSQL regex not valid in Go"},
+		{ConfigMapping{Teams: []ConfigTeamMapping{{Department: "(sales", Team: "Sales"}}}, "", "exact department not regex"},
+		{ConfigMapping{Roles: []ConfigRoleMapping{{Group: "QM Supervisors", Role: "Supervisor"}, {Group: "QM Evaluators", Role: "Evaluator"}}}, "", "valid role mapping"},
+		{ConfigMapping{Roles: []ConfigRoleMapping{{Group: "QM Supervisors"}}}, "group and role", "missing role"},
+		{ConfigMapping{Roles: []ConfigRoleMapping{{Group: "QM Supervisors", Role: "Supervisor"}, {Group: "qm supervisors", Role: "Agent"}}}, "more than once", "duplicate group"},
+	}
+	for _, table := range tables {
+		err := table.t.Validate()
+		if len(table.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("not expected response for [%s]. Error: %v", table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("not expected error for [%s]. Error: %s", table.name, err)
+		}
+	}
+	b, _ := json.Marshal([]ConfigTeamMapping{{Department: "Sales", Regex: true, Team: "QM Sales"}})
+	if string(b) != `[{"department":"Sales","regex":true,"team":"QM Sales"}]` {
+		t.Errorf("team mapping JSON not expected by axl_update_qm %s", string(b))
+	}
+	b, _ = json.Marshal([]ConfigRoleMapping{{Group: "QM Supervisors", Role: "Supervisor"}})
+	if string(b) != `[{"group":"QM Supervisors","role":"Supervisor"}]` {
+		t.Errorf("role mapping JSON not expected by axl_update_qm %s", string(b))
+	}
+}
+
+func TestConfigShared_Validate(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t    ConfigShared
+		err  string
+		name string
+	}{
+		{ConfigShared{}, "", "empty policy"},
+		{ConfigShared{Policy: []string{"Manual", "owner", "primary", "drop"}}, "", "all policies"},
+		{ConfigShared{Policy: []string{"first"}}, "not supported", "unknown policy"},
+		{ConfigShared{Winners: []ConfigSharedWinner{{Device: "SEP001", UserId: "agent01"}, {Line: "2101", Partition: "Internal_PT", UserId: "agent02"}}}, "", "valid winners"},
+		{ConfigShared{Winners: []ConfigSharedWinner{{Device: "SEP001"}}}, "userId", "winner without user"},
+		{ConfigShared{Winners: []ConfigSharedWinner{{UserId: "agent01"}}}, "device or line", "winner without target"},
+	}
+	for _, table := range tables {
+		err := table.t.Validate()
+		if len(table.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("not expected response for [%s]. Error: %v", table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("not expected error for [%s]. Error: %s", table.name, err)
+		}
+	}
+}
+
+func TestConfigDeviceTypes_Validate(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t    ConfigDeviceTypes
+		err  string
+		name string
+	}{
+		{ConfigDeviceTypes{}, "", "no rules"},
+		{ConfigDeviceTypes{{Type: "CTIPort"}, {Type: "gateway"}, {Type: "jabber", Mapping: true}}, "", "valid rules"},
+		{ConfigDeviceTypes{{Type: "softphone"}}, "not supported", "unknown type"},
+		{ConfigDeviceTypes{{Type: "desk"}, {Type: "Desk", Mapping: true}}, "more than once", "duplicate type"},
+	}
+	for _, table := range tables {
+		err := table.t.Validate()
+		if len(table.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("not expected response for [%s]. Error: %v", table.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("not expected error for [%s]. Error: %s", table.name, err)
+		}
+	}
+	rules := ConfigDeviceTypes{{Type: DeviceTypeCtiPort}}
+	if rules.UseForMapping(DeviceTypeCtiPort) || !rules.UseForMapping(DeviceTypeDesk) {
+		t.Errorf("not expected device type mapping")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Temp tables are created in transaction of one pooled connection and dropped on commit,
+// merge functions read them as pg_temp.axl_users_tmp and pg_temp.axl_login_users_tmp
+const (
+	tempTableUserDevice = "axl_users_tmp"
+	tempTableLoginUser  = "axl_login_users_tmp"
+)
+
+var userDeviceColumns = []string{
+	"user_pkid varchar", "device_pkid varchar", "line_pkid varchar", "first_name varchar", "middle_name varchar",
+	"last_name varchar", "user_id varchar", "department varchar", "status int", "is_local_user bool", "has_uccx bool",
+	"directory_uri varchar", "mail_id varchar", "device_name varchar", "device_description varchar",
+	"line_number varchar", "line_alerting_name varchar", "line_description varchar", "line_partition varchar",
+	"device_model varchar", "model_enum int", "device_class varchar", "class_enum int", "device_type varchar",
+	"device_mapping bool", "cluster_name varchar",
+}
+
+var loginUserColumns = []string{
+	"user_pkid varchar", "first_name varchar", "middle_name varchar", "last_name varchar", "user_id varchar",
+	"department varchar", "status int", "is_local_user bool", "has_uccx bool", "directory_uri varchar",
+	"mail_id varchar", "cluster_name varchar", "access_group varchar", "default_team varchar", "default_role varchar",
+}
+
+// copyValues return row values in order of userDeviceColumns
+func (u *UserDeviceLine) copyValues() []interface{} {
+	return []interface{}{
+		u.UserPKID, u.DevicePKID, u.LinePKID, u.FirstName, u.MiddleName,
+		u.LastName, u.UserId, u.Department, u.Status, u.IsLocalUser, u.Uccx,
+		u.DirectoryUri, u.MailId, u.DeviceName, u.DeviceDescription,
+		u.LineNumber, u.LineAlertingName, u.LineDescription, u.Partition,
+		u.DeviceModel, u.ModelEnum, u.DeviceClass, u.ClassEnum, u.DeviceTypeName,
+		!u.ExcludeMapping, u.ClusterName,
+	}
+}
+
+// copyValues return row values in order of loginUserColumns
+func (u *LoginUser) copyValues() []interface{} {
+	return []interface{}{
+		u.UserPKID, u.FirstName, u.MiddleName, u.LastName, u.UserId,
+		u.Department, u.Status, u.IsLocalUser, u.Uccx, u.DirectoryUri,
+		u.MailId, u.ClusterName, u.AccessGroup, u.DefaultTeam, u.DefaultRole,
+	}
+}
+
+// copyRows stream rows to COPY without build copy of whole row set
+type copyRows struct {
+	count  int
+	index  int
+	values func(i int) []interface{}
+}
+
+func (c *copyRows) Next() bool {
+	c.index++
+	return c.index <= c.count
+}
+
+func (c *copyRows) Values() ([]interface{}, error) {
+	return c.values(c.index - 1), nil
+}
+
+func (c *copyRows) Err() error {
+	return nil
+}
+
+// columnNames return only names from column definitions
+func columnNames(columns []string) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = strings.Fields(c)[0]
+	}
+	return names
+}
+
+// createTempTableSql return DDL of temp table dropped on transaction end
+func createTempTableSql(table string, columns []string) string {
+	return "CREATE TEMP TABLE " + table + " (" + strings.Join(columns, ", ") + ") ON COMMIT DROP"
+}
+
+// connectCopyAndMerge load rows into temp table by COPY and run merge function in one transaction
+func connectCopyAndMerge(ctx context.Context, conn *pgxpool.Conn, table string, columns []string, rows *copyRows, sql string, args ...interface{}) (err error) {
+	fields := log.Fields{"table": table, "rows": rows.count}
+	start := time.Now()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err.Error()).Errorf("Problem start transaction for AXL DB data update")
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+	if _, err = tx.Exec(ctx, createTempTableSql(table, columns)); err != nil {
+		log.WithFields(fields).WithField("error", err.Error()).Errorf("Problem create temp table %s", table)
+		return err
+	}
+	copied, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columnNames(columns), rows)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err.Error()).Errorf("Problem copy rows into temp table %s", table)
+		return err
+	}
+	copyDuration := time.Since(start)
+	if _, err = tx.Exec(ctx, sql, args...); err != nil {
+		log.WithFields(fields).WithFields(log.Fields{"command": sql, "error": err.Error()}).Errorf("Process AXL DB data update")
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		log.WithFields(fields).WithField("error", err.Error()).Errorf("Problem commit AXL DB data update")
+		return err
+	}
+	log.WithFields(fields).WithFields(log.Fields{"copied": copied, "copy": copyDuration.String(), "merge": (time.Since(start) - copyDuration).String()}).
+		Infof("Success update AXL source table, %d rows copied in %s", copied, copyDuration)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCopyRows(t *testing.T) {
+	t.Parallel()
+	users := []UserDeviceLine{
+		{UserPKID: "u1", DevicePKID: "d1", LinePKID: "l1", Status: 1, DeviceTypeName: DeviceTypeDesk},
+		{UserPKID: "u2", DevicePKID: "d2", LinePKID: "l2", Status: 0, DeviceTypeName: DeviceTypeCtiPort, ExcludeMapping: true},
+	}
+	rows := &copyRows{count: len(users), values: func(i int) []interface{} { return users[i].copyValues() }}
+	names := columnNames(userDeviceColumns)
+	read := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			t.Errorf("copy rows not expect error %s", err)
+		}
+		if len(values) != len(names) {
+			t.Errorf("copy row has %d values for %d columns", len(values), len(names))
+			break
+		}
+		row := map[string]interface{}{}
+		for i, n := range names {
+			row[n] = values[i]
+		}
+		u := users[read]
+		if row["user_pkid"] != u.UserPKID || row["status"] != u.Status || row["device_type"] != u.DeviceTypeName || row["device_mapping"] != !u.ExcludeMapping {
+			t.Errorf("copy row %d not expect values %v", read, row)
+		}
+		read++
+	}
+	if read != len(users) || rows.Err() != nil {
+		t.Errorf("copy rows read %d rows, expect %d", read, len(users))
+	}
+	login := LoginUser{UserPKID: "u1", AccessGroup: "QM", DefaultRole: "Agent"}
+	if len(login.copyValues()) != len(loginUserColumns) {
+		t.Errorf("login user has %d values for %d columns", len(login.copyValues()), len(loginUserColumns))
+	}
+}
+
+func TestCreateTempTableSql(t *testing.T) {
+	t.Parallel()
+	sql := createTempTableSql(tempTableLoginUser, loginUserColumns)
+	if !strings.HasPrefix(sql, "CREATE TEMP TABLE axl_login_users_tmp (user_pkid varchar, ") || !strings.HasSuffix(sql, "default_role varchar) ON COMMIT DROP") {
+		t.Errorf("not expect temp table DDL %s", sql)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed DBScripts/migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	MigrateUp     = "up"
+	MigrateStatus = "status"
+	migrationDir  = "DBScripts/migrations"
+	migrateLockId = 7100240 // pg_advisory_lock key, only one migration run at a time
+)
+
+const (
+	existsSchemaVersion     = "SELECT count(1) FROM information_schema.tables WHERE table_schema = $1 AND table_name = 'schema_version'"
+	createSchemaVersion     = "CREATE TABLE IF NOT EXISTS %s.schema_version (version int primary key, name varchar(255) not null, applied_at timestamp default now() not null)"
+	selectAppliedMigrations = "SELECT version, to_char(applied_at, 'YYYY-MM-DD HH24:MI:SS') FROM %s.schema_version ORDER BY version"
+	insertAppliedMigration  = "INSERT INTO %s.schema_version (version, name) VALUES ($1, $2)"
+	lockMigration           = "SELECT pg_advisory_lock($1)"
+	unlockMigration         = "SELECT pg_advisory_unlock($1)"
+)
+
+// migrationFileName is NNNN_name.sql, number is schema version
+var migrationFileName = regexp.MustCompile(`^(\d{4})_(\w+)\.sql$`)
+
+// Migration is one embedded SQL script, scripts use schema axl_data
+type Migration struct {
+	Version int
+	Name    string
+	Sql     string
+}
+
+// loadMigrations read embedded migrations sorted by version, versions must continue from 1 without gaps
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+	var list []Migration
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, errors.New(fmt.Sprintf("migration file name %s not match NNNN_name.sql", e.Name()))
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := migrationFiles.ReadFile(path.Join(migrationDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: m[2], Sql: string(data)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, errors.New(fmt.Sprintf("migration %04d_%s is out of sequence, expected version %d", m.Version, m.Name, i+1))
+		}
+	}
+	return list, nil
+}
+
+// requiredSchemaVersion is version of last embedded migration
+func requiredSchemaVersion() int {
+	list, err := loadMigrations()
+	if err != nil {
+		return 0
+	}
+	return len(list)
+}
+
+// SchemaSql return migration SQL for configured schema
+func (m *Migration) SchemaSql(schema string) string {
+	if schema == DbSchema {
+		return m.Sql
+	}
+	return strings.ReplaceAll(m.Sql, DbSchema+".", schema+".")
+}
+
+// connectAppliedMigrations return applied versions with time, empty when schema_version not exists
+func connectAppliedMigrations(ctx context.Context, conn *pgxpool.Conn, schema string) (map[int]string, error) {
+	applied := map[int]string{}
+	var cnt int
+	if err := conn.QueryRow(ctx, existsSchemaVersion, schema).Scan(&cnt); err != nil || cnt == 0 {
+		return applied, err
+	}
+	rows, err := conn.Query(ctx, fmt.Sprintf(selectAppliedMigrations, schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// connectSchemaVersion return highest applied migration, 0 for schema without migrations
+func connectSchemaVersion(ctx context.Context, conn *pgxpool.Conn, schema string) (int, error) {
+	applied, err := connectAppliedMigrations(ctx, conn, schema)
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, err
+}
+
+// connectMigrateUp apply not applied migrations, every migration in own transaction
+func connectMigrateUp(ctx context.Context, conn *pgxpool.Conn, schema string, list []Migration) (int, error) {
+	if _, err := conn.Exec(ctx, lockMigration, migrateLockId); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), unlockMigration, migrateLockId)
+	}()
+	if _, err := conn.Exec(ctx, fmt.Sprintf(createSchemaVersion, schema)); err != nil {
+		return 0, err
+	}
+	applied, err := connectAppliedMigrations(ctx, conn, schema)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return cnt, err
+		}
+		if _, err = tx.Exec(ctx, m.SchemaSql(schema)); err == nil {
+			_, err = tx.Exec(ctx, fmt.Sprintf(insertAppliedMigration, schema), m.Version, m.Name)
+		}
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			_ = tx.Rollback(context.Background())
+			log.WithFields(log.Fields{"version": m.Version, "name": m.Name, "error": err.Error()}).Errorf("problem apply migration %04d_%s", m.Version, m.Name)
+			return cnt, errors.New(fmt.Sprintf("migration %04d_%s failed: %s", m.Version, m.Name, err))
+		}
+		cnt++
+		log.WithFields(log.Fields{"version": m.Version, "name": m.Name, "duration": time.Since(start).String()}).Infof("migration %04d_%s applied", m.Version, m.Name)
+	}
+	return cnt, nil
+}
+
+// migrationStatus list embedded migrations with time of apply
+func migrationStatus(list []Migration, applied map[int]string) *QueryResult {
+	result := &QueryResult{Columns: []string{"version", "name", "applied_at"}}
+	for _, m := range list {
+		appliedAt, ok := applied[m.Version]
+		if !ok {
+			appliedAt = "pending"
+		}
+		result.Rows = append(result.Rows, map[string]string{"version": strconv.Itoa(m.Version), "name": m.Name, "applied_at": appliedAt})
+	}
+	return result
+}
+
+// runMigrate apply pending migrations (up) and print status of migrations
+func runMigrate(ctx context.Context, w io.Writer, action string) error {
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Processing.DbTimeout)*time.Minute)
+	defer cancel()
+	conn, err := connectDb(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	schema := config.Zqm.DbSchema
+	if action == MigrateUp {
+		cnt, err := connectMigrateUp(ctx, conn, schema, list)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"schema": schema, "applied": cnt}).Infof("%d migrations applied", cnt)
+	}
+	applied, err := connectAppliedMigrations(ctx, conn, schema)
+	if err != nil {
+		return err
+	}
+	return migrationStatus(list, applied).Write(w, QueryFormatTable)
+}
+
+// checkDbSchema refuse DB schema older than embedded migrations and team mapping not valid in DB,
+// not accessible DB is checked by processing
+func checkDbSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Zqm.DbConnectTimeout)*time.Second*2)
+	defer cancel()
+	conn, err := connectDb(ctx)
+	if err != nil {
+		log.WithField("error", err.Error()).Warnf("DB schema version not checked, problem connect to DB")
+		return nil
+	}
+	defer conn.Release()
+	required := requiredSchemaVersion()
+	version, err := connectSchemaVersion(ctx, conn, config.Zqm.DbSchema)
+	if err != nil {
+		log.WithField("error", err.Error()).Warnf("DB schema version not checked, problem read schema_version")
+		return nil
+	}
+	fields := log.Fields{"schema": config.Zqm.DbSchema, "version": version, "required": required}
+	if version < required {
+		return errors.New(fmt.Sprintf("DB schema %s version %d is older than required %d, run migrate up", config.Zqm.DbSchema, version, required))
+	}
+	if version > required {
+		log.WithFields(fields).Warnf("DB schema version %d is newer than program version %d", version, required)
+	} else {
+		log.WithFields(fields).Debugf("DB schema version %d", version)
+	}
+	return connectCheckTeamMapping(ctx, conn, config.Mapping.Teams)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+	list, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("embedded migrations not expect error %s", err)
+	}
+	if len(list) < 1 || list[0].Version != 1 || list[0].Name != "baseline" {
+		t.Fatalf("first migration must be 0001_baseline, got %+v", list)
+	}
+	if requiredSchemaVersion() != len(list) {
+		t.Errorf("required schema version %d not match %d migrations", requiredSchemaVersion(), len(list))
+	}
+	// migrations upgrade existing schema, only leftover import tables can be dropped
+	dropTable := regexp.MustCompile(`(?i)drop table if exists axl_data\.(\w+)`)
+	for _, m := range list {
+		if strings.TrimSpace(m.Sql) == "" {
+			t.Errorf("migration %d is empty", m.Version)
+		}
+		for _, d := range dropTable.FindAllStringSubmatch(m.Sql, -1) {
+			if !strings.HasSuffix(d[1], "_tmp") {
+				t.Errorf("migration %d drop table axl_data.%s with data", m.Version, d[1])
+			}
+		}
+	}
+}
+
+func TestMigration_SchemaSql(t *testing.T) {
+	t.Parallel()
+	m := Migration{Version: 1, Name: "test", Sql: "create table if not exists axl_data.axl_users (id int); select * from pg_temp.axl_users_tmp;"}
+	tables := []struct {
+		schema string
+		e      string
+	}{
+		{DbSchema, m.Sql},
+		{"axl_import", "create table if not exists axl_import.axl_users (id int); select * from pg_temp.axl_users_tmp;"},
+	}
+	for _, table := range tables {
+		if s := m.SchemaSql(table.schema); s != table.e {
+			t.Errorf("migration SQL for schema %s not expect [%s]", table.schema, s)
+		}
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	t.Parallel()
+	list := []Migration{{Version: 1, Name: "baseline"}, {Version: 2, Name: "em_history"}}
+	result := migrationStatus(list, map[int]string{1: "2026-10-18 04:00:00"})
+	var b bytes.Buffer
+	if err := result.Write(&b, QueryFormatCsv); err != nil {
+		t.Fatalf("status write not expect error %s", err)
+	}
+	e := "version,name,applied_at\n1,baseline,2026-10-18 04:00:00\n2,em_history,pending\n"
+	if b.String() != e {
+		t.Errorf("migration status not expect [%s]", b.String())
+	}
+}
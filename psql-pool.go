@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// dbIdentifier is lower case PostgreSQL name usable without quotes
+var dbIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var (
+	dbPool     *pgxpool.Pool // pool shared by scheduler goroutines, created on first use
+	dbPoolLock sync.Mutex
+)
+
+// dbConnValue quote value for keyword/value connection string
+func dbConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// dbConnString build connection string without password, configured schema is first in search_path
+func dbConnString(c *ConfigZqm) string {
+	s := []string{
+		"host=" + dbConnValue(c.DbServer),
+		fmt.Sprintf("port=%d", c.DbPort),
+		"dbname=" + dbConnValue(c.DbName),
+		"user=" + dbConnValue(c.DbUser),
+		"sslmode=" + dbConnValue(c.DbSslMode),
+	}
+	// with require mode is CA file not used, certificate is not verified
+	if c.DbSslMode == DbSslVerifyCa || c.DbSslMode == DbSslVerifyFull {
+		s = append(s, "sslrootcert="+dbConnValue(c.DbCaFile))
+	}
+	s = append(s,
+		fmt.Sprintf("connect_timeout=%d", c.DbConnectTimeout),
+		"search_path="+dbConnValue(fmt.Sprintf("%s,callrec,wbsc,public", c.DbSchema)),
+		fmt.Sprintf("statement_timeout=%d", c.DbStatementTimeout*1000),
+		fmt.Sprintf("pool_max_conns=%d", c.DbMaxConns),
+	)
+	return strings.Join(s, " ")
+}
+
+// dbPoolConfig parse pool configuration from ZQM section
+func dbPoolConfig(c *ConfigZqm) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(dbConnString(c))
+	if err != nil {
+		return nil, err
+	}
+	// without password is used PGPASSWORD or .pgpass (migrate with other DB user)
+	if len(c.DbPassword) > 0 {
+		cfg.ConnConfig.Password = c.DbPassword
+	}
+	return cfg, nil
+}
+
+// getDbPool return shared pool, pool is created by first call. Problem with connection is repeated in next call
+func getDbPool(ctx context.Context) (*pgxpool.Pool, error) {
+	dbPoolLock.Lock()
+	defer dbPoolLock.Unlock()
+	if dbPool != nil {
+		return dbPool, nil
+	}
+	s := dbConnString(&config.Zqm)
+	log.WithField("conn", s).Debugf("Connection [%s]", s)
+	cfg, err := dbPoolConfig(&config.Zqm)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	dbPool = pool
+	return dbPool, nil
+}
+
+// connectDb acquire connection from shared pool, connection must be released
+func connectDb(ctx context.Context) (*pgxpool.Conn, error) {
+	pool, err := getDbPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pool.Acquire(ctx)
+}
+
+// closeDbPool close all pooled connections, used on program end
+func closeDbPool() {
+	dbPoolLock.Lock()
+	defer dbPoolLock.Unlock()
+	if dbPool != nil {
+		dbPool.Close()
+		dbPool = nil
+	}
+}
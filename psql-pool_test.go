@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDbPoolConfig(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		t          ConfigZqm
+		tls        bool
+		verify     bool
+		searchPath string
+		timeout    string
+		name       string
+	}{
+		{ConfigZqm{DbServer: "zqm", DbPort: 5433, DbName: "callrec", DbSchema: "axl_data", DbUser: "axluser", DbPassword: "p'w d", DbSslMode: DbSslDisable, DbConnectTimeout: 10, DbMaxConns: 4},
+			false, false, "axl_data,callrec,wbsc,public", "0", "disable"},
+		{ConfigZqm{DbServer: "zqm", DbPort: 5432, DbName: "qm db", DbSchema: "axl_import", DbUser: "axluser", DbPassword: "pwd", DbSslMode: DbSslRequire, DbConnectTimeout: 5, DbStatementTimeout: 60, DbMaxConns: 2},
+			true, false, "axl_import,callrec,wbsc,public", "60000", "require"},
+	}
+	for _, table := range tables {
+		cfg, err := dbPoolConfig(&table.t)
+		if err != nil {
+			t.Errorf("pool config for [%s] not expect error %s", table.name, err)
+			continue
+		}
+		c := cfg.ConnConfig
+		if c.Host != table.t.DbServer || int(c.Port) != table.t.DbPort || c.Database != table.t.DbName || c.User != table.t.DbUser || c.Password != table.t.DbPassword {
+			t.Errorf("pool config for [%s] not expect connection %s:%d/%s user %s", table.name, c.Host, c.Port, c.Database, c.User)
+		}
+		if (c.TLSConfig != nil) != table.tls || (c.TLSConfig != nil && c.TLSConfig.InsecureSkipVerify == table.verify) {
+			t.Errorf("pool config for [%s] not expect TLS %+v", table.name, c.TLSConfig)
+		}
+		if c.RuntimeParams["search_path"] != table.searchPath || c.RuntimeParams["statement_timeout"] != table.timeout {
+			t.Errorf("pool config for [%s] not expect runtime params %v", table.name, c.RuntimeParams)
+		}
+		if cfg.MaxConns != int32(table.t.DbMaxConns) {
+			t.Errorf("pool config for [%s] not expect pool size %d", table.name, cfg.MaxConns)
+		}
+		if strings.Contains(dbConnString(&table.t), table.t.DbPassword) {
+			t.Errorf("connection string for [%s] contains password", table.name)
+		}
+	}
+}
@@ -3,101 +3,305 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	tempTableUserDevice = "CREATE TABLE axl_data.axl_users_tmp AS " +
-		"SELECT " +
-		"(j.v ->> 'user_pkid')::varchar as user_pkid, " +
-		"(j.v ->> 'device_pkid')::varchar as device_pkid, " +
-		"(j.v ->> 'line_pkid')::varchar as line_pkid, " +
-		"(j.v ->> 'firstname')::varchar as first_name, " +
-		"(j.v ->> 'middlename')::varchar as middle_name, " +
-		"(j.v ->> 'lastname')::varchar as last_name, " +
-		"(j.v ->> 'userid')::varchar as user_id, " +
-		"(j.v ->> 'department')::varchar as department, " +
-		"(j.v ->> 'status')::int as status, " +
-		"(j.v ->> 'islocaluser')::bool as is_local_user, " +
-		"(j.v ->> 'uccx')::bool as has_uccx, " +
-		"(j.v ->> 'directoryuri')::varchar as directory_uri, " +
-		"(j.v ->> 'mailid')::varchar as mail_id, " +
-		"(j.v ->> 'devicename')::varchar as device_name, " +
-		"(j.v ->> 'devicedescrition')::varchar as device_description, " +
-		"(j.v ->> 'dnorpattern')::varchar as line_number, " +
-		"(j.v ->> 'alertingnameascii')::varchar as line_alerting_name, " +
-		"(j.v ->> 'line_description')::varchar as line_description, " +
-		"(j.v ->> 'cluster_name')::varchar as cluster_name " +
-		"FROM json_array_elements($1::json) j(v); "
-	tempTableLoginUser = "CREATE TABLE axl_data.axl_login_users_tmp AS " +
-		"SELECT " +
-		"(j.v ->> 'user_pkid')::varchar as user_pkid, " +
-		"(j.v ->> 'firstname')::varchar as first_name, " +
-		"(j.v ->> 'middlename')::varchar as middle_name, " +
-		"(j.v ->> 'lastname')::varchar as last_name, " +
-		"(j.v ->> 'userid')::varchar as user_id, " +
-		"(j.v ->> 'department')::varchar as department, " +
-		"(j.v ->> 'status')::int as status, " +
-		"(j.v ->> 'islocaluser')::bool as is_local_user, " +
-		"(j.v ->> 'uccx')::bool as has_uccx, " +
-		"(j.v ->> 'directoryuri')::varchar as directory_uri, " +
-		"(j.v ->> 'mailid')::varchar as mail_id, " +
-		"(j.v ->> 'cluster_name')::varchar as cluster_name " +
-		"FROM json_array_elements($1::json) j(v); "
-	processTempTableUserDevice = "SELECT axl_data.axl_update_users($1::varchar, $2::text)"
-	processTempTableLoginUser  = "SELECT axl_data.axl_update_login_users($1::varchar, $2::text)"
-	processQmUpdate            = "SELECT * from axl_data.axl_update_qm($1::varchar, $2::varchar)"
-	processCallUpdateByDevice  = "SELECT * from axl_update_couples_by_device($1::int, $2::bool)"
-	processCallUpdateByLine    = "SELECT * from axl_update_couples_by_line($1::int, $2::bool)"
+	processUserDevice        = "SELECT axl_update_users($1::text)"
+	processLoginUser         = "SELECT axl_update_login_users($1::text)"
+	selectChangeCursor       = "SELECT coalesce(cluster_name, ''), coalesce(queue_id, ''), next_change_id FROM axl_change_cursor WHERE cluster_key = $1"
+	saveChangeCursor         = "SELECT axl_save_change_cursor($1::varchar, $2::varchar, $3::varchar, $4::bigint)"
+	selectSchemaVersion      = "SELECT schema_version FROM axl_schema_version WHERE cluster_key = $1"
+	saveSchemaVersion        = "SELECT axl_save_schema_version($1::varchar, $2::varchar, $3::varchar)"
+	processUserGroups        = "SELECT axl_update_user_groups($1::text, $2::text)"
+	processChangedUserGroups = "SELECT axl_update_user_groups($1::text, null, $2::text)"
+	processEmSessionUpdate   = "SELECT axl_update_em_sessions($1::text, $2::text)"
+	saveDuplicates           = "SELECT axl_save_duplicates($1::text)"
+	selectLatestDuplicates   = "SELECT r.run_id, to_char(r.run_time, 'YYYY-MM-DD HH24:MI:SS'), coalesce(d.object_type, ''), " +
+		"coalesce(d.name, ''), coalesce(d.description, ''), coalesce(d.device_type, ''), coalesce(d.user_ids, ''), " +
+		"coalesce(d.winner, ''), coalesce(d.reason, '') " +
+		"FROM axl_duplicate_runs r INNER JOIN axl_duplicates d ON d.run_id = r.run_id " +
+		"WHERE r.run_id = (SELECT max(run_id) FROM axl_duplicate_runs) ORDER BY d.object_type, d.name"
+	processQmUpdate           = "SELECT * from axl_update_qm($1::varchar, $2::varchar, $3::text, $4::bool, $5::text)"
+	selectMapTeam             = "SELECT coalesce(axl_map_team($1::varchar, $2::text), '')"
+	processCallUpdateByDevice = "SELECT * from axl_update_couples_by_device($1::int, $2::bool)"
+	processCallUpdateByLine   = "SELECT * from axl_update_couples_by_line($1::int, $2::bool)"
+	selectChangedObjects      = "SELECT DISTINCT coalesce(device_pkid, ''), coalesce(line_pkid, '') FROM axl_users " +
+		"WHERE cluster_name = $1 AND is_deleted_on_axl = false AND (substr(user_pkid, length(cluster_name) + 2) = ANY($2::text[]) " +
+		"OR device_pkid = ANY($2::text[]) OR line_pkid = ANY($2::text[]))"
 )
 
-func connectDb() (conn *pgx.Conn, err error) {
-	s := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=disable", config.Zqm.DbServer, 5432, config.Zqm.DbUser, "callrec")
-	log.WithField("conn", s).Debugf("Connection [%s]", s)
-	cfg, err := pgx.ParseConfig(fmt.Sprintf("%s password=%s", s, config.Zqm.DbPassword))
-	if err == nil {
-		//cfg.Logger = logrusadapter.NewLogger(log.New())
-		//cfg.LogLevel = pgx.LogLevelTrace
-		conn, err = pgx.ConnectConfig(context.Background(), cfg)
+// connectRunUserDeviceFunc update AXL users table, scope nil is full import
+func connectRunUserDeviceFunc(ctx context.Context, conn *pgxpool.Conn, user []UserDeviceLine, scope *ChangeScope) (err error) {
+	sc, err := scopeParam(scope)
+	if err != nil {
+		return err
+	}
+	rows := &copyRows{count: len(user), values: func(i int) []interface{} { return user[i].copyValues() }}
+	return connectCopyAndMerge(ctx, conn, tempTableUserDevice, userDeviceColumns, rows, processUserDevice, sc)
+}
+
+// connectRunLoginUserFunc update AXL login users table, scope nil is full import
+func connectRunLoginUserFunc(ctx context.Context, conn *pgxpool.Conn, user []LoginUser, scope *ChangeScope) (err error) {
+	sc, err := scopeParam(scope)
+	if err != nil {
+		return err
 	}
-	return conn, err
+	rows := &copyRows{count: len(user), values: func(i int) []interface{} { return user[i].copyValues() }}
+	return connectCopyAndMerge(ctx, conn, tempTableLoginUser, loginUserColumns, rows, processLoginUser, sc)
 }
 
-func connectRunUserDeviceFunc(conn *pgx.Conn, user []UserDeviceLine) (err error) {
-	d, err := json.Marshal(user)
+// scopeParam convert incremental scope to JSON parameter, full import is null
+func scopeParam(scope *ChangeScope) (interface{}, error) {
+	if scope == nil {
+		return nil, nil
+	}
+	sc, err := json.Marshal(scope)
+	if err != nil {
+		return nil, err
+	}
+	return string(sc), nil
+}
+
+// connectRunUserGroupFunc replace group membership of read clusters, scope nil is full import
+func connectRunUserGroupFunc(ctx context.Context, conn *pgxpool.Conn, groups []UserGroup, clusters []string, scope *ChangeScope) (err error) {
+	if groups == nil {
+		groups = []UserGroup{}
+	}
+	if clusters == nil {
+		clusters = []string{}
+	}
+	d, err := json.Marshal(groups)
 	if err != nil {
 		log.WithField("error", err.Error()).Errorf("Problem convert source data to JSON string")
 		return err
 	}
-	return connectAndUpdateAxlTables(conn, processTempTableUserDevice, tempTableUserDevice, string(d))
+	sql, param := processUserGroups, interface{}(clusters)
+	if scope != nil {
+		sql, param = processChangedUserGroups, scope
+	}
+	p, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, sql, string(d), string(p))
+	if err != nil {
+		log.WithField("error", err.Error()).WithField("clusters", clusters).Errorf("Process AXL group membership update")
+	} else {
+		log.WithField("rows", len(groups)).Info("Success update AXL group membership")
+	}
+	return err
 }
 
-func connectRunLoginUserFunc(conn *pgx.Conn, user []LoginUser) (err error) {
-	d, err := json.Marshal(user)
+// connectRunEmSessionFunc store Extension Mobility logins, clusters nil close sessions of all clusters
+func connectRunEmSessionFunc(ctx context.Context, conn *pgxpool.Conn, sessions []EmSession, clusters []string) (err error) {
+	if sessions == nil {
+		sessions = []EmSession{}
+	}
+	d, err := json.Marshal(sessions)
 	if err != nil {
 		log.WithField("error", err.Error()).Errorf("Problem convert source data to JSON string")
 		return err
 	}
-	return connectAndUpdateAxlTables(conn, processTempTableLoginUser, tempTableLoginUser, string(d))
+	var param interface{}
+	if clusters != nil {
+		c, err := json.Marshal(clusters)
+		if err != nil {
+			return err
+		}
+		param = string(c)
+	}
+	var changed int
+	err = conn.QueryRow(ctx, processEmSessionUpdate, string(d), param).Scan(&changed)
+	if err != nil {
+		log.WithField("error", err.Error()).WithField("clusters", clusters).Errorf("Process Extension Mobility logins update")
+	} else {
+		log.WithFields(log.Fields{"rows": len(sessions), "changed": changed}).Info("Success update Extension Mobility logins")
+	}
+	return err
 }
 
-func connectAndUpdateAxlTables(conn *pgx.Conn, sql string, tempTableName string, jsonString string) (err error) {
-	_, err = conn.Exec(context.Background(), sql, tempTableName, jsonString)
+// connectSaveDuplicates store duplicate report of full import as new run
+func connectSaveDuplicates(ctx context.Context, conn *pgxpool.Conn, report []DuplicateReportRow) (err error) {
+	if report == nil {
+		report = []DuplicateReportRow{}
+	}
+	d, err := json.Marshal(report)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("Problem convert duplicate report to JSON string")
+		return err
+	}
+	var runId int
+	err = conn.QueryRow(ctx, saveDuplicates, string(d)).Scan(&runId)
 	if err != nil {
-		log.WithField("error", err.Error()).WithFields(log.Fields{"command": sql, "table": tempTableName}).Errorf("Process AXL DB data update")
+		log.WithField("error", err.Error()).Errorf("Process duplicate report update")
 	} else {
-		log.Info("Success update AXL source table")
+		log.WithFields(log.Fields{"rows": len(report), "run": runId}).Info("Success store duplicate report")
 	}
 	return err
 }
 
-func connectUpdateQm(conn *pgx.Conn) (err error) {
+// connectReadDuplicates read latest duplicate report
+func connectReadDuplicates(ctx context.Context, conn *pgxpool.Conn) (*QueryResult, error) {
+	result := NewQueryResult()
+	result.Columns = []string{"run_id", "run_time", "object_type", "name", "description", "device_type", "user_ids", "winner", "reason"}
+	rows, err := conn.Query(ctx, selectLatestDuplicates)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("problem read duplicate report")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runId int
+		values := make([]string, len(result.Columns)-1)
+		dest := []interface{}{&runId}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.WithField("error", err).Error("problem read row data")
+			return nil, err
+		}
+		row := map[string]string{result.Columns[0]: fmt.Sprint(runId)}
+		for i, v := range values {
+			row[result.Columns[i+1]] = v
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// connectReadChangeCursor read stored change cursor, nil when cursor not exists
+func connectReadChangeCursor(ctx context.Context, conn *pgxpool.Conn, clusterKey string) (*ChangeCursor, error) {
+	cursor := &ChangeCursor{ClusterKey: clusterKey}
+	err := conn.QueryRow(ctx, selectChangeCursor, clusterKey).Scan(&cursor.ClusterName, &cursor.QueueId, &cursor.NextChangeId)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "cluster": clusterKey}).Errorf("problem read change cursor")
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func connectSaveChangeCursor(ctx context.Context, conn *pgxpool.Conn, cursor *ChangeCursor) error {
+	_, err := conn.Exec(ctx, saveChangeCursor, cursor.ClusterKey, cursor.ClusterName, cursor.QueueId, cursor.NextChangeId)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "cluster": cursor.ClusterKey}).Errorf("problem store change cursor")
+	} else {
+		log.WithFields(log.Fields{"cluster": cursor.ClusterKey, "next": cursor.NextChangeId}).Debugf("change cursor stored")
+	}
+	return err
+}
+
+// connectReadChangedObjects return changed pkid with devices and lines imported for them before change,
+// object removed from changed user can be imported for other user now
+func connectReadChangedObjects(ctx context.Context, conn *pgxpool.Conn, clusterName string, pkid []string) ([]string, error) {
+	affected := map[string]bool{}
+	for _, p := range pkid {
+		affected[p] = true
+	}
+	rows, err := conn.Query(ctx, selectChangedObjects, clusterName, pkid)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "cluster": clusterName}).Errorf("problem read imported rows of changed objects")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var device, line string
+		if err = rows.Scan(&device, &line); err != nil {
+			return nil, err
+		}
+		for _, p := range []string{device, line} {
+			if len(p) > 0 {
+				affected[p] = true
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortedPkid(affected), nil
+}
+
+// connectReadSchemaVersion read cached AXL schema version, empty when not stored
+func connectReadSchemaVersion(ctx context.Context, conn *pgxpool.Conn, clusterKey string) (string, error) {
+	var version string
+	err := conn.QueryRow(ctx, selectSchemaVersion, clusterKey).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "cluster": clusterKey}).Errorf("problem read AXL schema version")
+	}
+	return version, err
+}
+
+func connectSaveSchemaVersion(ctx context.Context, conn *pgxpool.Conn, clusterKey string, version string, cucm string) error {
+	_, err := conn.Exec(ctx, saveSchemaVersion, clusterKey, version, cucm)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "cluster": clusterKey}).Errorf("problem store AXL schema version")
+	} else {
+		log.WithFields(log.Fields{"cluster": clusterKey, "version": version}).Debugf("AXL schema version %s stored", version)
+	}
+	return err
+}
+
+// connectMapTeam return team mapped by DB function for department, empty when no rule match
+func connectMapTeam(ctx context.Context, conn *pgxpool.Conn, department string, teams []ConfigTeamMapping) (string, error) {
+	if teams == nil {
+		teams = []ConfigTeamMapping{}
+	}
+	t, err := json.Marshal(teams)
+	if err != nil {
+		return "", err
+	}
+	var team string
+	err = conn.QueryRow(ctx, selectMapTeam, department, string(t)).Scan(&team)
+	return team, err
+}
+
+// connectCheckTeamMapping compile regex rules by PostgreSQL, rules are evaluated as ARE (not Go regexp syntax)
+func connectCheckTeamMapping(ctx context.Context, conn *pgxpool.Conn, teams []ConfigTeamMapping) error {
+	for _, m := range teams {
+		if !m.Regex {
+			continue
+		}
+		if _, err := connectMapTeam(ctx, conn, "", []ConfigTeamMapping{m}); err != nil {
+			return errors.New(fmt.Sprintf("team mapping department %s is not valid PostgreSQL regular expression: %s", m.Department, err))
+		}
+	}
+	return nil
+}
+
+func connectUpdateQm(ctx context.Context, conn *pgxpool.Conn) (err error) {
 	var msg, data string
+	teams := config.Mapping.Teams
+	if teams == nil {
+		teams = []ConfigTeamMapping{}
+	}
+	t, err := json.Marshal(teams)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("Problem convert team mapping to JSON string")
+		return err
+	}
+	roles := config.Mapping.Roles
+	if roles == nil {
+		roles = []ConfigRoleMapping{}
+	}
+	r, err := json.Marshal(roles)
+	if err != nil {
+		log.WithField("error", err.Error()).Errorf("Problem convert role mapping to JSON string")
+		return err
+	}
 	log.WithFields(log.Fields{"command": processQmUpdate, "role": config.Processing.DefaultRoleName,
-		"team": config.Processing.DefaultTeamName}).Debug("Process QM DB data update")
-	rows, err := conn.Query(context.Background(), processQmUpdate, config.Processing.DefaultTeamName, config.Processing.DefaultRoleName)
+		"team": config.Processing.DefaultTeamName, "teamMapping": string(t), "roleMapping": string(r)}).Debug("Process QM DB data update")
+	rows, err := conn.Query(ctx, processQmUpdate, config.Processing.DefaultTeamName, config.Processing.DefaultRoleName, string(t), config.Mapping.MoveTeam, string(r))
 	if err != nil {
 		log.WithFields(log.Fields{"error": err.Error(), "command": processQmUpdate, "role": config.Processing.DefaultRoleName,
 			"team": config.Processing.DefaultTeamName}).Errorf("Process QM DB data update")
@@ -115,6 +319,14 @@ func connectUpdateQm(conn *pgx.Conn) (err error) {
 					log.WithFields(log.Fields{"operation": msg, "user": data}).Infof("Mark user deleted and rename it")
 				} else if msg == "PROBLEM" {
 					log.WithFields(log.Fields{"operation": msg, "user": data}).Error("Problem update/insert users")
+				} else if msg == "TEAM" {
+					log.WithFields(log.Fields{"operation": msg, "team": data}).Infof("Create new QM team")
+				} else if msg == "MOVE" {
+					log.WithFields(log.Fields{"operation": msg, "user": data}).Infof("Move user to mapped QM team")
+				} else if msg == "ROLE" {
+					log.WithFields(log.Fields{"operation": msg, "user": data}).Infof("Change user role by access control group mapping")
+				} else if msg == "NOROLE" {
+					log.WithFields(log.Fields{"operation": msg, "role": data}).Errorf("Mapped role not exists in QM, default role is used")
 				} else if msg == "PARAM" {
 					log.WithFields(log.Fields{"operation": msg, "parameter": data}).Info("Use parameters for insert")
 				} else {
@@ -129,12 +341,12 @@ func connectUpdateQm(conn *pgx.Conn) (err error) {
 	return err
 }
 
-func connectUpdateCalls(conn *pgx.Conn, sql string) (err error) {
+func connectUpdateCalls(ctx context.Context, conn *pgxpool.Conn, sql string) (err error) {
 	var msg, data string
 
 	log.WithFields(log.Fields{"command": sql,
 		"hours_back": config.Processing.HoursBack, "set_direction": config.Processing.SetDirection}).Debug("Process DB couple data update")
-	rows, err := conn.Query(context.Background(), sql, config.Processing.HoursBack, config.Processing.SetDirection)
+	rows, err := conn.Query(ctx, sql, config.Processing.HoursBack, config.Processing.SetDirection)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err.Error(), "command": sql,
 			"hours_back": config.Processing.HoursBack}).Errorf("Process DB call data update")
@@ -148,6 +360,10 @@ func connectUpdateCalls(conn *pgx.Conn, sql string) (err error) {
 					log.WithFields(log.Fields{"process": msg, "records": data}).Infof("Prepare couples to processing")
 				} else if msg == "UPDATE" {
 					log.WithFields(log.Fields{"process": msg, "records": data}).Infof("Updated couples")
+				} else if msg == "EM" {
+					log.WithFields(log.Fields{"process": msg, "records": data}).Infof("Couples attributed to Extension Mobility user")
+				} else if msg == "AMBIGUOUS" {
+					log.WithFields(log.Fields{"process": msg, "records": data}).Infof("Couples with DN in more route partitions not mapped")
 				} else if msg == "LAST" {
 					log.WithFields(log.Fields{"process": msg, "last_ts": data}).Infof("Stored last update timestamp from couples")
 				} else {
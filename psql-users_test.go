@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDbEnv is connection string of PostgreSQL used by DB tests, tests are skipped without it
+const testDbEnv = "ZQM_TEST_DB"
+
+// testDbConn apply embedded migrations into temporary schema, schema is dropped on test end
+func testDbConn(t *testing.T) *pgxpool.Conn {
+	connString := os.Getenv(testDbEnv)
+	if connString == "" {
+		t.Skipf("%s not set, DB test skipped", testDbEnv)
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.Connect(ctx, connString)
+	if err != nil {
+		t.Fatalf("connect to test DB not expect error %s", err)
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		pool.Close()
+		t.Fatalf("acquire test DB connection not expect error %s", err)
+	}
+	schema := fmt.Sprintf("axl_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = conn.Exec(context.Background(), "DROP SCHEMA IF EXISTS "+schema+" CASCADE")
+		conn.Release()
+		pool.Close()
+	})
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create test schema not expect error %s", err)
+	}
+	if _, err := conn.Exec(ctx, "SET search_path TO "+schema); err != nil {
+		t.Fatalf("set search_path not expect error %s", err)
+	}
+	list, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("embedded migrations not expect error %s", err)
+	}
+	if _, err := connectMigrateUp(ctx, conn, schema, list); err != nil {
+		t.Fatalf("migrate test schema not expect error %s", err)
+	}
+	return conn
+}
+
+func TestConnectMapTeam(t *testing.T) {
+	conn := testDbConn(t)
+	ctx := context.Background()
+	teams := []ConfigTeamMapping{
+		{Department: "Sales", Team: "Sales"},
+		{Department: `^support\M`, Regex: true, Team: "Support"},
+		{Department: `^dev(?=.*ops)`, Regex: true, Team: "DevOps"},
+		{Department: `^dev`, Regex: true, Team: "Development"},
+		{Department: "(sales", Team: "Literal"},
+		{Department: ".*", Regex: true, Team: strings.Repeat("x", maxTeamName+10)},
+	}
+	tables := []struct {
+		department string
+		e          string
+		name       string
+	}{
+		{"SALES", "Sales", "exact case insensitive"},
+		{"Sales EU", strings.Repeat("x", maxTeamName), "exact whole name, long team cut"},
+		{"Support Prague", "Support", "ARE word end"},
+		{"SupportDesk", strings.Repeat("x", maxTeamName), "ARE word end not match"},
+		{"Dev Ops", "DevOps", "ARE lookahead, first match used"},
+		{"Development", "Development", "regex case insensitive"},
+		{"(Sales", "Literal", "exact department not regex"},
+	}
+	for _, table := range tables {
+		team, err := connectMapTeam(ctx, conn, table.department, teams)
+		if err != nil {
+			t.Errorf("map team for [%s] not expect error %s", table.name, err)
+		} else if team != table.e {
+			t.Errorf("map team for [%s] expect %s got %s", table.name, table.e, team)
+		}
+	}
+	if team, err := connectMapTeam(ctx, conn, "Sales", nil); err != nil || team != "" {
+		t.Errorf("map team without rules expect no team, got %s %v", team, err)
+	}
+}
+
+func TestConnectCheckTeamMapping(t *testing.T) {
+	conn := testDbConn(t)
+	ctx := context.Background()
+	tables := []struct {
+		teams []ConfigTeamMapping
+		e     string
+		name  string
+	}{
+		{[]ConfigTeamMapping{{Department: `^dev(?=.*ops)`, Regex: true, Team: "DevOps"}}, "", "valid ARE"},
+		{[]ConfigTeamMapping{{Department: "(sales", Team: "Sales"}}, "", "exact department not checked"},
+		{[]ConfigTeamMapping{{Department: "(sales", Regex: true, Team: "Sales"}}, "not valid PostgreSQL regular expression", "invalid regex"},
+	}
+	for _, table := range tables {
+		err := connectCheckTeamMapping(ctx, conn, table.teams)
+		if table.e == "" && err != nil {
+			t.Errorf("check team mapping [%s] not expect error %s", table.name, err)
+		} else if table.e != "" && (err == nil || !strings.Contains(err.Error(), table.e)) {
+			t.Errorf("check team mapping [%s] expect error %s, got %v", table.name, table.e, err)
+		}
+	}
+}
+
+// testQmTables create minimal QM tables used by axl_update_qm, test DB must not contain QM schema wbsc
+var testQmTables = []string{
+	"CREATE SCHEMA wbsc",
+	"CREATE TABLE wbsc.ccgroups (ccgroupid serial primary key, ccgroupname varchar(50))",
+	"CREATE TABLE wbsc.roles (roleid serial primary key, name varchar(255))",
+	"CREATE TABLE wbsc.sc_users (userid serial primary key, name varchar(64), surname varchar(64), login varchar(144), " +
+		"database int, sync bool, status varchar(50), phone varchar(64), agentid varchar(128), identificator_used varchar(50), " +
+		"language int, company int, external_id varchar(255), daemon bool, email varchar(255), deleted_ts timestamp)",
+	"CREATE TABLE wbsc.user_belongsto_ccgroup (ccgroupid int, userid int)",
+	"CREATE TABLE wbsc.user_role (userid int, roleid int)",
+	"INSERT INTO wbsc.roles (name) VALUES ('Agent')",
+}
+
+func testQmSchema(t *testing.T, conn *pgxpool.Conn) {
+	ctx := context.Background()
+	var cnt int
+	if err := conn.QueryRow(ctx, "SELECT count(1) FROM information_schema.schemata WHERE schema_name = 'wbsc'").Scan(&cnt); err != nil {
+		t.Fatalf("check QM schema not expect error %s", err)
+	}
+	if cnt > 0 {
+		t.Skipf("schema wbsc exists, %s must be database without QM", testDbEnv)
+	}
+	t.Cleanup(func() {
+		_, _ = conn.Exec(context.Background(), "DROP SCHEMA IF EXISTS wbsc CASCADE")
+	})
+	for _, sql := range testQmTables {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("create QM table not expect error %s", err)
+		}
+	}
+}
+
+// testUpdateQm run axl_update_qm and return QM teams of user
+func testUpdateQm(t *testing.T, conn *pgxpool.Conn, teamJson string, agentId string) string {
+	ctx := context.Background()
+	rows, err := conn.Query(ctx, processQmUpdate, "_CUCM_imported", DefaultRoleName, teamJson, true, "[]")
+	if err != nil {
+		t.Fatalf("QM update not expect error %s", err)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		t.Fatalf("QM update not expect error %s", err)
+	}
+	var teams string
+	err = conn.QueryRow(ctx, "SELECT coalesce(string_agg(g.ccgroupname, ',' ORDER BY g.ccgroupname), '') FROM wbsc.sc_users s "+
+		"JOIN wbsc.user_belongsto_ccgroup b ON b.userid = s.userid JOIN wbsc.ccgroups g ON g.ccgroupid = b.ccgroupid "+
+		"WHERE s.agentid = $1", agentId).Scan(&teams)
+	if err != nil {
+		t.Fatalf("read QM teams not expect error %s", err)
+	}
+	return teams
+}
+
+func TestUpdateQm_LegacyUserTeam(t *testing.T) {
+	conn := testDbConn(t)
+	testQmSchema(t, conn)
+	ctx := context.Background()
+	setup := []string{
+		"INSERT INTO wbsc.ccgroups (ccgroupname) VALUES ('_CUCM_imported'), ('Manual')",
+		"INSERT INTO wbsc.sc_users (name, surname, login, database, sync, status, agentid, identificator_used, language, company, daemon) " +
+			"VALUES ('John', 'Doe', 'agent1', 4, false, 'INACTIVE', 'CL_u1', 'EXTERNAL_AGENT_ID', 1, 1, false)",
+		"INSERT INTO wbsc.user_belongsto_ccgroup (ccgroupid, userid) SELECT g.ccgroupid, s.userid FROM wbsc.ccgroups g, wbsc.sc_users s " +
+			"WHERE g.ccgroupname = 'Manual' AND s.agentid = 'CL_u1'",
+		"INSERT INTO axl_users (user_pkid, device_pkid, line_pkid, first_name, last_name, user_id, department, cluster_name) " +
+			"VALUES ('CL_u1', 'd1', 'l1', 'John', 'Doe', 'agent1', 'Sales', 'CL')",
+	}
+	for _, sql := range setup {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("prepare legacy user not expect error %s", err)
+		}
+	}
+	// user placed manually before team mapping is not moved by first syncs
+	for i := 0; i < 2; i++ {
+		if teams := testUpdateQm(t, conn, "[]", "CL_u1"); teams != "Manual" {
+			t.Errorf("legacy user moved on sync %d, teams [%s]", i+1, teams)
+		}
+	}
+	// changed mapping result move user from actual team
+	if teams := testUpdateQm(t, conn, `[{"department": "Sales", "regex": false, "team": "Sales"}]`, "CL_u1"); teams != "Sales" {
+		t.Errorf("user not moved after mapping change, teams [%s]", teams)
+	}
+}
@@ -0,0 +1 @@
+select name from dirgroup order by name
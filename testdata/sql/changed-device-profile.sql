@@ -0,0 +1,43 @@
+select eu.pkid as user_pkid,
+       d.pkid as device_pkid,
+       np.pkid as line_pkid,
+       eu.firstname,
+       eu.middlename,
+       eu.lastname,
+       eu.userid,
+       eu.department,
+       eu.status,
+       eu.islocaluser,
+       eunp.uccx,
+       eu.directoryuri,
+       eu.mailid,
+       d.name as devicename,
+       d.description as devicedescrition,
+       np.dnorpattern,
+       np.alertingnameascii,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name,
+       np.description as line_description,
+       tm.name as devicemodel,
+       rp.name as partitionname,
+       d.fkenduser as deviceowner,
+       CASE WHEN eupm.pkid IS NULL THEN 'f' ELSE 't' END as primaryline,
+       d.tkmodel as modelenum,
+       d.tkclass as classenum,
+       tc.name as deviceclass
+from enduser eu
+         LEFT OUTER JOIN (SELECT fkenduser, max(CASE tkdnusage WHEN 2 THEN tkdnusage ELSE null END) is not null AS uccx
+                          FROM endusernumplanmap
+                          GROUP BY fkenduser
+) AS eunp ON eunp.fkenduser = eu.pkid
+         INNER JOIN enduserdevicemap eudm ON eudm.fkenduser = eu.pkid
+         INNER JOIN device d ON d.pkid = eudm.fkdevice
+         INNER JOIN typemodel tm ON tm.enum = d.tkmodel
+         INNER JOIN typeclass tc ON tc.enum = d.tkclass
+         INNER JOIN devicenumplanmap dnpm ON d.pkid = dnpm.fkdevice
+         INNER JOIN numplan np ON np.pkid = dnpm.fknumplan
+         LEFT OUTER JOIN routepartition rp ON rp.pkid = np.fkroutepartition
+         LEFT OUTER JOIN endusernumplanmap eupm
+                         ON eupm.fkenduser = eu.pkid AND eupm.fknumplan = np.pkid AND eupm.tkdnusage = 1
+WHERE d.tkclass = 254
+  AND (eu.pkid in ('aaa') or d.pkid in ('aaa') or np.pkid in ('aaa'))
+ORDER BY eu.pkid, d.pkid, np.pkid
@@ -0,0 +1,12 @@
+select emd.fkdevice as device_pkid,
+       d.name as devicename,
+       emd.fkenduser as user_pkid,
+       eu.userid,
+       p.name as profilename,
+       emd.datetimestamp as logintime,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
+from extensionmobilitydynamic emd
+         INNER JOIN device d ON d.pkid = emd.fkdevice
+         INNER JOIN enduser eu ON eu.pkid = emd.fkenduser
+         LEFT OUTER JOIN device p ON p.pkid = emd.fkdevice_currentloginprofile
+ORDER BY d.name
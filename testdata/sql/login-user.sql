@@ -0,0 +1,22 @@
+select enduser.pkid as user_pkid,
+       enduser.firstname,
+       enduser.middlename,
+       enduser.lastname,
+       enduser.userid,
+       enduser.department,
+       enduser.status,
+       enduser.islocaluser,
+       eunp.uccx,
+       enduser.directoryuri,
+       enduser.mailid,
+       dg.name as accessgroup,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
+from enduser
+         LEFT OUTER JOIN (SELECT fkenduser, max(CASE tkdnusage WHEN 2 THEN tkdnusage ELSE null END) is not null AS uccx
+                          FROM endusernumplanmap
+                          GROUP BY fkenduser
+) AS eunp ON eunp.fkenduser = enduser.pkid
+         INNER JOIN enduserdirgroupmap e ON e.fkenduser = enduser.pkid
+         INNER JOIN dirgroup dg ON dg.pkid = e.fkdirgroup
+where dg.name in ('QM Access')
+ORDER BY enduser.pkid, dg.name
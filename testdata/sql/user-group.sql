@@ -0,0 +1,8 @@
+select eu.pkid as user_pkid,
+       dg.name as groupname,
+       (select paramvalue from processconfig where paramname = 'ClusterID') as cluster_name
+from enduserdirgroupmap m
+         INNER JOIN enduser eu ON eu.pkid = m.fkenduser
+         INNER JOIN dirgroup dg ON dg.pkid = m.fkdirgroup
+where lower(dg.name) in ('qm supervisors','qm evaluators')
+ORDER BY eu.pkid, dg.name